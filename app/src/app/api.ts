@@ -61,32 +61,59 @@ export class ListAnswerEntry {
   Launchable:   boolean;
 }
 
+function parseListEntries(json: string): any {
+  return JSON.parse(json, function(key: string, value: any) {
+    if (key === 'Deadline') {
+      return value === '⋅' ? undefined : new Date(value);
+    }
+    return value;
+  });
+}
+
+function normalizeListEntry(entry: any) {
+  if (!entry.hasOwnProperty('Deadline')) {
+    entry.Deadline = undefined;
+  }
+  if (!entry.hasOwnProperty('Deletable')) {
+    entry.Deletable = false;
+  }
+  if (!entry.hasOwnProperty('Launchable')) {
+    entry.Launchable = false;
+  }
+}
+
 export class ListAnswer {
   Public: ListAnswerEntry[];
   Own:    ListAnswerEntry[];
 
   static fromJSON(json: string): ListAnswer {
-    const ret = JSON.parse(json, function(key: string, value: any) {
-      if (key === 'Deadline') {
-        return value === '⋅' ? undefined : new Date(value);
-      }
-      return value;
-    });
+    const ret = parseListEntries(json);
+    ret.Public.forEach(normalizeListEntry);
+    ret.Own   .forEach(normalizeListEntry);
+    return ret;
+  }
+}
 
-    const normalize = function (entry: any) {
-      if (!entry.hasOwnProperty('Deadline')) {
-        entry.Deadline = undefined;
-      }
-      if (!entry.hasOwnProperty('Deletable')) {
-        entry.Deletable = false;
-      }
-      if (!entry.hasOwnProperty('Launchable')) {
-        entry.Launchable = false;
-      }
-    }
-    ret.Public.forEach(normalize);
-    ret.Own   .forEach(normalize);
+export interface ListQuery {
+  Own:          boolean;
+  Cursor?:      string;
+  Limit?:       number;
+  States?:      string[];
+  Actions?:     PollAction[];
+  Electorates?: Electorate[];
+  Admin?:       string;
+  After?:       Date;
+  Before?:      Date;
+  Search?:      string;
+}
 
+export class ListQueryAnswer {
+  Polls: ListAnswerEntry[];
+  Next?: string;
+
+  static fromJSON(json: string): ListQueryAnswer {
+    const ret = parseListEntries(json);
+    ret.Polls.forEach(normalizeListEntry);
     return ret;
   }
 }
@@ -99,11 +126,18 @@ export enum BallotType {
   // API types.
   Closed = 0,
   Uninominal,
+  Approval,
+  Ranked,
 }
 
 export enum InformationType {
   NoneYet,
   Counts,
+  None,
+  Winner,
+  Ranking,
+  Matrix,
+  Trends,
 }
 
 export class PollAnswer {
@@ -123,6 +157,8 @@ export class PollAnswer {
   MaxNbRounds:      number;
   Ballot:           BallotType;
   Information:      InformationType;
+  Sealed:           boolean;
+  OneMove:          boolean;
 
   static fromJSON(raw: string): PollAnswer {
     return JSON.parse(raw, function(key: string, value: any): any{
@@ -159,6 +195,35 @@ export interface UninominalVoteQuery {
   Round:        number;
 }
 
+export interface ApprovalBallotAnswer {
+  Previous?:         number[];
+  PreviousIsBlank?:  boolean;
+  Current?:          number[];
+  CurrentIsBlank?:   boolean;
+  MaxBallotCost:     number;
+  BallotCostIsCount: boolean;
+  Alternatives:      Array<PollAlternative>;
+}
+
+export interface ApprovalVoteQuery {
+  Alternatives: number[];
+  Round:        number;
+}
+
+export interface RankedBallotAnswer {
+  Previous?:        number[];
+  PreviousIsBlank?: boolean;
+  Current?:         number[];
+  CurrentIsBlank?:  boolean;
+  Alternatives:     Array<PollAlternative>;
+}
+
+// Alternatives are listed from the preferred one to the least preferred one.
+export interface RankedVoteQuery {
+  Alternatives: number[];
+  Round:        number;
+}
+
 export interface CountInfoEntry {
   Alternative: PollAlternative;
   Count: number;
@@ -168,10 +233,92 @@ export interface CountInfoAnswer {
   Result: Array<CountInfoEntry>;
 }
 
+export interface WinnerInfoAnswer {
+  Winners: Array<PollAlternative>;
+}
+
+// Ranking is sorted from the best alternative to the worst one.
+export interface RankingInfoAnswer {
+  Ranking: Array<PollAlternative>;
+}
+
+// Matrix[a][b] is the number of participants preferring alternative a to alternative b.
+export interface MatrixInfoAnswer {
+  Alternatives: Array<PollAlternative>;
+  Matrix:       number[][];
+}
+
+// Scores[r][a] is the score of alternative a at round r.
+export interface TrendsInfoAnswer {
+  Alternatives: Array<PollAlternative>;
+  Scores:       number[][];
+}
+
+export interface ResultInfoEntry {
+  Alternative: PollAlternative;
+  Score: number;
+}
+
+// Result is sorted from the best alternative to the worst one.
+// Selection lists the alternatives selected within MaxOutcomeCost.
+export interface ResultInfoAnswer {
+  Result:    Array<ResultInfoEntry>;
+  Winners:   number[];
+  Selection: number[];
+}
+
+// Counts[r][a] is the total weight of the participants who ranked alternative a first at round r.
+export interface HistoryInfoAnswer {
+  Alternatives: Array<PollAlternative>;
+  Counts:       number[][];
+}
+
+export interface ExportBallot {
+  Round:        number;
+  Participant:  number;
+  Weight:       number;
+  Alternatives: number[];
+  Ranks?:       number[];
+  Blank?:       boolean;
+  Modified?:    Date;
+}
+
+export interface ExportAnswer {
+  Title:        string;
+  Alternatives: Array<PollAlternative>;
+  Ballots:      Array<ExportBallot>;
+}
+
 export enum Electorate {
   All = -1,
   Logged,
-  Verified
+  Verified,
+  Invited
+}
+
+export enum PollRule {
+  Plurality,
+  Borda,
+  Copeland,
+  Schulze,
+  InstantRunoff,
+  Approval,
+  EqualShares,
+}
+
+export enum InformationPolicy {
+  None,
+  Winner,
+  Ranking,
+  Counts,
+  Matrix,
+  Trends,
+}
+
+export enum RoundType {
+  FreelyAsynchronous,
+  Synchronous,
+  OneMove,
 }
 
 export interface SimpleAlternative {
@@ -186,6 +333,13 @@ export interface CreateQuery {
   Electorate:       Electorate;
   Start:            Date;
   Alternatives:     SimpleAlternative[];
+  Ranked?:            boolean;
+  Rule?:              PollRule;
+  MaxOutcomeCost?:    number;
+  MaxBallotCost?:     number;
+  BallotCostIsCount?: boolean;
+  RoundType?:         RoundType;
+  Information?:       InformationPolicy;
   ReportVote:       boolean;
   MinNbRounds:      number;
   MaxNbRounds:      number;
@@ -193,6 +347,74 @@ export interface CreateQuery {
   MaxRoundDuration: number; // milliseconds
   RoundThreshold:   number;
   ShortURL:         string;
+  Template?:        string;
+}
+
+export interface TemplateEntry {
+  Name:  string;
+  Query: CreateQuery;
+}
+
+export interface TemplateNameQuery {
+  Name: string;
+}
+
+export interface WebhookQuery {
+  URL:   string;
+  Poll?: string;
+}
+
+export interface WebhookAnswer {
+  Id:     number;
+  Secret: string;
+}
+
+export interface WebhookIdQuery {
+  Id: number;
+}
+
+export interface WebhookEntry {
+  Id:        number;
+  URL:       string;
+  Poll?:     string;
+  Title?:    string;
+  Created:   Date;
+  Pending:   number;
+  Delivered: number;
+  Failed:    number;
+}
+
+export interface WebhookDelivery {
+  Id:          number;
+  Event:       string;
+  Status:      string;
+  Attempts:    number;
+  LastCode?:   number;
+  LastError?:  string;
+  Created:     Date;
+  NextAttempt: Date;
+}
+
+export interface EmailPrefs {
+  Start:     boolean;
+  NextRound: boolean;
+  Close:     boolean;
+  Delete:    boolean;
+  Reminder:  boolean;
+}
+
+export interface CalendarTokenAnswer {
+  Token: string;
+}
+
+export interface CloneQuery {
+  Title?: string;
+  Start?: Date;
+}
+
+export interface ExtendQuery {
+  Deadline?:    Date;
+  MaxNbRounds?: number;
 }
 
 export enum PollNotifAction {
@@ -200,14 +422,22 @@ export enum PollNotifAction {
   Next,
   Term,
   Delete,
+  Pause,
+  Resume,
+  Extend,
+  Vote,
 }
 
 export class PollNotifAnswerEntry {
+  Id?:       number;
   Timestamp: Date;
   Segment:   string;
   Title:     string;
   Round:     number;
   Action:    PollNotifAction;
+  Winners?:  number[];
+  Voters?:   number;
+  Read?:     boolean;
 
   static fromJSONList(json: string): PollNotifAnswerEntry[] {
     return JSON.parse(json, function(key: string, value: any) {
@@ -217,6 +447,106 @@ export class PollNotifAnswerEntry {
   }
 }
 
+export interface PollNotifListQuery {
+  Before?: number;
+  Limit?:  number;
+  Unread?: boolean;
+}
+
+export class PollNotifListAnswer {
+  Notifications: PollNotifAnswerEntry[];
+  Unread:        number;
+
+  static fromJSON(json: string): PollNotifListAnswer {
+    return JSON.parse(json, function(key: string, value: any) {
+      if (key === 'Timestamp') { return new Date(value as string); }
+      return value;
+    });
+  }
+}
+
+export interface PollNotifIdsQuery {
+  Ids?: number[];
+  All?: boolean;
+}
+
 export interface ConfirmAnswer {
   Type: string
+  Poll?: string
+}
+
+export interface DelegateQuery {
+  Delegate: string;
+}
+
+export interface InviteQuery {
+  Emails: Array<string>;
+}
+
+export interface InviteAnswer {
+  Invited: Array<string>;
+}
+
+export interface WeightEntry {
+  Name?:  string;
+  Email?: string;
+  Weight: number;
+}
+
+export interface WeightList {
+  Weights: Array<WeightEntry>;
+}
+
+export interface LiveResult {
+  Round:    number;
+  Winners?: number[];
+}
+
+export interface LiveComment {
+  Id:     number;
+  Action: string;
+}
+
+export interface LiveAnswer {
+  State:          string;
+  CurrentRound:   number;
+  RoundDeadline?: Date;
+  Participants?:  number;
+  Result?:        LiveResult;
+  Comment?:       LiveComment;
+}
+
+export class CommentEntry {
+  Id:           number;
+  Alternative?: number;
+  Parent?:      number;
+  Author?:      string;
+  Own?:         boolean;
+  Content?:     string;
+  Deleted?:     boolean;
+  Created:      Date;
+  Edited?:      Date;
+}
+
+export class CommentListAnswer {
+  Comments:   CommentEntry[];
+  Moderator?: boolean;
+
+  static fromJSON(json: string): CommentListAnswer {
+    return JSON.parse(json, function(key: string, value: any) {
+      if (key === 'Created' || key === 'Edited') { return new Date(value as string); }
+      return value;
+    });
+  }
+}
+
+export interface CommentQuery {
+  Id?:          number;
+  Content?:     string;
+  Alternative?: number;
+  Parent?:      number;
+}
+
+export interface CommentAnswer {
+  Id: number;
 }
@@ -17,12 +17,10 @@
 import { NgModule } from '@angular/core';
 import { Routes, RouterModule } from '@angular/router';
 
-import { LoggedGuard } from '../session/logged.guard';
-
 import { ListComponent } from './list.component';
 
 const routes: Routes = [
-  { path: 'r/list', component: ListComponent, canActivate: [ LoggedGuard ], data: {title: 'Polls'} },
+  { path: 'r/list', component: ListComponent, data: {title: 'Polls'} },
 ];
 
 @NgModule({
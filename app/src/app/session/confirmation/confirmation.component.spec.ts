@@ -15,7 +15,7 @@
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
 import { ComponentFixture, TestBed } from '@angular/core/testing';
-import { ActivatedRoute } from '@angular/router';
+import { ActivatedRoute, Router } from '@angular/router';
 import { HttpClientTestingModule, HttpTestingController } from '@angular/common/http/testing';
 
 import { ActivatedRouteStub } from 'src/testing/activated-route-stub'
@@ -27,9 +27,11 @@ describe('ConfirmationComponent', () => {
   let fixture: ComponentFixture<ConfirmationComponent>;
   let httpControler: HttpTestingController;
   let activatedRouteStub: ActivatedRouteStub;
+  let routerSpy: jasmine.SpyObj<Router>;
 
   beforeEach(async () => {
     activatedRouteStub = new ActivatedRouteStub();
+    routerSpy = jasmine.createSpyObj('Router', ['navigate']);
 
     await TestBed.configureTestingModule({
       declarations: [ ConfirmationComponent ],
@@ -38,6 +40,7 @@ describe('ConfirmationComponent', () => {
       ],
       providers: [
         { provide: ActivatedRoute, useValue: activatedRouteStub },
+        { provide: Router, useValue: routerSpy },
       ],
     })
     .compileComponents();
@@ -16,7 +16,7 @@
 
 import { Component, OnInit, ChangeDetectionStrategy } from '@angular/core';
 import { HttpClient, HttpErrorResponse } from '@angular/common/http';
-import { ActivatedRoute, ParamMap } from '@angular/router';
+import { ActivatedRoute, ParamMap, Router } from '@angular/router';
 
 import { take } from 'rxjs/operators';
 
@@ -46,6 +46,7 @@ export class ConfirmationComponent implements OnInit {
   constructor(
     private http: HttpClient,
     private route: ActivatedRoute,
+    private router: Router,
   ) { }
 
   private _segment: string
@@ -54,6 +55,10 @@ export class ConfirmationComponent implements OnInit {
       this._segment = params.get('confirmSegment')
       this.http.get<ConfirmAnswer>('/a/confirm/' + this._segment).pipe(take(1)).subscribe({
         next: (answer: ConfirmAnswer) => {
+          if (answer.Type == 'invite') {
+            this.router.navigate(['/r/poll', answer.Poll])
+            return
+          }
           this._state.next({ type: answer.Type })
         },
         error: (err: HttpErrorResponse) => {
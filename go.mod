@@ -7,6 +7,7 @@ require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.1
+	github.com/gorilla/websocket v1.4.2
 	github.com/justinas/alice v1.2.0
 	github.com/tevino/abool v1.2.0
 	golang.org/x/crypto v0.0.0-20201117144127-c1f2f97bffc9
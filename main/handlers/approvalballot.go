@@ -0,0 +1,114 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/mid/unlogged"
+)
+
+// ApprovalBallotAnswer represents the response sent by ApprovalBallotHandler.
+// The fields Previous and Current are not sent in the JSON representation if the user did not vote.
+// If the user abstained, these fields are replaced with fields PreviousIsBlank or CurrentIsBlank
+// with the boolean value true.
+type ApprovalBallotAnswer struct {
+	Previous          AlternativeList `json:",omitempty"`
+	PreviousIsBlank   bool            `json:",omitempty"`
+	Current           AlternativeList `json:",omitempty"`
+	CurrentIsBlank    bool            `json:",omitempty"`
+	MaxBallotCost     float64
+	BallotCostIsCount bool
+	Alternatives      []PollAlternative
+}
+
+// ApprovalBallotHandler sends the previous ballot (if any), the current one (if any), the
+// constraints on ballots and all the alternatives.
+func ApprovalBallotHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+
+	answer := ApprovalBallotAnswer{
+		MaxBallotCost:     pollInfo.MaxBallotCost,
+		BallotCostIsCount: pollInfo.BallotCostIsCount,
+	}
+	answer.Previous, answer.PreviousIsBlank, answer.Current, answer.CurrentIsBlank =
+		userListBallots(ctx, pollInfo, request)
+
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+	response.SendJSON(ctx, &answer)
+}
+
+// userListBallots retrieves the ballots of the user for the previous and the current rounds, when
+// ballots are lists of alternatives. Alternatives are sorted by rank, then by id.
+// If the request has no user, the unlogged pseudo-user corresponding to the remote address is used.
+// Errors are sent by panic.
+func userListBallots(ctx context.Context, pollInfo PollInfo, request *server.Request) (
+	previous AlternativeList, previousIsBlank bool, current AlternativeList, currentIsBlank bool) {
+
+	const qGetBallots = `
+		SELECT p.Round, b.Alternative
+		  FROM Participants AS p
+			LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		 WHERE p.User = ? AND p.Poll = ? AND p.Round IN (?, ?)
+		 ORDER BY p.Round, b.Rank, b.Alternative`
+
+	if request.User == nil {
+		user, err := unlogged.FromAddr(ctx, request.RemoteAddr())
+		must(err)
+		request.User = &user
+	}
+
+	var previousRound uint8
+	if pollInfo.CurrentRound > 0 {
+		// Round is unsigned
+		previousRound = pollInfo.CurrentRound - 1
+	}
+	rows, err := db.DB.QueryContext(ctx, qGetBallots,
+		request.User.Id, pollInfo.Id, previousRound, pollInfo.CurrentRound)
+	must(err)
+	defer rows.Close()
+	for rows.Next() {
+		var round uint8
+		var alternative sql.NullInt32
+		must(rows.Scan(&round, &alternative))
+		addToBallot := func(ballot *AlternativeList, isBlank *bool) {
+			if !alternative.Valid {
+				if *isBlank || len(*ballot) > 0 {
+					must(errors.New("Duplicated ballot"))
+				}
+				*isBlank = true
+				return
+			}
+			*ballot = append(*ballot, uint8(alternative.Int32))
+		}
+		switch round {
+		case pollInfo.CurrentRound:
+			addToBallot(&current, &currentIsBlank)
+		case previousRound:
+			addToBallot(&previous, &previousIsBlank)
+		default:
+			must(errors.New("Impossible round"))
+		}
+	}
+	must(rows.Err())
+	return
+}
@@ -0,0 +1,176 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestApprovalBallotAnswer_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer ApprovalBallotAnswer
+		expect string
+	}{
+		{
+			name:   "Empty",
+			answer: ApprovalBallotAnswer{MaxBallotCost: 2, BallotCostIsCount: true},
+			expect: `{"MaxBallotCost":2,"BallotCostIsCount":true,"Alternatives":null}`,
+		},
+		{
+			name: "Full",
+			answer: ApprovalBallotAnswer{
+				Previous:          AlternativeList{0, 2},
+				Current:           AlternativeList{1},
+				MaxBallotCost:     2,
+				BallotCostIsCount: true,
+			},
+			expect: `{"Previous":[0,2],"Current":[1],"MaxBallotCost":2,"BallotCostIsCount":true,` +
+				`"Alternatives":null}`,
+		},
+		{
+			name: "Blank",
+			answer: ApprovalBallotAnswer{
+				PreviousIsBlank:   true,
+				CurrentIsBlank:    true,
+				MaxBallotCost:     1.5,
+				BallotCostIsCount: false,
+			},
+			expect: `{"PreviousIsBlank":true,"CurrentIsBlank":true,"MaxBallotCost":1.5,` +
+				`"BallotCostIsCount":false,"Alternatives":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(&tt.answer)
+			if err != nil {
+				t.Fatalf("Error: %v.", err)
+			}
+			if string(got) != tt.expect {
+				t.Errorf("Got %s. Expect %s.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestApprovalBallotHandler(t *testing.T) {
+	precheck(t)
+
+	env := new(dbt.Env)
+	defer env.Close()
+
+	userId := env.CreateUser()
+	pollId := env.CreatePollWith("ApprovalBallotHandler", userId, db.ElectorateAll,
+		[]string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET MaxBallotCost = 2 WHERE Id = ?`, pollId)
+	mustt(t, env.Error)
+
+	request := *makePollRequest(t, pollId, &userId)
+
+	alternatives := []PollAlternative{
+		{Id: 0, Name: "A", Cost: 1.},
+		{Id: 1, Name: "B", Cost: 1.},
+		{Id: 2, Name: "C", Cost: 1.},
+	}
+
+	vote := func(round uint8, alts ...uint8) func(t *testing.T) {
+		return func(t *testing.T) {
+			for _, alt := range alts {
+				env.Vote(pollId, round, userId, alt)
+			}
+			env.Must(t)
+		}
+	}
+
+	makeAnswer := func(answer ApprovalBallotAnswer) *ApprovalBallotAnswer {
+		answer.MaxBallotCost = 2
+		answer.BallotCostIsCount = true
+		answer.Alternatives = alternatives
+		return &answer
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "No Ballot",
+			Request: request,
+			Checker: srvt.CheckJSON{Body: makeAnswer(ApprovalBallotAnswer{})},
+		},
+		&srvt.T{
+			Name:    "Current ballot",
+			Update:  vote(0, 2, 0),
+			Request: request,
+			Checker: srvt.CheckJSON{Body: makeAnswer(ApprovalBallotAnswer{
+				Current: AlternativeList{0, 2},
+			})},
+		},
+		&srvt.T{
+			Name: "Previous ballot",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: srvt.CheckJSON{Body: makeAnswer(ApprovalBallotAnswer{
+				Previous: AlternativeList{0, 2},
+			})},
+		},
+		&srvt.T{
+			Name: "Current blank",
+			Update: func(t *testing.T) {
+				const qParticipate = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, 1)`
+				env.QuietExec(qParticipate, userId, pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: srvt.CheckJSON{Body: makeAnswer(ApprovalBallotAnswer{
+				Previous:       AlternativeList{0, 2},
+				CurrentIsBlank: true,
+			})},
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:          "Unlogged public",
+			Electorate:    db.ElectorateAll,
+			Alternatives:  []string{"A", "B", "C"},
+			MaxBallotCost: 2,
+			Vote:          []pollTestVote{{1, 0, 0}, {1, 0, 1}, {0, 0, 2}},
+			UserType:      pollTestUserTypeUnlogged,
+			Checker: srvt.CheckJSON{Body: makeAnswer(ApprovalBallotAnswer{
+				Current: AlternativeList{0, 1},
+			})},
+		},
+		&pollTest{
+			Name:          "Unlogged registered",
+			Electorate:    db.ElectorateLogged,
+			MaxBallotCost: 2,
+			UserType:      pollTestUserTypeUnlogged,
+			Checker:       srvt.CheckError{Code: http.StatusForbidden, Body: "Unlogged"},
+		},
+	}
+	srvt.RunFunc(t, tests, ApprovalBallotHandler)
+}
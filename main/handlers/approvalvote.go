@@ -0,0 +1,99 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+// ApprovalVoteQuery is the ballot of an approval poll. An empty list of alternatives is a blank
+// vote.
+type ApprovalVoteQuery struct {
+	Alternatives AlternativeList
+	Round        uint8
+}
+
+type approvalVoteHandler struct {
+	evtManager events.Manager
+}
+
+// ApprovalVoteHandler votes for a set of alternatives. The cost of the set must not exceed the
+// maximal ballot cost of the poll. Blank votes are also permitted.
+func ApprovalVoteHandler(evtManager events.Manager) approvalVoteHandler {
+	return approvalVoteHandler{evtManager: evtManager}
+}
+
+func (self approvalVoteHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, sendUnloggedCookie := checkVoteRequest(ctx, request, BallotTypeApproval)
+
+	// Get query
+	var voteQuery ApprovalVoteQuery
+	if err := request.UnmarshalJSONBody(&voteQuery); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Wrong request", err))
+	}
+	checkApprovalBallot(ctx, pollInfo, voteQuery.Alternatives)
+	checkVoteRound(pollInfo, voteQuery.Round)
+
+	const qInsertBallot = `INSERT INTO Ballots (User, Poll, Alternative, Round) VALUE (?, ?, ?, ?)`
+
+	recordBallot(ctx, pollInfo, request.User.Id, func(tx *sql.Tx) {
+		if len(voteQuery.Alternatives) == 0 {
+			return
+		}
+		stmt, err := tx.PrepareContext(ctx, qInsertBallot)
+		must(err)
+		defer stmt.Close()
+		for _, alt := range voteQuery.Alternatives {
+			_, err = stmt.ExecContext(ctx, request.User.Id, pollInfo.Id, alt, pollInfo.CurrentRound)
+			must(err)
+		}
+	})
+
+	if sendUnloggedCookie {
+		response.SendUnloggedId(ctx, *request.User, request)
+	}
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.VoteEvent{Poll: pollInfo.Id})
+}
+
+// checkApprovalBallot ensures that the ballot is a set of alternatives of the poll whose cost is at
+// most the maximal ballot cost of the poll.
+// Errors are sent by panic.
+func checkApprovalBallot(ctx context.Context, pollInfo PollInfo, ballot AlternativeList) {
+	checkAlternativeSet(pollInfo, ballot)
+
+	var cost float64
+	if pollInfo.BallotCostIsCount {
+		cost = float64(len(ballot))
+	} else if len(ballot) > 0 {
+		var alternatives []PollAlternative
+		allAlternatives(ctx, pollInfo, &alternatives)
+		for _, alt := range ballot {
+			cost += alternatives[alt].Cost
+		}
+	}
+	if cost > pollInfo.MaxBallotCost+costEpsilon {
+		panic(server.NewHttpError(http.StatusBadRequest, "Ballot too costly",
+			"The cost of the ballot exceeds MaxBallotCost"))
+	}
+}
@@ -0,0 +1,222 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+type approvalVoteChecker struct {
+	poll  uint32
+	user  uint32
+	round uint8
+}
+
+func (self *approvalVoteChecker) Check(t *testing.T, response *http.Response, request *server.Request) {
+	srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+	var query ApprovalVoteQuery
+	mustt(t, request.UnmarshalJSONBody(&query))
+
+	const (
+		qParticipate = `SELECT 1 FROM Participants WHERE Poll = ? AND User = ? AND Round = ?`
+		qBallot      = `
+		  SELECT Alternative FROM Ballots
+		   WHERE Poll = ? AND User = ? AND Round = ?
+		   ORDER BY Alternative ASC`
+	)
+
+	rows, err := db.DB.Query(qParticipate, self.poll, self.user, self.round)
+	mustt(t, err)
+	if !rows.Next() {
+		t.Errorf("User %d does not participate in poll %d.", self.user, self.poll)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(qBallot, self.poll, self.user, self.round)
+	mustt(t, err)
+	defer rows.Close()
+	got := AlternativeList{}
+	for rows.Next() {
+		var alt uint8
+		mustt(t, rows.Scan(&alt))
+		got = append(got, alt)
+	}
+
+	expect := append(AlternativeList{}, query.Alternatives...)
+	sort.Slice(expect, func(i, j int) bool { return expect[i] < expect[j] })
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v. Expect %v.", got, expect)
+	}
+}
+
+func approvalVoteCheckerFactory(param PollTestCheckerFactoryParam) srvt.Checker {
+	return &approvalVoteChecker{poll: param.PollId, user: param.UserId, round: param.Round}
+}
+
+func TestApprovalVoteHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUser()
+	pollId := env.CreatePollWith("Test", userId, db.ElectorateLogged, []string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET MaxBallotCost = 2 WHERE Id = ?`, pollId)
+	env.Must(t)
+
+	fillRequest := func(vote ApprovalVoteQuery, req srvt.Request) srvt.Request {
+		b, err := json.Marshal(vote)
+		mustt(t, err)
+		req.Body = string(b)
+		req.Method = "POST"
+		return req
+	}
+
+	makeRequest := func(vote ApprovalVoteQuery) srvt.Request {
+		return fillRequest(vote, *makePollRequest(t, pollId, &userId))
+	}
+
+	s := func(s string) *string { return &s }
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "First vote",
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{2, 0}}),
+			Checker: &approvalVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Change vote",
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{1}}),
+			Checker: &approvalVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Blank",
+			Request: makeRequest(ApprovalVoteQuery{}),
+			Checker: &approvalVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Too many",
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{0, 1, 2}}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Ballot too costly"},
+		},
+		&srvt.T{
+			Name:    "Duplicate",
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{1, 1}}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong alternative"},
+		},
+		&srvt.T{
+			Name:    "Unknown alternative",
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{3}}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong alternative"},
+		},
+		&srvt.T{
+			Name: "Next round",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{0, 1}, Round: 1}),
+			Checker: &approvalVoteChecker{poll: pollId, user: userId, round: 1},
+		},
+		&srvt.T{
+			Name:    "Previous round",
+			Request: makeRequest(ApprovalVoteQuery{Round: 0}),
+			Checker: srvt.CheckError{Code: http.StatusLocked, Body: "Next round"},
+		},
+		&srvt.T{
+			Name: "By cost",
+			Update: func(t *testing.T) {
+				const (
+					qPoll        = `UPDATE Polls SET BallotCostIsCount = FALSE WHERE Id = ?`
+					qAlternative = `UPDATE Alternatives SET Cost = 0.5 WHERE Poll = ? AND Id < 2`
+				)
+				env.QuietExec(qPoll, pollId)
+				env.QuietExec(qAlternative, pollId)
+				env.Must(t)
+			},
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{0, 1, 2}, Round: 1}),
+			Checker: &approvalVoteChecker{poll: pollId, user: userId, round: 1},
+		},
+		&srvt.T{
+			Name: "Too costly",
+			Update: func(t *testing.T) {
+				const qAlternative = `UPDATE Alternatives SET Cost = 1 WHERE Poll = ? AND Id = 0`
+				env.QuietExec(qAlternative, pollId)
+				env.Must(t)
+			},
+			Request: makeRequest(ApprovalVoteQuery{Alternatives: AlternativeList{0, 1, 2}, Round: 1}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Ballot too costly"},
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:           "Unlogged public",
+			Electorate:     db.ElectorateAll,
+			MaxBallotCost:  2,
+			UserType:       pollTestUserTypeUnlogged,
+			Request:        fillRequest(ApprovalVoteQuery{Alternatives: AlternativeList{0, 1}}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+			Checker:        approvalVoteCheckerFactory,
+		},
+		&pollTest{
+			Name:           "No user public",
+			Electorate:     db.ElectorateAll,
+			MaxBallotCost:  2,
+			UserType:       pollTestUserTypeNone,
+			Request:        fillRequest(ApprovalVoteQuery{Alternatives: AlternativeList{1}}, srvt.Request{RemoteAddr: s("1.2.3.4:5")}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+			Checker:        approvalVoteCheckerFactory,
+		},
+		&pollTest{
+			Name:           "Uninominal poll",
+			Electorate:     db.ElectorateLogged,
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(ApprovalVoteQuery{Alternatives: AlternativeList{1}}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     0,
+			Checker:        srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong poll"},
+		},
+		&pollTest{
+			Name:           "Waiting",
+			Electorate:     db.ElectorateLogged,
+			MaxBallotCost:  2,
+			Waiting:        true,
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(ApprovalVoteQuery{Alternatives: AlternativeList{1}}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     0,
+			Checker:        srvt.CheckStatus{Code: http.StatusLocked},
+		},
+	}
+
+	srvt.Run(t, tests, ApprovalVoteHandler)
+}
@@ -0,0 +1,147 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// cloneDefaultDelay is the time before the start of cloned polls, when no start is given.
+const cloneDefaultDelay = 24 * time.Hour
+
+// CloneQuery is the query for CloneHandler.
+// If Title is empty, the title of the original poll is used. If Start is zero, the new poll starts
+// one day later.
+type CloneQuery struct {
+	Title string
+	Start time.Time
+}
+
+type cloneHandler struct {
+	evtManager events.Manager
+}
+
+// CloneHandler creates a new waiting poll with the same parameters and alternatives as a poll
+// administered by the user. The deadline is shifted so that the new poll lasts as long as the
+// original one. The short URL is not copied.
+func CloneHandler(evtManager events.Manager) cloneHandler {
+	return cloneHandler{evtManager: evtManager}
+}
+
+func (self cloneHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	original, err := salted.FromRequest(request)
+	must(err)
+
+	var query CloneQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if query.Start.IsZero() {
+		query.Start = time.Now().Add(cloneDefaultDelay)
+	} else if !query.Start.After(time.Now()) {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Start must be after now"))
+	}
+
+	pollSegment, err := salted.New(0)
+	must(err)
+
+	const (
+		qCheck = `
+		  SELECT Salt, Admin, Title, Created, Start, Deadline
+		    FROM Polls
+		   WHERE Id = ?
+		     LOCK IN SHARE MODE`
+		qClone = `
+		  INSERT INTO Polls (Title, Description, Admin, State, Start, Salt, Type, Electorate, Hidden,
+		                     NbChoices, MaxOutcomeCost, MaxBallotCost, BallotCostIsCount, Rule,
+		                     RoundType, ReportVote, Information, MinNbRounds, MaxNbRounds, Deadline,
+		                     MaxRoundDuration, RoundThreshold)
+		  SELECT ?, Description, Admin, 'Waiting', ?, ?, Type, Electorate, Hidden,
+		         NbChoices, MaxOutcomeCost, MaxBallotCost, BallotCostIsCount, Rule,
+		         RoundType, ReportVote, Information, MinNbRounds, MaxNbRounds, ?,
+		         MaxRoundDuration, RoundThreshold
+		    FROM Polls
+		   WHERE Id = ?`
+		qAlternatives = `
+		  INSERT INTO Alternatives (Poll, Id, Name, Cost)
+		  SELECT ?, Id, Name, Cost FROM Alternatives WHERE Poll = ?`
+	)
+
+	db.RepeatDeadlocked(slog.CtxLoadLogger(ctx), ctx, nil, func(tx *sql.Tx) {
+		rows, err := tx.QueryContext(ctx, qCheck, original.Id)
+		must(err)
+		defer rows.Close()
+		if !rows.Next() {
+			panic(noPollError("No such Id"))
+		}
+
+		var salt, admin uint32
+		var title string
+		var created time.Time
+		var start, deadline sql.NullTime
+		must(rows.Scan(&salt, &admin, &title, &created, &start, &deadline))
+		rows.Close()
+		if salt != original.Salt {
+			panic(noPollError("Wrong salt"))
+		}
+		if admin != request.User.Id {
+			panic(server.UnauthorizedHttpError("Not admin"))
+		}
+
+		if query.Title != "" {
+			title = query.Title
+		}
+		if deadline.Valid {
+			if start.Valid {
+				created = start.Time
+			}
+			duration := deadline.Time.Sub(created)
+			if duration <= 0 {
+				duration = 7 * 24 * time.Hour
+			}
+			deadline.Time = query.Start.Add(duration)
+		}
+
+		result, err := tx.ExecContext(ctx, qClone, title, query.Start, pollSegment.Salt, deadline,
+			original.Id)
+		must(err)
+		tmp, err := result.LastInsertId()
+		must(err)
+		pollSegment.Id = uint32(tmp)
+
+		_, err = tx.ExecContext(ctx, qAlternatives, pollSegment.Id, original.Id)
+		must(err)
+	})
+
+	segment, err := pollSegment.Encode()
+	must(err)
+	response.SendJSON(ctx, segment)
+	self.evtManager.Send(services.CreatePollEvent{Poll: pollSegment.Id})
+}
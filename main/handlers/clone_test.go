@@ -0,0 +1,136 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestCloneHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith("CloneAdmin")
+	other := env.CreateUserWith("CloneOther")
+	pollId := env.CreatePollWith("Original", admin, db.ElectorateAll, []string{"Ham", "Stram"})
+	env.QuietExec(`UPDATE Polls SET Deadline = ADDTIME(Created, '48:00:00') WHERE Id = ?`, pollId)
+	env.Must(t)
+
+	makeRequest := func(userId *uint32, query CloneQuery) srvt.Request {
+		request := *makePollRequest(t, pollId, userId)
+		body, err := json.Marshal(query)
+		mustt(t, err)
+		request.Method = "POST"
+		request.Body = string(body)
+		return request
+	}
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	checker := func(title string) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+			const (
+				qPoll = `
+				  SELECT Title, State, Start, TIMEDIFF(Deadline, Start)
+				    FROM Polls WHERE Id = ?`
+				qAlternatives = `SELECT Name FROM Alternatives WHERE Poll = ? ORDER BY Id`
+				qCleanUp      = `DELETE FROM Polls WHERE Id = ?`
+			)
+
+			var answer string
+			mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+			segment, err := salted.Decode(answer)
+			mustt(t, err)
+			defer db.DB.Exec(qCleanUp, segment.Id)
+			if segment.Id == pollId {
+				t.Fatalf("Same poll.")
+			}
+
+			var gotTitle, duration string
+			var state db.State
+			var gotStart time.Time
+			mustt(t, db.DB.QueryRow(qPoll, segment.Id).Scan(&gotTitle, &state, &gotStart, &duration))
+			if gotTitle != title {
+				t.Errorf("Wrong title. Got %s. Expect %s.", gotTitle, title)
+			}
+			if state != db.StateWaiting {
+				t.Errorf("Wrong state. Got %s. Expect %s.", state, db.StateWaiting)
+			}
+			if !gotStart.Equal(start) {
+				t.Errorf("Wrong start. Got %v. Expect %v.", gotStart, start)
+			}
+			if duration != "48:00:00" {
+				t.Errorf("Wrong duration. Got %s. Expect 48:00:00.", duration)
+			}
+
+			rows, err := db.DB.Query(qAlternatives, segment.Id)
+			mustt(t, err)
+			defer rows.Close()
+			var alternatives []string
+			for rows.Next() {
+				var name string
+				mustt(t, rows.Scan(&name))
+				alternatives = append(alternatives, name)
+			}
+			if expect := []string{"Ham", "Stram"}; !reflect.DeepEqual(alternatives, expect) {
+				t.Errorf("Wrong alternatives. Got %v. Expect %v.", alternatives, expect)
+			}
+		})
+	}
+
+	tests := []srvt.Test{
+		&srvt.T{
+			Name:    "No user",
+			Request: makeRequest(nil, CloneQuery{}),
+			Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+		&srvt.T{
+			Name:    "Not admin",
+			Request: makeRequest(&other, CloneQuery{}),
+			Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+		&srvt.T{
+			Name:    "Past start",
+			Request: makeRequest(&admin, CloneQuery{Start: time.Now().Add(-time.Hour)}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&srvt.T{
+			Name:    "Same title",
+			Request: makeRequest(&admin, CloneQuery{Start: start}),
+			Checker: checker("Original"),
+		},
+		&srvt.T{
+			Name:    "New title",
+			Request: makeRequest(&admin, CloneQuery{Title: "Copy", Start: start}),
+			Checker: checker("Copy"),
+		},
+	}
+	srvt.Run(t, tests, CloneHandler)
+}
@@ -0,0 +1,314 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+// CommentEntry is a comment on a poll, or on one of its alternatives if Alternative is not nil.
+// Parent is the identifier of the comment this one replies to, or zero. Author and Content are
+// empty for deleted comments. Own is true for comments posted by the user doing the request.
+type CommentEntry struct {
+	Id          uint32
+	Alternative *uint8 `json:",omitempty"`
+	Parent      uint32 `json:",omitempty"`
+	Author      string `json:",omitempty"`
+	Own         bool   `json:",omitempty"`
+	Content     string `json:",omitempty"`
+	Deleted     bool   `json:",omitempty"`
+	Created     time.Time
+	Edited      *time.Time `json:",omitempty"`
+}
+
+// CommentListAnswer contains all the comments on a poll, in the order they have been posted.
+// Moderator is true if the user doing the request can delete all comments.
+type CommentListAnswer struct {
+	Comments  []CommentEntry
+	Moderator bool `json:",omitempty"`
+}
+
+// CommentQuery is the body of requests modifying comments. Id is used to edit or delete a
+// comment. Content is used to post or edit a comment. Alternative and Parent are used to post a
+// comment. Replies are always on the same alternative as their parent.
+type CommentQuery struct {
+	Id          uint32 `json:",omitempty"`
+	Content     string `json:",omitempty"`
+	Alternative *uint8 `json:",omitempty"`
+	Parent      uint32 `json:",omitempty"`
+}
+
+// CommentAnswer is the answer to the request posting a new comment.
+type CommentAnswer struct {
+	Id uint32
+}
+
+// CommentMaxLength is the maximal number of characters in a comment.
+const CommentMaxLength = 4000
+
+var errCommentEmpty = errors.New("Empty comment")
+var errCommentTooLong = errors.New("Comment too long")
+
+// commentContent returns the content of a comment, with leading and trailing spaces removed.
+func commentContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errCommentEmpty
+	}
+	if utf8.RuneCountInString(content) > CommentMaxLength {
+		return "", errCommentTooLong
+	}
+	return content, nil
+}
+
+func noCommentError(reason string) server.HttpError {
+	return server.NewHttpError(http.StatusNotFound, "No comment", reason)
+}
+
+// isPollAdmin returns whether the user is the administrator of the poll.
+// Errors are sent by panic.
+func isPollAdmin(ctx context.Context, poll uint32, user uint32) bool {
+	const qAdmin = `SELECT 1 FROM Polls WHERE Id = ? AND Admin = ?`
+	rows, err := db.DB.QueryContext(ctx, qAdmin, poll, user)
+	must(err)
+	defer rows.Close()
+	return rows.Next()
+}
+
+// checkCommentRequest does all the verifications common to handlers modifying comments, and
+// returns the information on the poll and the query.
+// Errors are sent by panic.
+func checkCommentRequest(ctx context.Context, request *server.Request) (PollInfo, CommentQuery) {
+	must(request.CheckPOST(ctx))
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+	if request.User == nil {
+		panic(server.UnauthorizedHttpError("No user"))
+	}
+
+	var query CommentQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	return pollInfo, query
+}
+
+// commentAuthor returns the author of a comment that has not been deleted.
+// Errors are sent by panic.
+func commentAuthor(ctx context.Context, poll uint32, comment uint32) (author uint32) {
+	const qAuthor = `SELECT Author FROM Comments WHERE Id = ? AND Poll = ? AND NOT Deleted`
+	err := db.DB.QueryRowContext(ctx, qAuthor, comment, poll).Scan(&author)
+	if errors.Is(err, sql.ErrNoRows) {
+		panic(noCommentError("Comment not found"))
+	}
+	must(err)
+	return
+}
+
+//
+// CommentListHandler
+//
+
+// CommentListHandler sends all the comments on a poll.
+func CommentListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+
+	var user uint32
+	var answer CommentListAnswer
+	if request.User != nil {
+		user = request.User.Id
+		answer.Moderator = isPollAdmin(ctx, pollInfo.Id, user)
+	}
+
+	const qList = `
+	  SELECT c.Id, c.Alternative, c.Parent, IF(c.Deleted, '', IFNULL(u.Name, '')), c.Author = ?,
+	         c.Content, c.Deleted, c.Created, c.Edited
+	    FROM Comments AS c JOIN Users AS u ON c.Author = u.Id
+	   WHERE c.Poll = ?
+	   ORDER BY c.Id ASC`
+	rows, err := db.DB.QueryContext(ctx, qList, user, pollInfo.Id)
+	must(err)
+	defer rows.Close()
+
+	answer.Comments = make([]CommentEntry, 0, 4)
+	for rows.Next() {
+		var entry CommentEntry
+		var alternative sql.NullInt32
+		var parent sql.NullInt64
+		var edited sql.NullTime
+		must(rows.Scan(&entry.Id, &alternative, &parent, &entry.Author, &entry.Own, &entry.Content,
+			&entry.Deleted, &entry.Created, &edited))
+		if alternative.Valid {
+			value := uint8(alternative.Int32)
+			entry.Alternative = &value
+		}
+		entry.Parent = uint32(parent.Int64)
+		if edited.Valid {
+			entry.Edited = &edited.Time
+		}
+		answer.Comments = append(answer.Comments, entry)
+	}
+	must(rows.Err())
+
+	response.SendJSON(ctx, answer)
+}
+
+//
+// CommentPostHandler
+//
+
+type commentPostHandler struct {
+	evtManager events.Manager
+}
+
+// CommentPostHandler adds a comment on a poll, or a reply to a comment. Only the participants and
+// the administrator of the poll can post comments.
+func CommentPostHandler(evtManager events.Manager) commentPostHandler {
+	return commentPostHandler{evtManager: evtManager}
+}
+
+func (self commentPostHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, query := checkCommentRequest(ctx, request)
+	if !pollInfo.Participate && !isPollAdmin(ctx, pollInfo.Id, request.User.Id) {
+		panic(server.NewHttpError(http.StatusForbidden, "Not a participant",
+			"Only participants can comment"))
+	}
+
+	content, err := commentContent(query.Content)
+	if err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	var alternative sql.NullInt32
+	var parent sql.NullInt64
+	if query.Parent != 0 {
+		const qParent = `SELECT Alternative FROM Comments WHERE Id = ? AND Poll = ? AND NOT Deleted`
+		err := db.DB.QueryRowContext(ctx, qParent, query.Parent, pollInfo.Id).Scan(&alternative)
+		if errors.Is(err, sql.ErrNoRows) {
+			panic(noCommentError("Parent not found"))
+		}
+		must(err)
+		parent = sql.NullInt64{Int64: int64(query.Parent), Valid: true}
+	} else if query.Alternative != nil {
+		if *query.Alternative >= pollInfo.NbChoices {
+			panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Wrong alternative"))
+		}
+		alternative = sql.NullInt32{Int32: int32(*query.Alternative), Valid: true}
+	}
+
+	const qInsert = `
+	  INSERT INTO Comments (Poll, Alternative, Parent, Author, Content)
+	  VALUE (?, ?, ?, ?, ?)`
+	result, err := db.DB.ExecContext(ctx, qInsert, pollInfo.Id, alternative, parent,
+		request.User.Id, content)
+	must(err)
+	id, err := result.LastInsertId()
+	must(err)
+
+	self.evtManager.Send(services.CommentEvent{
+		Poll:    pollInfo.Id,
+		Comment: uint32(id),
+		User:    request.User.Id,
+		Action:  services.CommentPosted,
+	})
+	response.SendJSON(ctx, CommentAnswer{Id: uint32(id)})
+}
+
+//
+// CommentEditHandler
+//
+
+type commentEditHandler struct {
+	evtManager events.Manager
+}
+
+// CommentEditHandler modifies the content of a comment. Only the author can edit a comment.
+func CommentEditHandler(evtManager events.Manager) commentEditHandler {
+	return commentEditHandler{evtManager: evtManager}
+}
+
+func (self commentEditHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, query := checkCommentRequest(ctx, request)
+	if commentAuthor(ctx, pollInfo.Id, query.Id) != request.User.Id {
+		panic(server.NewHttpError(http.StatusForbidden, "Not the author",
+			"Only the author can edit a comment"))
+	}
+
+	content, err := commentContent(query.Content)
+	if err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	const qEdit = `UPDATE Comments SET Content = ?, Edited = CURRENT_TIMESTAMP WHERE Id = ?`
+	_, err = db.DB.ExecContext(ctx, qEdit, content, query.Id)
+	must(err)
+
+	self.evtManager.Send(services.CommentEvent{
+		Poll:    pollInfo.Id,
+		Comment: query.Id,
+		User:    request.User.Id,
+		Action:  services.CommentEdited,
+	})
+	response.SendJSON(ctx, "Ok")
+}
+
+//
+// CommentDeleteHandler
+//
+
+type commentDeleteHandler struct {
+	evtManager events.Manager
+}
+
+// CommentDeleteHandler deletes a comment. Comments can be deleted by their author and by the
+// administrator of the poll. The replies to a deleted comment are kept.
+func CommentDeleteHandler(evtManager events.Manager) commentDeleteHandler {
+	return commentDeleteHandler{evtManager: evtManager}
+}
+
+func (self commentDeleteHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, query := checkCommentRequest(ctx, request)
+	if commentAuthor(ctx, pollInfo.Id, query.Id) != request.User.Id &&
+		!isPollAdmin(ctx, pollInfo.Id, request.User.Id) {
+		panic(server.NewHttpError(http.StatusForbidden, "Not the author",
+			"Only the author and the administrator can delete a comment"))
+	}
+
+	const qDelete = `UPDATE Comments SET Content = '', Deleted = TRUE WHERE Id = ?`
+	_, err := db.DB.ExecContext(ctx, qDelete, query.Id)
+	must(err)
+
+	self.evtManager.Send(services.CommentEvent{
+		Poll:    pollInfo.Id,
+		Comment: query.Id,
+		User:    request.User.Id,
+		Action:  services.CommentDeleted,
+	})
+	response.SendJSON(ctx, "Ok")
+}
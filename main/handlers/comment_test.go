@@ -0,0 +1,245 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/events/eventstest"
+)
+
+func TestCommentContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		expect  string
+		err     error
+	}{
+		{name: "Simple", content: "Hello", expect: "Hello"},
+		{name: "Trimmed", content: "  Hello\n", expect: "Hello"},
+		{name: "Empty", content: " \n\t", err: errCommentEmpty},
+		{name: "Longest", content: strings.Repeat("é", CommentMaxLength),
+			expect: strings.Repeat("é", CommentMaxLength)},
+		{name: "Too long", content: strings.Repeat("a", CommentMaxLength+1), err: errCommentTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commentContent(tt.content)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Wrong error. Got %v. Expect %v.", err, tt.err)
+			}
+			if got != tt.expect {
+				t.Errorf("Got %q. Expect %q.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestCommentHandlers(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	adminId := env.CreateUserWith(t.Name() + "Admin")
+	partId := env.CreateUserWith(t.Name() + "Part")
+	partName := dbt.UserNameWith(t.Name() + "Part")
+	alienId := env.CreateUserWith(t.Name() + "Alien")
+	pollId := env.CreatePoll("Comments", adminId, db.ElectorateAll)
+	env.Vote(pollId, 0, partId, 0)
+	env.Must(t)
+
+	var recorded []services.CommentEvent
+	evtManager := &eventstest.ManagerMock{
+		T: t,
+		Send_: func(evt events.Event) error {
+			if converted, ok := evt.(services.CommentEvent); ok {
+				recorded = append(recorded, converted)
+			}
+			return nil
+		},
+	}
+	postHandler := func() server.Handler { return CommentPostHandler(evtManager) }
+	editHandler := func() server.Handler { return CommentEditHandler(evtManager) }
+	deleteHandler := func() server.Handler { return CommentDeleteHandler(evtManager) }
+
+	makeRequest := func(user *uint32, query CommentQuery) srvt.Request {
+		encoded, err := json.Marshal(query)
+		mustt(t, err)
+		request := makePollRequest(t, pollId, user)
+		request.Method = "POST"
+		request.Body = string(encoded)
+		return *request
+	}
+
+	var ids []uint32
+	postChecker := srvt.CheckerFun(func(t *testing.T, response *http.Response,
+		request *server.Request) {
+
+		srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+		var answer CommentAnswer
+		mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+		ids = append(ids, answer.Id)
+	})
+	alternative := uint8(1)
+	wrongAlternative := uint8(2)
+
+	t.Run("Post", func(t *testing.T) {
+		srvt.Run(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: makeRequest(nil, CommentQuery{Content: "Hello"}),
+				Checker: srvt.CheckStatus{Code: http.StatusForbidden},
+			},
+			&srvt.T{
+				Name:    "Alien",
+				Request: makeRequest(&alienId, CommentQuery{Content: "Hello"}),
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: "Not a participant"},
+			},
+			&srvt.T{
+				Name:    "Empty",
+				Request: makeRequest(&partId, CommentQuery{Content: "  "}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+			&srvt.T{
+				Name:    "Wrong alternative",
+				Request: makeRequest(&partId, CommentQuery{Content: "Hi", Alternative: &wrongAlternative}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+			&srvt.T{
+				Name:    "Wrong parent",
+				Request: makeRequest(&partId, CommentQuery{Content: "Hi", Parent: 1 << 30}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No comment"},
+			},
+			&srvt.T{
+				Name:    "Poll",
+				Request: makeRequest(&partId, CommentQuery{Content: "On the poll"}),
+				Checker: postChecker,
+			},
+			&srvt.T{
+				Name:    "Alternative",
+				Request: makeRequest(&adminId, CommentQuery{Content: "On Yes", Alternative: &alternative}),
+				Checker: postChecker,
+			},
+		}, postHandler)
+	})
+	if len(ids) != 2 {
+		t.Fatalf("Wrong number of comments. Got %d. Expect 2.", len(ids))
+	}
+
+	t.Run("Reply", func(t *testing.T) {
+		srvt.Run(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Reply",
+				Request: makeRequest(&partId, CommentQuery{Content: "Reply", Parent: ids[1]}),
+				Checker: postChecker,
+			},
+		}, postHandler)
+	})
+	if len(ids) != 3 {
+		t.Fatalf("Wrong number of comments. Got %d. Expect 3.", len(ids))
+	}
+
+	t.Run("Edit", func(t *testing.T) {
+		srvt.Run(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Not author",
+				Request: makeRequest(&adminId, CommentQuery{Id: ids[0], Content: "Edited"}),
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: "Not the author"},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: makeRequest(&partId, CommentQuery{Id: ids[0], Content: "Edited"}),
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+		}, editHandler)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		srvt.Run(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Not author",
+				Request: makeRequest(&alienId, CommentQuery{Id: ids[0]}),
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: "Not the author"},
+			},
+			&srvt.T{
+				Name:    "Moderation",
+				Request: makeRequest(&adminId, CommentQuery{Id: ids[2]}),
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+			&srvt.T{
+				Name:    "Already deleted",
+				Request: makeRequest(&adminId, CommentQuery{Id: ids[2]}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No comment"},
+			},
+		}, deleteHandler)
+	})
+
+	expectActions := []services.CommentAction{services.CommentPosted, services.CommentPosted,
+		services.CommentPosted, services.CommentEdited, services.CommentDeleted}
+	if len(recorded) != len(expectActions) {
+		t.Fatalf("Wrong number of events. Got %d. Expect %d.", len(recorded), len(expectActions))
+	}
+	for i, evt := range recorded {
+		if evt.Poll != pollId || evt.Action != expectActions[i] {
+			t.Errorf("Wrong event %d. Got %v.", i, evt)
+		}
+	}
+
+	listRequest := *makePollRequest(t, pollId, &partId)
+	srvt.RunFunc(t, []srvt.Test{
+		&srvt.T{
+			Name:    "List",
+			Request: listRequest,
+			Checker: srvt.CheckerFun(func(t *testing.T, response *http.Response,
+				request *server.Request) {
+
+				srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+				var answer CommentListAnswer
+				mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+				if answer.Moderator {
+					t.Errorf("Participant is moderator.")
+				}
+				if len(answer.Comments) != 3 {
+					t.Fatalf("Wrong number of comments. Got %d. Expect 3.", len(answer.Comments))
+				}
+				first, second, third := answer.Comments[0], answer.Comments[1], answer.Comments[2]
+				if first.Content != "Edited" || !first.Own || first.Edited == nil ||
+					first.Alternative != nil || first.Author != partName {
+					t.Errorf("Wrong first comment %v.", first)
+				}
+				if second.Content != "On Yes" || second.Own || second.Alternative == nil ||
+					*second.Alternative != alternative {
+					t.Errorf("Wrong second comment %v.", second)
+				}
+				if !third.Deleted || third.Content != "" || third.Author != "" ||
+					third.Parent != ids[1] || third.Alternative == nil {
+					t.Errorf("Wrong third comment %v.", third)
+				}
+			}),
+		},
+	}, CommentListHandler)
+}
@@ -18,6 +18,7 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
 
 	"github.com/JBoudou/Itero/mid/db"
@@ -27,12 +28,15 @@ import (
 
 type ConfirmAnswer struct {
 	Type db.ConfirmationType
+	Poll string `json:",omitempty"` // Segment of the poll, for invitations.
 }
 
 type confirmHandler struct {
 }
 
 // ConfirmHandler handles confirmations.
+// Invitation confirmations are not deleted, and open an unlogged session for the pseudo-user bound
+// to the invitation.
 func ConfirmHandler() confirmHandler {
 	return confirmHandler{}
 }
@@ -67,6 +71,9 @@ func (self confirmHandler) Handle(ctx context.Context, response server.Response,
 		delConfirm, err = self.verify(ctx, uid)
 	case db.ConfirmationTypePasswd:
 		delConfirm = false
+	case db.ConfirmationTypeInvite:
+		answer.Poll, err = self.invite(ctx, response, request, uid)
+		delConfirm = false
 	}
 	must(err)
 
@@ -84,3 +91,25 @@ func (self confirmHandler) verify(ctx context.Context, uid uint32) (bool, error)
 	_, err := db.DB.ExecContext(ctx, qUpdate, uid)
 	return true, err
 }
+
+func (self confirmHandler) invite(ctx context.Context, response server.Response,
+	request *server.Request, uid uint32) (poll string, err error) {
+
+	const qPoll = `
+	  SELECT p.Id, p.Salt FROM Invitations AS i JOIN Polls AS p ON i.Poll = p.Id WHERE i.User = ?`
+	var segment salted.Segment
+	err = db.DB.QueryRowContext(ctx, qPoll, uid).Scan(&segment.Id, &segment.Salt)
+	if err == sql.ErrNoRows {
+		err = server.NewHttpError(http.StatusNotFound, "Not found", "No invitation")
+	}
+	if err != nil {
+		return
+	}
+	poll, err = segment.Encode()
+	if err != nil {
+		return
+	}
+
+	err = response.SendUnloggedId(ctx, server.User{Id: uid, Logged: false}, request)
+	return
+}
@@ -0,0 +1,305 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/outcome"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// controlledPoll is the state of a poll, as seen by the administrator controlling it.
+type controlledPoll struct {
+	Id           uint32
+	State        db.State
+	Electorate   db.Electorate
+	CurrentRound uint8
+	MinNbRounds  uint8
+	MaxNbRounds  sql.NullInt32
+	Deadline     sql.NullTime
+}
+
+// LastRoundOver reports whether the maximal number of rounds has been reached, such that no new
+// round can be started.
+func (self controlledPoll) LastRoundOver() bool {
+	return self.MaxNbRounds.Valid && int32(self.CurrentRound) >= self.MaxNbRounds.Int32
+}
+
+func lastRoundOverError() server.HttpError {
+	return server.NewHttpError(http.StatusConflict, "Last round over",
+		"The maximal number of rounds has been reached")
+}
+
+// controlPoll calls update inside a transaction, after having checked that the user is the
+// administrator of the poll and that the state of the poll is one of states.
+// Errors are sent by panic.
+func controlPoll(ctx context.Context, request *server.Request, states []db.State,
+	update func(tx *sql.Tx, poll controlledPoll)) (poll controlledPoll) {
+
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	segment, err := salted.FromRequest(request)
+	must(err)
+
+	const qCheck = `
+	  SELECT Salt, Admin, State, Electorate, CurrentRound, MinNbRounds, MaxNbRounds, Deadline
+	    FROM Polls
+	   WHERE Id = ?
+	     FOR UPDATE`
+
+	db.RepeatDeadlocked(slog.CtxLoadLogger(ctx), ctx, nil, func(tx *sql.Tx) {
+		rows, err := tx.QueryContext(ctx, qCheck, segment.Id)
+		must(err)
+		defer rows.Close()
+		if !rows.Next() {
+			panic(noPollError("No such Id"))
+		}
+
+		var salt, admin uint32
+		poll = controlledPoll{Id: segment.Id}
+		must(rows.Scan(&salt, &admin, &poll.State, &poll.Electorate, &poll.CurrentRound,
+			&poll.MinNbRounds, &poll.MaxNbRounds, &poll.Deadline))
+		rows.Close()
+		if salt != segment.Salt {
+			panic(noPollError("Wrong salt"))
+		}
+		if admin != request.User.Id {
+			panic(server.UnauthorizedHttpError("Not admin"))
+		}
+
+		allowed := false
+		for _, state := range states {
+			allowed = allowed || poll.State == state
+		}
+		if !allowed {
+			panic(server.NewHttpError(http.StatusLocked, "Wrong state", "Not allowed in state "+
+				string(poll.State)))
+		}
+
+		update(tx, poll)
+	})
+	return
+}
+
+// execOne executes a query that must change exactly one row.
+// Errors are sent by panic.
+func execOne(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	must(err)
+	affected, err := result.RowsAffected()
+	must(err)
+	if affected != 1 {
+		panic(server.NewHttpError(http.StatusInternalServerError, server.InternalHttpErrorMsg,
+			"The request did not change one row"))
+	}
+}
+
+//
+// PauseHandler
+//
+
+type pauseHandler struct {
+	evtManager events.Manager
+}
+
+// PauseHandler suspends an active poll. Participants cannot vote in a paused poll and its rounds do
+// not end.
+func PauseHandler(evtManager events.Manager) pauseHandler {
+	return pauseHandler{evtManager: evtManager}
+}
+
+func (self pauseHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const qPause = `UPDATE Polls SET State = 'Paused' WHERE Id = ?`
+
+	poll := controlPoll(ctx, request, []db.State{db.StateActive},
+		func(tx *sql.Tx, poll controlledPoll) {
+			execOne(ctx, tx, qPause, poll.Id)
+		})
+
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.PausePollEvent{Poll: poll.Id})
+}
+
+//
+// ResumeHandler
+//
+
+type resumeHandler struct {
+	evtManager events.Manager
+}
+
+// ResumeHandler reactivates a paused poll. The current round restarts from the beginning.
+func ResumeHandler(evtManager events.Manager) resumeHandler {
+	return resumeHandler{evtManager: evtManager}
+}
+
+func (self resumeHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const qResume = `
+	  UPDATE Polls SET State = 'Active', CurrentRoundStart = CURRENT_TIMESTAMP WHERE Id = ?`
+
+	poll := controlPoll(ctx, request, []db.State{db.StatePaused},
+		func(tx *sql.Tx, poll controlledPoll) {
+			execOne(ctx, tx, qResume, poll.Id)
+		})
+
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.ResumePollEvent{Poll: poll.Id})
+}
+
+//
+// ExtendHandler
+//
+
+// ExtendQuery is the query for ExtendHandler. Zero values are for unchanged parameters.
+type ExtendQuery struct {
+	Deadline    time.Time
+	MaxNbRounds uint8
+}
+
+type extendHandler struct {
+	evtManager events.Manager
+}
+
+// ExtendHandler postpones the deadline of a poll, or increases its maximal number of rounds.
+// Both parameters can only be extended. A missing deadline or maximal number of rounds is
+// unlimited, hence cannot be extended. The new maximal number of rounds must be greater than the
+// current round and at least the minimal number of rounds.
+func ExtendHandler(evtManager events.Manager) extendHandler {
+	return extendHandler{evtManager: evtManager}
+}
+
+func (self extendHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	var query ExtendQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if query.Deadline.IsZero() && query.MaxNbRounds == 0 {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Nothing to extend"))
+	}
+	if !query.Deadline.IsZero() && !query.Deadline.After(time.Now()) {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Deadline must be after now"))
+	}
+
+	const qExtend = `UPDATE Polls SET Deadline = ?, MaxNbRounds = ? WHERE Id = ?`
+
+	states := []db.State{db.StateWaiting, db.StateActive, db.StatePaused}
+	poll := controlPoll(ctx, request, states, func(tx *sql.Tx, poll controlledPoll) {
+		deadline := poll.Deadline
+		if !query.Deadline.IsZero() {
+			if !deadline.Valid || !query.Deadline.After(deadline.Time) {
+				panic(server.NewHttpError(http.StatusBadRequest, "Bad request",
+					"Deadline can only be postponed"))
+			}
+			deadline = sql.NullTime{Time: query.Deadline, Valid: true}
+		}
+
+		maxNbRounds := poll.MaxNbRounds
+		if query.MaxNbRounds != 0 {
+			if !maxNbRounds.Valid || int32(query.MaxNbRounds) <= maxNbRounds.Int32 {
+				panic(server.NewHttpError(http.StatusBadRequest, "Bad request",
+					"MaxNbRounds can only be increased"))
+			}
+			if query.MaxNbRounds <= poll.CurrentRound || query.MaxNbRounds < poll.MinNbRounds {
+				panic(server.NewHttpError(http.StatusBadRequest, "Bad request",
+					"MaxNbRounds must be greater than CurrentRound and at least MinNbRounds"))
+			}
+			maxNbRounds = sql.NullInt32{Int32: int32(query.MaxNbRounds), Valid: true}
+		}
+
+		execOne(ctx, tx, qExtend, deadline, maxNbRounds, poll.Id)
+	})
+
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.ExtendPollEvent{Poll: poll.Id})
+}
+
+//
+// AdvanceHandler
+//
+
+type advanceHandler struct {
+	evtManager events.Manager
+}
+
+// AdvanceHandler ends the current round of an active poll immediately.
+func AdvanceHandler(evtManager events.Manager) advanceHandler {
+	return advanceHandler{evtManager: evtManager}
+}
+
+func (self advanceHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const qAdvance = `UPDATE Polls SET CurrentRound = CurrentRound + 1 WHERE Id = ?`
+
+	poll := controlPoll(ctx, request, []db.State{db.StateActive},
+		func(tx *sql.Tx, poll controlledPoll) {
+			if poll.LastRoundOver() {
+				panic(lastRoundOverError())
+			}
+			execOne(ctx, tx, qAdvance, poll.Id)
+		})
+
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.NextRoundEvent{Poll: poll.Id, Round: poll.CurrentRound + 1})
+}
+
+//
+// CloseHandler
+//
+
+type closeHandler struct {
+	evtManager events.Manager
+}
+
+// CloseHandler terminates an active or paused poll immediately. The current round is considered
+// complete, and its outcome is the outcome of the poll.
+func CloseHandler(evtManager events.Manager) closeHandler {
+	return closeHandler{evtManager: evtManager}
+}
+
+func (self closeHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const qClose = `
+	  UPDATE Polls SET State = 'Terminated', CurrentRound = CurrentRound + 1 WHERE Id = ?`
+
+	poll := controlPoll(ctx, request, []db.State{db.StateActive, db.StatePaused},
+		func(tx *sql.Tx, poll controlledPoll) {
+			if poll.LastRoundOver() {
+				panic(lastRoundOverError())
+			}
+			execOne(ctx, tx, qClose, poll.Id)
+		})
+
+	response.SendJSON(ctx, "Ok")
+
+	// Errors are only logged because the poll is already closed.
+	var winners []uint8
+	result, err := outcome.Compute(ctx, poll.Id, poll.CurrentRound)
+	if err == nil {
+		winners = result.Winners
+	} else {
+		slog.CtxLogf(ctx, "Error computing outcome of poll %d: %v", poll.Id, err)
+	}
+	self.evtManager.Send(services.ClosePollEvent{Poll: poll.Id, Winners: winners})
+}
@@ -0,0 +1,268 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+var controlTestRequest = srvt.Request{Method: "POST"}
+
+func controlTestChecker(state db.State, round uint8, maxNbRounds uint8) pollTestCheckerFactory {
+	return func(param PollTestCheckerFactoryParam) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+			const qCheck = `SELECT State, CurrentRound, MaxNbRounds FROM Polls WHERE Id = ?`
+			var gotState db.State
+			var gotRound, gotMax uint8
+			mustt(t, db.DB.QueryRow(qCheck, param.PollId).Scan(&gotState, &gotRound, &gotMax))
+			if gotState != state {
+				t.Errorf("Wrong state. Got %s. Expect %s.", gotState, state)
+			}
+			if gotRound != round {
+				t.Errorf("Wrong round. Got %d. Expect %d.", gotRound, round)
+			}
+			if gotMax != maxNbRounds {
+				t.Errorf("Wrong MaxNbRounds. Got %d. Expect %d.", gotMax, maxNbRounds)
+			}
+		})
+	}
+}
+
+func controlTestEventPredicate(expect func(id uint32) events.Event) func(
+	PollTestCheckerFactoryParam, events.Event) bool {
+
+	return func(param PollTestCheckerFactoryParam, evt events.Event) bool {
+		return reflect.DeepEqual(evt, expect(param.PollId))
+	}
+}
+
+func TestPauseHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	predicate := controlTestEventPredicate(func(id uint32) events.Event {
+		return services.PausePollEvent{Poll: id}
+	})
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Not logged",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeNone,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckStatus{Code: http.StatusForbidden},
+		},
+		&pollTest{
+			Name:       "Not admin",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeLogged,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+		&pollTest{
+			Name:       "Waiting",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Wrong state"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        controlTestRequest,
+			Checker:        controlTestChecker(db.StatePaused, 0, dbt.PollMaxNbRounds),
+			EventPredicate: predicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, PauseHandler)
+}
+
+func TestResumeHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	predicate := controlTestEventPredicate(func(id uint32) events.Event {
+		return services.ResumePollEvent{Poll: id}
+	})
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Not paused",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Wrong state"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			Paused:         true,
+			Round:          1,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        controlTestRequest,
+			Checker:        controlTestChecker(db.StateActive, 1, dbt.PollMaxNbRounds),
+			EventPredicate: predicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, ResumeHandler)
+}
+
+func TestExtendHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	makeRequest := func(query ExtendQuery) srvt.Request {
+		body, err := json.Marshal(query)
+		mustt(t, err)
+		return srvt.Request{Method: "POST", Body: string(body)}
+	}
+	predicate := controlTestEventPredicate(func(id uint32) events.Event {
+		return services.ExtendPollEvent{Poll: id}
+	})
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Nothing",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    makeRequest(ExtendQuery{}),
+			Checker:    srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&pollTest{
+			Name:       "Past deadline",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    makeRequest(ExtendQuery{Deadline: time.Now().Add(-time.Hour)}),
+			Checker:    srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&pollTest{
+			Name:       "Fewer rounds",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    makeRequest(ExtendQuery{MaxNbRounds: dbt.PollMaxNbRounds}),
+			Checker:    srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&pollTest{
+			Name:           "More rounds",
+			Electorate:     db.ElectorateAll,
+			Paused:         true,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        makeRequest(ExtendQuery{MaxNbRounds: dbt.PollMaxNbRounds + 2}),
+			Checker:        controlTestChecker(db.StatePaused, 0, dbt.PollMaxNbRounds+2),
+			EventPredicate: predicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, ExtendHandler)
+}
+
+func TestAdvanceHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	predicate := controlTestEventPredicate(func(id uint32) events.Event {
+		return services.NextRoundEvent{Poll: id, Round: 2}
+	})
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Paused",
+			Electorate: db.ElectorateAll,
+			Paused:     true,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Wrong state"},
+		},
+		&pollTest{
+			Name:       "Last round",
+			Electorate: db.ElectorateAll,
+			Round:      dbt.PollMaxNbRounds,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusConflict, Body: "Last round over"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			Round:          1,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        controlTestRequest,
+			Checker:        controlTestChecker(db.StateActive, 2, dbt.PollMaxNbRounds),
+			EventPredicate: predicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, AdvanceHandler)
+}
+
+func TestCloseHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	predicate := controlTestEventPredicate(func(id uint32) events.Event {
+		return services.ClosePollEvent{Poll: id, Winners: []uint8{1}}
+	})
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Waiting",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Wrong state"},
+		},
+		&pollTest{
+			Name:       "Last round",
+			Electorate: db.ElectorateAll,
+			Round:      dbt.PollMaxNbRounds,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    controlTestRequest,
+			Checker:    srvt.CheckError{Code: http.StatusConflict, Body: "Last round over"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			Alternatives:   []string{"Ham", "Stram", "Gram"},
+			Round:          1,
+			Vote:           []pollTestVote{{2, 1, 1}, {3, 1, 1}, {4, 1, 0}},
+			UserType:       pollTestUserTypeAdmin,
+			Request:        controlTestRequest,
+			Checker:        controlTestChecker(db.StateTerminated, 2, dbt.PollMaxNbRounds),
+			EventPredicate: predicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, CloseHandler)
+}
@@ -18,11 +18,11 @@ package handlers
 
 import (
 	"context"
-	"net/http"
 	"strconv"
 
-	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/outcome"
 	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/rules"
 )
 
 type CountInfoEntry struct {
@@ -46,72 +46,23 @@ func getPollRoundFromRequest(request *server.Request, fallback uint8) uint8 {
 }
 
 // CountInfoEntry sends the plurality result of a previous round.
+// For ranked ballots, only the preferred alternatives are counted. Ballots are weighted by
+// delegations.
 func CountInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
-	pollInfo, err := checkPollAccess(ctx, request)
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeCounts)
+
+	profile, err := outcome.LoadProfile(ctx, pollInfo.Id, round)
 	must(err)
+	result := rules.Plurality{}.Outcome(profile)
 
-	// Get the round to return results of.
-	round := getPollRoundFromRequest(request, pollInfo.CurrentRound - 1)
-	if round >= pollInfo.CurrentRound {
-		err = server.NewHttpError(http.StatusBadRequest, "Protocol error", "No result for this round")
-		response.SendError(ctx, err)
-		return
-	}
+	var alternatives []PollAlternative
+	allAlternatives(ctx, pollInfo, &alternatives)
 
 	var answer CountInfoAnswer
-	answer.Result = make([]CountInfoEntry, pollInfo.NbChoices)
-
-	const (
-		qReport = `SELECT ReportVote FROM Polls WHERE Id = ?`
-		qCountAbstain = `
-		  SELECT a.Id, a.Name, a.Cost, IFNULL(b.Count,0)
-		    FROM (
-		          SELECT *
-		            FROM Alternatives
-		           WHERE Poll = ?
-		         ) AS a LEFT JOIN (
-		           SELECT Poll, Alternative as Id, COUNT(*) as Count
-		             FROM Ballots
-		            WHERE Round = ?
-		            GROUP BY Poll, Alternative
-		         ) AS b ON (a.Poll, a.Id) = (b.Poll, b.Id)
-		   ORDER BY b.Count DESC, a.Id ASC`
-		qCountReport = `
-		  SELECT a.Id, a.Name, a.Cost, IFNULL(b.Count,0)
-		    FROM (
-		          SELECT *
-		            FROM Alternatives
-		           WHERE Poll = ?
-		         ) AS a LEFT JOIN (
-		           SELECT b.Poll, b.Alternative as Id, COUNT(*) as Count
-		             FROM Ballots AS b JOIN (
-		                    SELECT User, Poll, MAX(Round) as M
-		                      FROM Participants
-		                     WHERE Round <= ?
-		                     GROUP BY User, Poll
-		             ) AS c ON (b.User, b.Poll, b.Round) = (c.User, c.Poll, c.M)
-		            GROUP BY b.Poll, b.Alternative
-		         ) AS b ON (a.Poll, a.Id) = (b.Poll, b.Id)
-		   ORDER BY b.Count DESC, a.Id ASC`
-	)
-
-	row := db.DB.QueryRowContext(ctx, qReport, pollInfo.Id)
-	var reportVote bool
-	must(row.Scan(&reportVote))
-	var query string
-	if reportVote {
-		query = qCountReport
-	} else {
-		query = qCountAbstain
-	}
-
-	rows, err := db.DB.QueryContext(ctx, query, pollInfo.Id, round)
-	must(err)
-	for i := 0; rows.Next(); i++ {
-		must(rows.Scan(&answer.Result[i].Alternative.Id,
-			&answer.Result[i].Alternative.Name,
-			&answer.Result[i].Alternative.Cost,
-			&answer.Result[i].Count))
+	answer.Result = make([]CountInfoEntry, len(result.Ranking))
+	for i, alt := range result.Ranking {
+		answer.Result[i].Alternative = alternatives[alt]
+		answer.Result[i].Count = uint32(result.Scores[alt])
 	}
 
 	response.SendJSON(ctx, answer)
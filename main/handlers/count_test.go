@@ -173,6 +173,16 @@ func TestCountInfoHandler(t *testing.T) {
 			Round:        1,
 			Checker:      makeChecker([][2]uint32{{0, 2}, {2, 1}, {1, 0}}),
 		},
+		&pollTest{
+			Name:         "Hidden counts",
+			Electorate:   db.ElectorateAll,
+			Alternatives: alt,
+			Information:  db.InformationRanking,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         []pollTestVote{{2, 0, 0}, {3, 0, 0}, {4, 0, 2}},
+			Round:        1,
+			Checker:      srvt.CheckError{Code: http.StatusForbidden, Body: "Hidden information"},
+		},
 		&pollTest{
 			Name:         "No user hidden",
 			Electorate:   db.ElectorateAll,
@@ -38,6 +38,7 @@ const (
 	CreatePollElectorateAll CreatePollElectorate = iota - 1
 	CreatePollElectorateLogged
 	CreatePollElectorateVerified
+	CreatePollElectorateInvited
 )
 
 func (self CreatePollElectorate) ToDB() db.Electorate {
@@ -46,43 +47,168 @@ func (self CreatePollElectorate) ToDB() db.Electorate {
 		return db.ElectorateAll
 	case CreatePollElectorateVerified:
 		return db.ElectorateVerified
+	case CreatePollElectorateInvited:
+		return db.ElectorateInvited
 	default:
 		return db.ElectorateLogged
 	}
 }
 
+// CreatePollRule is the voting rule used to compute the outcome of the poll.
+type CreatePollRule uint8
+
+const (
+	CreatePollRulePlurality CreatePollRule = iota
+	CreatePollRuleBorda
+	CreatePollRuleCopeland
+	CreatePollRuleSchulze
+	CreatePollRuleInstantRunoff
+	CreatePollRuleApproval
+	CreatePollRuleEqualShares
+)
+
+func (self CreatePollRule) ToDB() (ret uint8, ok bool) {
+	ok = true
+	switch self {
+	case CreatePollRulePlurality:
+		ret = db.PollRulePlurality
+	case CreatePollRuleBorda:
+		ret = db.PollRuleBorda
+	case CreatePollRuleCopeland:
+		ret = db.PollRuleCopeland
+	case CreatePollRuleSchulze:
+		ret = db.PollRuleSchulze
+	case CreatePollRuleInstantRunoff:
+		ret = db.PollRuleInstantRunoff
+	case CreatePollRuleApproval:
+		ret = db.PollRuleApproval
+	case CreatePollRuleEqualShares:
+		ret = db.PollRuleEqualShares
+	default:
+		ok = false
+	}
+	return
+}
+
+// CreatePollRoundType tells how participants move during rounds.
+type CreatePollRoundType uint8
+
+const (
+	CreatePollRoundTypeFreelyAsynchronous CreatePollRoundType = iota
+	CreatePollRoundTypeSynchronous
+	CreatePollRoundTypeOneMove
+)
+
+func (self CreatePollRoundType) ToDB() (ret uint8, ok bool) {
+	ok = true
+	switch self {
+	case CreatePollRoundTypeFreelyAsynchronous:
+		ret = db.RoundTypeFreelyAsynchronous
+	case CreatePollRoundTypeSynchronous:
+		ret = db.RoundTypeSynchronous
+	case CreatePollRoundTypeOneMove:
+		ret = db.RoundTypeOneMove
+	default:
+		ok = false
+	}
+	return
+}
+
+// CreatePollInformation is the information given to participants about previous rounds.
+type CreatePollInformation uint8
+
+const (
+	CreatePollInformationNone CreatePollInformation = iota
+	CreatePollInformationWinner
+	CreatePollInformationRanking
+	CreatePollInformationCounts
+	CreatePollInformationMatrix
+	CreatePollInformationTrends
+)
+
+func (self CreatePollInformation) ToDB() (ret db.Information, ok bool) {
+	ok = true
+	switch self {
+	case CreatePollInformationNone:
+		ret = db.InformationNone
+	case CreatePollInformationWinner:
+		ret = db.InformationWinner
+	case CreatePollInformationRanking:
+		ret = db.InformationRanking
+	case CreatePollInformationCounts:
+		ret = db.InformationCounts
+	case CreatePollInformationMatrix:
+		ret = db.InformationMatrix
+	case CreatePollInformationTrends:
+		ret = db.InformationTrends
+	default:
+		ok = false
+	}
+	return
+}
+
 type SimpleAlternative struct {
 	Name string
 	Cost float64
 }
 
 type CreateQuery struct {
-	Title            string
-	Description      string
-	Hidden           bool
-	Electorate       CreatePollElectorate
-	Start            time.Time
-	Alternatives     []SimpleAlternative
-	ReportVote       bool
-	MinNbRounds      uint8
-	MaxNbRounds      uint8
-	Deadline         time.Time
-	MaxRoundDuration uint64 // milliseconds
-	RoundThreshold   float64
-	ShortURL         string
+	Title             string
+	Description       string
+	Hidden            bool
+	Electorate        CreatePollElectorate
+	Start             time.Time
+	Alternatives      []SimpleAlternative
+	Ranked            bool
+	Rule              CreatePollRule
+	MaxOutcomeCost    float64
+	MaxBallotCost     float64
+	BallotCostIsCount bool
+	RoundType         CreatePollRoundType
+	Information       CreatePollInformation
+	ReportVote        bool
+	MinNbRounds       uint8
+	MaxNbRounds       uint8
+	Deadline          time.Time
+	MaxRoundDuration  uint64 // milliseconds
+	RoundThreshold    float64
+	ShortURL          string
+	Template          string `json:",omitempty"` // Name of a template of the user to start from.
 }
 
 func defaultCreateQuery() CreateQuery {
 	return CreateQuery{
-		ReportVote:       true,
-		MinNbRounds:      2,
-		MaxNbRounds:      10,
-		Deadline:         time.Now().Add(7 * 24 * time.Hour),
-		MaxRoundDuration: 24 * 3600 * 1000,
-		RoundThreshold:   1.,
+		MaxOutcomeCost:    1.,
+		MaxBallotCost:     1.,
+		BallotCostIsCount: true,
+		Information:       CreatePollInformationCounts,
+		ReportVote:        true,
+		MinNbRounds:       2,
+		MaxNbRounds:       10,
+		Deadline:          time.Now().Add(7 * 24 * time.Hour),
+		MaxRoundDuration:  24 * 3600 * 1000,
+		RoundThreshold:    1.,
 	}
 }
 
+// readCreateQuery reads the CreateQuery of the request. If the query names a template of the user,
+// the values from the template replace the default ones, and are overridden by the values from the
+// request.
+// Errors are sent by panic.
+func readCreateQuery(ctx context.Context, request *server.Request) (query CreateQuery) {
+	query = defaultCreateQuery()
+	must(request.UnmarshalJSONBody(&query))
+	if query.Template == "" {
+		return
+	}
+
+	name := query.Template
+	query = defaultCreateQuery()
+	loadTemplate(ctx, request.User.Id, name, &query)
+	must(request.UnmarshalJSONBody(&query))
+	return
+}
+
 type createHandler struct {
 	evtManager events.Manager
 }
@@ -92,15 +218,22 @@ func CreateHandler(evtManager events.Manager) createHandler {
 	return createHandler{evtManager: evtManager}
 }
 
-func (self createHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
-	if request.User == nil || !request.User.Logged {
-		must(request.SessionError)
-		panic(server.UnauthorizedHttpError("Unlogged user"))
-	}
-	must(request.CheckPOST(ctx))
+// createPollValues are the values to store in the database, computed from a CreateQuery.
+type createPollValues struct {
+	state       string
+	start       sql.NullTime
+	electorate  db.Electorate
+	shortURL    sql.NullString
+	pollType    uint8
+	rule        uint8
+	roundType   uint8
+	information db.Information
+}
 
-	query := defaultCreateQuery()
-	must(request.UnmarshalJSONBody(&query))
+// checkCreateQuery verifies the query and computes the values to store in the database.
+// Errors are sent by panic.
+func checkCreateQuery(ctx context.Context, user uint32, query *CreateQuery) (
+	values createPollValues) {
 
 	if len(query.Title) < 1 {
 		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Missing title"))
@@ -109,25 +242,44 @@ func (self createHandler) Handle(ctx context.Context, response server.Response,
 		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Too few alternatives"))
 	}
 
+	// Costs
+	if query.MaxOutcomeCost <= 0 {
+		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "MaxOutcomeCost must be positive"))
+	}
+	if query.MaxBallotCost <= 0 {
+		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "MaxBallotCost must be positive"))
+	}
+	for _, alt := range query.Alternatives {
+		if alt.Cost < 0 {
+			must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Negative cost"))
+		}
+		if alt.Cost > query.MaxOutcomeCost {
+			must(server.NewHttpError(http.StatusBadRequest, "Bad request",
+				"Alternative cost exceeds MaxOutcomeCost"))
+		}
+		if !query.BallotCostIsCount && alt.Cost > query.MaxBallotCost {
+			must(server.NewHttpError(http.StatusBadRequest, "Bad request",
+				"Alternative cost exceeds MaxBallotCost"))
+		}
+	}
+
 	// Start
-	var start sql.NullTime
-	var state string
 	if query.Start.After(time.Now()) {
-		start.Time = query.Start
-		start.Valid = true
-		state = "Waiting"
+		values.start.Time = query.Start
+		values.start.Valid = true
+		values.state = "Waiting"
 	} else {
 		if !query.Start.IsZero() {
 			must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Start must be after now"))
 		}
-		state = "Active"
+		values.state = "Active"
 	}
 
 	// Electorate
-	electorate := query.Electorate.ToDB()
+	values.electorate = query.Electorate.ToDB()
 	const qVerified = `SELECT 1 FROM Users WHERE Id = ? AND Verified`
-	if electorate == db.ElectorateVerified {
-		rows, err := db.DB.QueryContext(ctx, qVerified, request.User.Id)
+	if values.electorate == db.ElectorateVerified {
+		rows, err := db.DB.QueryContext(ctx, qVerified, user)
 		must(err)
 		defer rows.Close()
 		if !rows.Next() {
@@ -136,27 +288,88 @@ func (self createHandler) Handle(ctx context.Context, response server.Response,
 	}
 
 	// ShortURL
-	var shortURL sql.NullString
 	if query.ShortURL != "" {
 		if len(query.ShortURL) < 6 {
 			panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "ShortURL is too short"))
 		}
 
-		shortURL.String = query.ShortURL
-		shortURL.Valid = true
+		values.shortURL.String = query.ShortURL
+		values.shortURL.Valid = true
+	}
+
+	// Type
+	values.pollType = db.PollTypeAcceptanceSet
+	if query.Ranked {
+		values.pollType = db.PollTypeRanked
+	}
+
+	// Rule
+	var ok bool
+	values.rule, ok = query.Rule.ToDB()
+	if !ok {
+		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Unknown rule"))
+	}
+
+	// RoundType
+	values.roundType, ok = query.RoundType.ToDB()
+	if !ok {
+		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Unknown round type"))
+	}
+
+	// Information
+	values.information, ok = query.Information.ToDB()
+	if !ok {
+		must(server.NewHttpError(http.StatusBadRequest, "Bad request", "Unknown information"))
+	}
+
+	return
+}
+
+// checkShortURLError converts err into a conflict error if it is due to an already existing
+// ShortURL. The returned error is err in all other cases.
+func checkShortURLError(ctx context.Context, tx *sql.Tx, err error, shortURL sql.NullString) error {
+	sqlError, ok := err.(*mysql.MySQLError)
+	if ok && sqlError.Number == 1062 && shortURL.Valid {
+		const qCheckShortURL = `SELECT 1 FROM Polls WHERE ShortURL = ?`
+		rows, tmpErr := tx.QueryContext(ctx, qCheckShortURL, shortURL)
+		must(tmpErr)
+		defer rows.Close()
+		if rows.Next() {
+			err = server.NewHttpError(http.StatusConflict, "ShortURL already exists", shortURL.String)
+		}
+	}
+	return err
+}
+
+// insertAlternatives adds the alternatives of the query to the poll.
+func insertAlternatives(ctx context.Context, tx *sql.Tx, poll uint32, query *CreateQuery) {
+	const qAlternative = `INSERT INTO Alternatives (Poll, Id, Name, Cost) VALUE (?, ?, ?, ?)`
+	for id, alt := range query.Alternatives {
+		_, err := tx.ExecContext(ctx, qAlternative, poll, id, alt.Name, alt.Cost)
+		must(err)
 	}
+}
+
+func (self createHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	if request.User == nil || !request.User.Logged {
+		must(request.SessionError)
+		panic(server.UnauthorizedHttpError("Unlogged user"))
+	}
+	must(request.CheckPOST(ctx))
+
+	query := readCreateQuery(ctx, request)
+	values := checkCreateQuery(ctx, request.User.Id, &query)
 
 	pollSegment, err := salted.New(0)
 	must(err)
 
 	const (
 		qPoll = `
-			INSERT INTO Polls (Title, Description, Admin, State, Start, ShortURL, Salt, Electorate, Hidden,
-			                   NbChoices, ReportVote, MinNbRounds, MaxNbRounds, Deadline, MaxRoundDuration,
-												 RoundThreshold)
-				  	 VALUE (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-		qAlternative = `INSERT INTO Alternatives (Poll, Id, Name) VALUE (?, ?, ?)`
-		qCheckShortURL = `SELECT 1 FROM Polls WHERE ShortURL = ?`
+			INSERT INTO Polls (Title, Description, Admin, State, Start, ShortURL, Salt, Type, Electorate,
+			                   Hidden, NbChoices, MaxOutcomeCost, MaxBallotCost, BallotCostIsCount, Rule,
+			                   RoundType, ReportVote, Information, MinNbRounds, MaxNbRounds, Deadline,
+			                   MaxRoundDuration, RoundThreshold)
+				  	 VALUE (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	)
 
 	db.RepeatDeadlocked(slog.CtxLoadLogger(ctx), ctx, nil, func(tx *sql.Tx) {
@@ -164,14 +377,21 @@ func (self createHandler) Handle(ctx context.Context, response server.Response,
 			query.Title,
 			query.Description,
 			request.User.Id,
-			state,
-			start,
-			shortURL,
+			values.state,
+			values.start,
+			values.shortURL,
 			pollSegment.Salt,
-			electorate,
+			values.pollType,
+			values.electorate,
 			query.Hidden,
 			len(query.Alternatives),
+			query.MaxOutcomeCost,
+			query.MaxBallotCost,
+			query.BallotCostIsCount,
+			values.rule,
+			values.roundType,
 			query.ReportVote,
+			values.information,
 			query.MinNbRounds,
 			query.MaxNbRounds,
 			query.Deadline,
@@ -179,24 +399,12 @@ func (self createHandler) Handle(ctx context.Context, response server.Response,
 			query.RoundThreshold,
 		)
 		if err != nil {
-			sqlError, ok := err.(*mysql.MySQLError)
-			if ok && sqlError.Number == 1062 && shortURL.Valid {
-				rows, tmpErr := tx.QueryContext(ctx, qCheckShortURL, shortURL)
-				must(tmpErr)
-				defer rows.Close()
-				if rows.Next() {
-					err = server.NewHttpError(http.StatusConflict, "ShortURL already exists", shortURL.String)
-				}
-			}
-			panic(err)
+			panic(checkShortURLError(ctx, tx, err, values.shortURL))
 		}
 		tmp, err := result.LastInsertId()
 		must(err)
 		pollSegment.Id = uint32(tmp)
-		for id, alt := range query.Alternatives {
-			_, err = tx.ExecContext(ctx, qAlternative, pollSegment.Id, id, alt.Name)
-			must(err)
-		}
+		insertAlternatives(ctx, tx, pollSegment.Id, &query)
 	})
 
 	segment, err := pollSegment.Encode()
@@ -104,10 +104,11 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 		qCheckPoll = `
 			SELECT Title, Description, Admin, State, Start, ShortURL, Salt, Electorate, Hidden, ReportVote,
 			       MinNbRounds, MaxNbRounds, Deadline, CurrentRoundStart,
-						 ADDTIME(CurrentRoundStart, MaxRoundDuration), RoundThreshold
+						 ADDTIME(CurrentRoundStart, MaxRoundDuration), RoundThreshold, MaxOutcomeCost, MaxBallotCost,
+						 BallotCostIsCount, Type, Rule, RoundType, Information
 			  FROM Polls
 			 WHERE Id = ?`
-		qCheckAlternative = `SELECT Name FROM Alternatives WHERE Poll = ? ORDER BY Id ASC`
+		qCheckAlternative = `SELECT Name, Cost FROM Alternatives WHERE Poll = ? ORDER BY Id ASC`
 		qCleanUp          = `DELETE FROM Polls WHERE Id = ?`
 	)
 
@@ -131,6 +132,8 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 	var shortURL sql.NullString
 	var electorate db.Electorate
 	var roundStart, roundEnd time.Time
+	var pollType, rule, roundType uint8
+	var information db.Information
 	mustt(t, row.Scan(
 		&got.Title,
 		&got.Description,
@@ -148,6 +151,13 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 		&roundStart,
 		&roundEnd,
 		&got.RoundThreshold,
+		&got.MaxOutcomeCost,
+		&got.MaxBallotCost,
+		&got.BallotCostIsCount,
+		&pollType,
+		&rule,
+		&roundType,
+		&information,
 	))
 	if salt != pollSegment.Salt {
 		t.Errorf("Wrong salt. Got %d. Expect %d.", salt, pollSegment.Salt)
@@ -176,6 +186,10 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 		t.Errorf("Deadline differ. Got %v. Expect %v. Difference %v.",
 			got.Deadline, query.Deadline, dateDiff)
 	}
+	got.Ranked = pollType == db.PollTypeRanked
+	got.Rule = ruleFromDB(rule)
+	got.RoundType = roundTypeFromDB(roundType)
+	got.Information = informationFromDB(information)
 	got.Electorate = electorateFromDB(electorate)
 	got.Deadline = query.Deadline
 	got.MaxRoundDuration = uint64(roundEnd.Sub(roundStart).Milliseconds())
@@ -193,10 +207,14 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 			break
 		}
 		var name string
-		mustt(t, rows.Scan(&name))
+		var cost float64
+		mustt(t, rows.Scan(&name, &cost))
 		if name != alt.Name {
 			t.Errorf("Wrong alternative %d. Got %s. Expect %s.", id, name, alt.Name)
 		}
+		if cost != alt.Cost {
+			t.Errorf("Wrong cost for alternative %d. Got %f. Expect %f.", id, cost, alt.Cost)
+		}
 	}
 	if rows.Next() {
 		t.Errorf("Unexpected alternatives.")
@@ -213,6 +231,35 @@ func (self *createPollTest) Check(t *testing.T, response *http.Response, request
 	}
 }
 
+func ruleFromDB(rule uint8) CreatePollRule {
+	for ret := CreatePollRulePlurality; ret <= CreatePollRuleEqualShares; ret++ {
+		if converted, _ := ret.ToDB(); converted == rule {
+			return ret
+		}
+	}
+	return CreatePollRulePlurality
+}
+
+func roundTypeFromDB(roundType uint8) CreatePollRoundType {
+	switch roundType {
+	case db.RoundTypeSynchronous:
+		return CreatePollRoundTypeSynchronous
+	case db.RoundTypeOneMove:
+		return CreatePollRoundTypeOneMove
+	default:
+		return CreatePollRoundTypeFreelyAsynchronous
+	}
+}
+
+func informationFromDB(information db.Information) CreatePollInformation {
+	for ret := CreatePollInformationNone; ret <= CreatePollInformationTrends; ret++ {
+		if converted, _ := ret.ToDB(); converted == information {
+			return ret
+		}
+	}
+	return CreatePollInformationCounts
+}
+
 func electorateFromDB(electorate db.Electorate) CreatePollElectorate {
 	switch electorate {
 	case db.ElectorateAll:
@@ -313,6 +360,88 @@ func TestCreateHandler(t *testing.T) {
 			RequestFct:        RFPostSession(makeBody(`"ShortURL": "CreatePollTest_DuplicateShortURL",`, []string{"First", "Second"})),
 			Checker:           srvt.CheckError{Code: http.StatusConflict, Body: "ShortURL already exists"},
 		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Approval",
+			RequestFct: RFPostSession(makeBody(`"MaxBallotCost": 2,`, []string{"First", "Second", "Third"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name: "Approval by cost",
+			RequestFct: RFPostSession(`{
+					"Title": "Test",
+					"MaxBallotCost": 2.5,
+					"BallotCostIsCount": false,
+					"Alternatives": [{"Name":"Cheap", "Cost":0.5}, {"Name":"Expensive", "Cost":2}]
+				}`),
+		}),
+		CreatePollTest(createPollTest_{
+			Name: "Alternative too costly",
+			RequestFct: RFPostSession(`{
+					"Title": "Test",
+					"MaxBallotCost": 1,
+					"BallotCostIsCount": false,
+					"Alternatives": [{"Name":"Cheap", "Cost":0.5}, {"Name":"Expensive", "Cost":2}]
+				}`),
+			Checker: srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Ranked",
+			RequestFct: RFPostSession(makeBody(`"Ranked": true,`, []string{"First", "Second", "Third"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Schulze",
+			RequestFct: RFPostSession(makeBody(`"Ranked": true, "Rule": 3,`, []string{"First", "Second", "Third"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Unknown rule",
+			RequestFct: RFPostSession(makeBody(`"Rule": 42,`, []string{"First", "Second"})),
+			Checker:    srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
+		CreatePollTest(createPollTest_{
+			Name: "Budget",
+			RequestFct: RFPostSession(`{
+					"Title": "Test",
+					"Rule": 6,
+					"MaxOutcomeCost": 10,
+					"MaxBallotCost": 3,
+					"Alternatives": [{"Name":"Park", "Cost":6}, {"Name":"Library", "Cost":4.5}]
+				}`),
+		}),
+		CreatePollTest(createPollTest_{
+			Name: "Over budget",
+			RequestFct: RFPostSession(`{
+					"Title": "Test",
+					"MaxOutcomeCost": 5,
+					"Alternatives": [{"Name":"Park", "Cost":6}, {"Name":"Library", "Cost":4.5}]
+				}`),
+			Checker: srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "One move",
+			RequestFct: RFPostSession(makeBody(`"RoundType": 2,`, []string{"First", "Second"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Unknown round type",
+			RequestFct: RFPostSession(makeBody(`"RoundType": 3,`, []string{"First", "Second"})),
+			Checker:    srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Matrix information",
+			RequestFct: RFPostSession(makeBody(`"Information": 4,`, []string{"First", "Second"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "No information",
+			RequestFct: RFPostSession(makeBody(`"Information": 0,`, []string{"First", "Second"})),
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Unknown information",
+			RequestFct: RFPostSession(makeBody(`"Information": 6,`, []string{"First", "Second"})),
+			Checker:    srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
+		CreatePollTest(createPollTest_{
+			Name:       "Null MaxBallotCost",
+			RequestFct: RFPostSession(makeBody(`"MaxBallotCost": 0,`, []string{"First", "Second"})),
+			Checker:    srvt.CheckStatus{Code: http.StatusBadRequest},
+		}),
 	}
 
 	srvt.Run(t, tests, CreateHandler)
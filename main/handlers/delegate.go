@@ -0,0 +1,130 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+// DelegateQuery is the body of delegation requests. Delegate is the name of the participant the
+// ballot is delegated to.
+type DelegateQuery struct {
+	Delegate string
+}
+
+// checkDelegationRequest does all the verifications common to delegation handlers and returns the
+// information on the poll.
+// Errors are sent by panic.
+func checkDelegationRequest(ctx context.Context, request *server.Request) PollInfo {
+	const qVoted = `SELECT 1 FROM Participants WHERE User = ? AND Poll = ? AND Round = ?`
+
+	must(request.CheckPOST(ctx))
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+	if request.User == nil {
+		panic(server.UnauthorizedHttpError("No user"))
+	}
+	if !pollInfo.Active {
+		panic(server.NewHttpError(http.StatusLocked, "Inactive poll", "Poll is currently not active"))
+	}
+
+	if pollInfo.OneMove() {
+		rows, err := db.DB.QueryContext(ctx, qVoted, request.User.Id, pollInfo.Id, pollInfo.CurrentRound)
+		must(err)
+		voted := rows.Next()
+		must(rows.Close())
+		if voted {
+			panic(server.NewHttpError(http.StatusConflict, "Already voted",
+				"Only one move per round is allowed"))
+		}
+	}
+	return pollInfo
+}
+
+// recordDelegation records the delegation of user for the current round of the poll.
+// A NULL delegate records a revocation.
+func recordDelegation(ctx context.Context, pollInfo PollInfo, user uint32, delegate sql.NullInt64) {
+	const qUpsert = `
+	  INSERT INTO Delegations (User, Poll, Round, Delegate) VALUE (?, ?, ?, ?)
+	      ON DUPLICATE KEY UPDATE Delegate = VALUES(Delegate)`
+	_, err := db.DB.ExecContext(ctx, qUpsert, user, pollInfo.Id, pollInfo.CurrentRound, delegate)
+	must(err)
+}
+
+type delegateHandler struct {
+	evtManager events.Manager
+}
+
+// DelegateHandler records that the user delegates its ballot to another participant of the poll,
+// starting from the current round. The delegation is resolved transitively when the ballots are
+// counted. Since a delegation is a move, a services.VoteEvent is sent.
+func DelegateHandler(evtManager events.Manager) delegateHandler {
+	return delegateHandler{evtManager: evtManager}
+}
+
+func (self delegateHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const qDelegate = `
+	  SELECT u.Id
+	    FROM Users AS u
+	   WHERE u.Name = ?
+	     AND EXISTS (SELECT 1 FROM Participants AS p WHERE p.User = u.Id AND p.Poll = ?)`
+
+	pollInfo := checkDelegationRequest(ctx, request)
+	var query DelegateQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	var delegate uint32
+	err := db.DB.QueryRowContext(ctx, qDelegate, query.Delegate, pollInfo.Id).Scan(&delegate)
+	if err == sql.ErrNoRows {
+		panic(server.NewHttpError(http.StatusNotFound, "No delegate", "Not a participant"))
+	}
+	must(err)
+	if delegate == request.User.Id {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Self delegation"))
+	}
+
+	recordDelegation(ctx, pollInfo, request.User.Id,
+		sql.NullInt64{Int64: int64(delegate), Valid: true})
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.VoteEvent{Poll: pollInfo.Id})
+}
+
+type revokeHandler struct {
+	evtManager events.Manager
+}
+
+// RevokeHandler records that the user does not delegate its ballot anymore, starting from the
+// current round. A services.VoteEvent is sent.
+func RevokeHandler(evtManager events.Manager) revokeHandler {
+	return revokeHandler{evtManager: evtManager}
+}
+
+func (self revokeHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo := checkDelegationRequest(ctx, request)
+	recordDelegation(ctx, pollInfo, request.User.Id, sql.NullInt64{})
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.VoteEvent{Poll: pollInfo.Id})
+}
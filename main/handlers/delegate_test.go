@@ -0,0 +1,130 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func delegateTestRequest(t *testing.T, name string) srvt.Request {
+	body, err := json.Marshal(DelegateQuery{Delegate: dbt.UserNameWith(name)})
+	mustt(t, err)
+	return srvt.Request{Method: "POST", Body: string(body)}
+}
+
+// delegateTestChecker checks that the delegation of the user for round 0 is the expected one.
+// If delegateIdx is zero, the delegation must be a revocation.
+func delegateTestChecker(delegateIdx int) pollTestCheckerFactory {
+	return func(param PollTestCheckerFactoryParam) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+			const qCheck = `SELECT Delegate FROM Delegations WHERE User = ? AND Poll = ? AND Round = 0`
+			var got sql.NullInt64
+			mustt(t, db.DB.QueryRow(qCheck, param.UserId, param.PollId).Scan(&got))
+			if got.Valid != (delegateIdx != 0) {
+				t.Errorf("Got delegate %v. Expect delegation: %t.", got, delegateIdx != 0)
+			}
+		})
+	}
+}
+
+func TestDelegateHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:        "Inactive",
+			Electorate:  db.ElectorateAll,
+			Waiting:     true,
+			Participate: []pollTestParticipate{{User: 2}},
+			UserType:    pollTestUserTypeLogged,
+			Request:     delegateTestRequest(t, "TestDelegateHandler/Inactive2"),
+			Checker:     srvt.CheckError{Code: http.StatusLocked, Body: "Inactive poll"},
+		},
+		&pollTest{
+			Name:       "Not a participant",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeLogged,
+			Request:    delegateTestRequest(t, "TestDelegateHandler/Not_a_participant"),
+			Checker:    srvt.CheckError{Code: http.StatusNotFound, Body: "No delegate"},
+		},
+		&pollTest{
+			Name:        "Self",
+			Electorate:  db.ElectorateAll,
+			Participate: []pollTestParticipate{{User: 1}},
+			UserType:    pollTestUserTypeLogged,
+			Request:     delegateTestRequest(t, "TestDelegateHandler/SelfLogged"),
+			Checker:     srvt.CheckStatus{Code: http.StatusBadRequest},
+		},
+		&pollTest{
+			Name:        "One move",
+			Electorate:  db.ElectorateAll,
+			OneMove:     true,
+			Participate: []pollTestParticipate{{User: 1}, {User: 2}},
+			UserType:    pollTestUserTypeLogged,
+			Request:     delegateTestRequest(t, "TestDelegateHandler/One_move2"),
+			Checker:     srvt.CheckError{Code: http.StatusConflict, Body: "Already voted"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			Participate:    []pollTestParticipate{{User: 2}},
+			UserType:       pollTestUserTypeLogged,
+			Request:        delegateTestRequest(t, "TestDelegateHandler/Success2"),
+			Checker:        delegateTestChecker(2),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, DelegateHandler)
+}
+
+func TestRevokeHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Inactive",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeLogged,
+			Request:    srvt.Request{Method: "POST"},
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Inactive poll"},
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateAll,
+			UserType:       pollTestUserTypeLogged,
+			Request:        srvt.Request{Method: "POST"},
+			Checker:        delegateTestChecker(0),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, RevokeHandler)
+}
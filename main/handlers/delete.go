@@ -48,7 +48,11 @@ func (self deleteHandler) Handle(ctx context.Context, response server.Response,
 
 	segment, err := salted.FromRequest(request)
 	must(err)
-	event := services.DeletePollEvent{Poll: segment.Id, Participants: make(map[uint32]bool, 2)}
+	event := services.DeletePollEvent{
+		Poll:         segment.Id,
+		Admin:        request.User.Id,
+		Participants: make(map[uint32]bool, 2),
+	}
 
 	const (
 		qTitle = `
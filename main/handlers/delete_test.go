@@ -109,7 +109,7 @@ func (self *deleteHandlerTest) Check(t *testing.T, response *http.Response, requ
 	mustt(t, err)
 	gotEvents := self.CountRecorderEvents(func(evt events.Event) bool {
 		converted, ok := evt.(services.DeletePollEvent)
-		return ok && converted.Poll == segment.Id
+		return ok && converted.Poll == segment.Id && converted.Admin == self.userId
 	})
 	if gotEvents != expectEvents {
 		t.Errorf("Got %d events. Expect %d.", gotEvents, expectEvents)
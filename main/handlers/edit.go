@@ -0,0 +1,175 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+type editHandler struct {
+	evtManager events.Manager
+}
+
+// EditHandler replaces the parameters and the alternatives of a poll that has not started yet.
+// The query is a CreateQuery, possibly based on a template, checked as for CreateHandler. Only the
+// administrator of the poll can edit it, and only when the poll is waiting, or active at the first
+// round without participants. The names of the alternatives cannot be changed once some
+// alternatives have been commented.
+func EditHandler(evtManager events.Manager) editHandler {
+	return editHandler{evtManager: evtManager}
+}
+
+func (self editHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	segment, err := salted.FromRequest(request)
+	must(err)
+
+	query := readCreateQuery(ctx, request)
+	values := checkCreateQuery(ctx, request.User.Id, &query)
+
+	const (
+		qCheck        = `SELECT Salt, Admin, State, CurrentRound FROM Polls WHERE Id = ? FOR UPDATE`
+		qParticipants = `SELECT 1 FROM Participants WHERE Poll = ? LIMIT 1 LOCK IN SHARE MODE`
+		qUpdate       = `
+		  UPDATE Polls
+		     SET Title = ?, Description = ?, State = ?, Start = ?, ShortURL = ?, Type = ?,
+		         Electorate = ?, Hidden = ?, NbChoices = ?, MaxOutcomeCost = ?, MaxBallotCost = ?,
+		         BallotCostIsCount = ?, Rule = ?, RoundType = ?, ReportVote = ?, Information = ?,
+		         MinNbRounds = ?, MaxNbRounds = ?, Deadline = ?, MaxRoundDuration = ?,
+		         RoundThreshold = ?
+		   WHERE Id = ?`
+		qAlternatives       = `SELECT Name FROM Alternatives WHERE Poll = ? ORDER BY Id FOR UPDATE`
+		qComments           = `SELECT 1 FROM Comments WHERE Poll = ? AND Alternative IS NOT NULL LIMIT 1`
+		qUpdateCost         = `UPDATE Alternatives SET Cost = ? WHERE Poll = ? AND Id = ?`
+		qDeleteAlternatives = `DELETE FROM Alternatives WHERE Poll = ?`
+	)
+
+	var state db.State
+	db.RepeatDeadlocked(slog.CtxLoadLogger(ctx), ctx, nil, func(tx *sql.Tx) {
+		rows, err := tx.QueryContext(ctx, qCheck, segment.Id)
+		must(err)
+		defer rows.Close()
+		if !rows.Next() {
+			panic(noPollError("No such Id"))
+		}
+
+		var salt, admin uint32
+		var round uint8
+		must(rows.Scan(&salt, &admin, &state, &round))
+		rows.Close()
+		if salt != segment.Salt {
+			panic(noPollError("Wrong salt"))
+		}
+		if admin != request.User.Id {
+			panic(server.UnauthorizedHttpError("Not admin"))
+		}
+		if state != db.StateWaiting && (state != db.StateActive || round != 0) {
+			panic(server.NewHttpError(http.StatusLocked, "Not editable", "The poll has started"))
+		}
+
+		rows, err = tx.QueryContext(ctx, qParticipants, segment.Id)
+		must(err)
+		defer rows.Close()
+		if rows.Next() {
+			panic(server.NewHttpError(http.StatusLocked, "Not editable", "The poll has participants"))
+		}
+		rows.Close()
+
+		_, err = tx.ExecContext(ctx, qUpdate,
+			query.Title,
+			query.Description,
+			values.state,
+			values.start,
+			values.shortURL,
+			values.pollType,
+			values.electorate,
+			query.Hidden,
+			len(query.Alternatives),
+			query.MaxOutcomeCost,
+			query.MaxBallotCost,
+			query.BallotCostIsCount,
+			values.rule,
+			values.roundType,
+			query.ReportVote,
+			values.information,
+			query.MinNbRounds,
+			query.MaxNbRounds,
+			query.Deadline,
+			db.DurationToTime(time.Duration(query.MaxRoundDuration)*time.Millisecond),
+			query.RoundThreshold,
+			segment.Id,
+		)
+		if err != nil {
+			panic(checkShortURLError(ctx, tx, err, values.shortURL))
+		}
+
+		// Alternatives are replaced only if their names change, since comments on alternatives
+		// would be deleted with them.
+		rows, err = tx.QueryContext(ctx, qAlternatives, segment.Id)
+		must(err)
+		var names []string
+		for rows.Next() {
+			var name string
+			must(rows.Scan(&name))
+			names = append(names, name)
+		}
+		must(rows.Err())
+		rows.Close()
+		sameNames := len(names) == len(query.Alternatives)
+		for id := 0; sameNames && id < len(names); id++ {
+			sameNames = names[id] == query.Alternatives[id].Name
+		}
+
+		if sameNames {
+			for id, alt := range query.Alternatives {
+				_, err = tx.ExecContext(ctx, qUpdateCost, alt.Cost, segment.Id, id)
+				must(err)
+			}
+			return
+		}
+
+		rows, err = tx.QueryContext(ctx, qComments, segment.Id)
+		must(err)
+		defer rows.Close()
+		if rows.Next() {
+			panic(server.NewHttpError(http.StatusLocked, "Not editable",
+				"The alternatives have comments"))
+		}
+		rows.Close()
+		_, err = tx.ExecContext(ctx, qDeleteAlternatives, segment.Id)
+		must(err)
+		insertAlternatives(ctx, tx, segment.Id, &query)
+	})
+
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.UpdatePollEvent{Poll: segment.Id})
+	if state == db.StateWaiting && values.state == string(db.StateActive) {
+		self.evtManager.Send(services.StartPollEvent{Poll: segment.Id})
+	}
+}
@@ -0,0 +1,240 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+func editHandlerRequest(t *testing.T, query CreateQuery) srvt.Request {
+	body, err := json.Marshal(query)
+	mustt(t, err)
+	return srvt.Request{Method: "POST", Body: string(body)}
+}
+
+func editHandlerCheckerFactory(query CreateQuery, state db.State) pollTestCheckerFactory {
+	return func(param PollTestCheckerFactoryParam) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+			const (
+				qPoll         = `SELECT Title, State, NbChoices FROM Polls WHERE Id = ?`
+				qAlternatives = `SELECT Name FROM Alternatives WHERE Poll = ? ORDER BY Id`
+			)
+
+			var title string
+			var gotState db.State
+			var nbChoices int
+			mustt(t, db.DB.QueryRow(qPoll, param.PollId).Scan(&title, &gotState, &nbChoices))
+			if title != query.Title {
+				t.Errorf("Wrong title. Got %s. Expect %s.", title, query.Title)
+			}
+			if gotState != state {
+				t.Errorf("Wrong state. Got %s. Expect %s.", gotState, state)
+			}
+			if nbChoices != len(query.Alternatives) {
+				t.Errorf("Wrong NbChoices. Got %d. Expect %d.", nbChoices, len(query.Alternatives))
+			}
+
+			rows, err := db.DB.Query(qAlternatives, param.PollId)
+			mustt(t, err)
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var name string
+				mustt(t, rows.Scan(&name))
+				got = append(got, name)
+			}
+			var expect []string
+			for _, alt := range query.Alternatives {
+				expect = append(expect, alt.Name)
+			}
+			if !reflect.DeepEqual(got, expect) {
+				t.Errorf("Wrong alternatives. Got %v. Expect %v.", got, expect)
+			}
+		})
+	}
+}
+
+func editHandlerEventPredicate(param PollTestCheckerFactoryParam, evt events.Event) bool {
+	updateEvt, ok := evt.(services.UpdatePollEvent)
+	return ok && updateEvt.Poll == param.PollId
+}
+
+func TestEditHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	query := defaultCreateQuery()
+	query.Title = "Edited"
+	query.Alternatives = []SimpleAlternative{
+		{Name: "Ham", Cost: 1},
+		{Name: "Stram", Cost: 1},
+		{Name: "Gram", Cost: 1},
+	}
+	request := editHandlerRequest(t, query)
+
+	waitingQuery := query
+	waitingQuery.Start = query.Deadline.Add(-24 * time.Hour)
+
+	noTitle := query
+	noTitle.Title = ""
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Not logged",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeNone,
+			Request:    request,
+			Checker:    srvt.CheckStatus{Code: http.StatusForbidden},
+		},
+		&pollTest{
+			Name:           "Not admin",
+			Electorate:     db.ElectorateAll,
+			Waiting:        true,
+			UserType:       pollTestUserTypeLogged,
+			Request:        request,
+			Checker:        srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			EventPredicate: editHandlerEventPredicate,
+			EventCount:     0,
+		},
+		&pollTest{
+			Name:       "Bad request",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    editHandlerRequest(t, noTitle),
+			Checker:    srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&pollTest{
+			Name:       "Next round",
+			Electorate: db.ElectorateAll,
+			Round:      1,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    request,
+			Checker:    srvt.CheckError{Code: http.StatusLocked, Body: "Not editable"},
+		},
+		&pollTest{
+			Name:        "Participants",
+			Electorate:  db.ElectorateAll,
+			Participate: []pollTestParticipate{{User: 2, Round: 0}},
+			UserType:    pollTestUserTypeAdmin,
+			Request:     request,
+			Checker:     srvt.CheckError{Code: http.StatusLocked, Body: "Not editable"},
+		},
+		&pollTest{
+			Name:           "Waiting",
+			Electorate:     db.ElectorateAll,
+			Waiting:        true,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        editHandlerRequest(t, waitingQuery),
+			Checker:        editHandlerCheckerFactory(waitingQuery, db.StateWaiting),
+			EventPredicate: editHandlerEventPredicate,
+			EventCount:     1,
+		},
+		&pollTest{
+			Name:           "Start now",
+			Electorate:     db.ElectorateAll,
+			Waiting:        true,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        request,
+			Checker:        editHandlerCheckerFactory(query, db.StateActive),
+			EventPredicate: launchHandlerEventPredicate,
+			EventCount:     1,
+		},
+		&pollTest{
+			Name:           "Active",
+			Electorate:     db.ElectorateAll,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        request,
+			Checker:        editHandlerCheckerFactory(query, db.StateActive),
+			EventPredicate: editHandlerEventPredicate,
+			EventCount:     1,
+		},
+	}
+	srvt.Run(t, tests, EditHandler)
+}
+
+func TestEditHandler_Comments(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	names := []string{"Ham", "Stram", "Gram"}
+	samePoll := env.CreatePollWith("Same", admin, db.ElectorateAll, names)
+	renamedPoll := env.CreatePollWith("Renamed", admin, db.ElectorateAll, names)
+	const qComment = `INSERT INTO Comments (Poll, Alternative, Author, Content) VALUE (?, 1, ?, 'Hi')`
+	env.QuietExec(qComment, samePoll, admin)
+	env.QuietExec(qComment, renamedPoll, admin)
+	env.Must(t)
+
+	query := defaultCreateQuery()
+	query.Title = "Edited"
+	for _, name := range names {
+		query.Alternatives = append(query.Alternatives, SimpleAlternative{Name: name, Cost: 1})
+	}
+	renamed := query
+	renamed.Alternatives = []SimpleAlternative{{Name: "Spam", Cost: 1}, {Name: "Eggs", Cost: 1}}
+
+	makeRequest := func(poll uint32, query CreateQuery) srvt.Request {
+		request := *makePollRequest(t, poll, &admin)
+		body, err := json.Marshal(query)
+		mustt(t, err)
+		request.Method = "POST"
+		request.Body = string(body)
+		return request
+	}
+	checkComment := func(poll uint32, checker srvt.Checker) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			checker.Check(t, response, request)
+			const qCount = `SELECT COUNT(*) FROM Comments WHERE Poll = ?`
+			var count int
+			mustt(t, db.DB.QueryRow(qCount, poll).Scan(&count))
+			if count != 1 {
+				t.Errorf("Wrong number of comments. Got %d. Expect 1.", count)
+			}
+		})
+	}
+
+	tests := []srvt.Test{
+		&srvt.T{
+			Name:    "Same alternatives",
+			Request: makeRequest(samePoll, query),
+			Checker: checkComment(samePoll, srvt.CheckStatus{Code: http.StatusOK}),
+		},
+		&srvt.T{
+			Name:    "Renamed alternatives",
+			Request: makeRequest(renamedPoll, renamed),
+			Checker: checkComment(renamedPoll,
+				srvt.CheckError{Code: http.StatusLocked, Body: "Not editable"}),
+		},
+	}
+	srvt.Run(t, tests, EditHandler)
+}
@@ -0,0 +1,81 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// EmailPrefs are the events about polls that the user wants to be notified of by email.
+// Reminder is whether the user wants to be reminded of rounds it has not voted in yet. It is the
+// only notification enabled by default.
+// It is both the body of save requests and the answer to get requests.
+type EmailPrefs struct {
+	Start     bool
+	NextRound bool
+	Close     bool
+	Delete    bool
+	Reminder  bool
+}
+
+// EmailPrefsHandler sends the email notification preferences of the user.
+func EmailPrefsHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	const qSelect = `
+	  SELECT OnStart, OnNextRound, OnClose, OnDelete, OnReminder
+	    FROM EmailPreferences WHERE User = ?`
+
+	answer := EmailPrefs{Reminder: true}
+	err := db.DB.QueryRowContext(ctx, qSelect, request.User.Id).
+		Scan(&answer.Start, &answer.NextRound, &answer.Close, &answer.Delete, &answer.Reminder)
+	if err != sql.ErrNoRows {
+		must(err)
+	}
+
+	response.SendJSON(ctx, answer)
+}
+
+// EmailPrefsSaveHandler stores the email notification preferences of the user.
+// Omitted fields are false, except Reminder which is true.
+// Only users with a verified email address receive notifications.
+func EmailPrefsSaveHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	query := EmailPrefs{Reminder: true}
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	const qSave = `
+	  INSERT INTO EmailPreferences (User, OnStart, OnNextRound, OnClose, OnDelete, OnReminder)
+	  VALUE (?, ?, ?, ?, ?, ?)
+	      ON DUPLICATE KEY UPDATE OnStart = VALUES(OnStart), OnNextRound = VALUES(OnNextRound),
+	                              OnClose = VALUES(OnClose), OnDelete = VALUES(OnDelete),
+	                              OnReminder = VALUES(OnReminder)`
+	_, err := db.DB.ExecContext(ctx, qSave, request.User.Id,
+		query.Start, query.NextRound, query.Close, query.Delete, query.Reminder)
+	must(err)
+
+	response.SendJSON(ctx, "Ok")
+}
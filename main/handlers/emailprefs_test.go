@@ -0,0 +1,75 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestEmailPrefsHandlers(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUserWith("EmailPrefs")
+	env.Must(t)
+
+	t.Run("Default", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: srvt.Request{},
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId},
+				Checker: srvt.CheckJSON{Body: EmailPrefs{Reminder: true}},
+			},
+		}, EmailPrefsHandler)
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: srvt.Request{Method: "POST", Body: `{"Close":true}`},
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId, Method: "POST", Body: `{"NextRound":true,"Close":true}`},
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+		}, EmailPrefsSaveHandler)
+	})
+
+	t.Run("Saved", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId},
+				Checker: srvt.CheckJSON{Body: EmailPrefs{NextRound: true, Close: true, Reminder: true}},
+			},
+		}, EmailPrefsHandler)
+	})
+}
@@ -0,0 +1,217 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// ExportBallot is the ballot of a participant for a round.
+// Participant is an anonymous identifier, only meaningful inside the export. Weight is the weight
+// of the participant in the poll. Alternatives are sorted by rank, and Ranks[i] is the rank of
+// Alternatives[i]. Modified is the last modification time of the ballot. It is nil for blank
+// ballots.
+type ExportBallot struct {
+	Round        uint8
+	Participant  uint32
+	Weight       uint32
+	Alternatives AlternativeList
+	Ranks        []int      `json:",omitempty"`
+	Blank        bool       `json:",omitempty"`
+	Modified     *time.Time `json:",omitempty"`
+}
+
+// ExportAnswer is the JSON export of a poll.
+type ExportAnswer struct {
+	Title        string
+	Alternatives []PollAlternative
+	Ballots      []ExportBallot
+}
+
+// exportAnonymous associates to each distinct user of the list an anonymous identifier, between
+// one and the number of distinct users. Identifiers are shuffled using crypto/rand, such that
+// they reveal nothing about the users.
+func exportAnonymous(users []uint32) (ret map[uint32]uint32, err error) {
+	ret = make(map[uint32]uint32)
+	var distinct []uint32
+	for _, user := range users {
+		if _, ok := ret[user]; !ok {
+			ret[user] = 0
+			distinct = append(distinct, user)
+		}
+	}
+
+	ids := make([]uint32, len(distinct))
+	for i := range ids {
+		ids[i] = uint32(i + 1)
+	}
+	for i := len(ids) - 1; i > 0; i-- {
+		var j *big.Int
+		j, err = rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return
+		}
+		ids[i], ids[j.Int64()] = ids[j.Int64()], ids[i]
+	}
+
+	for i, user := range distinct {
+		ret[user] = ids[i]
+	}
+	return
+}
+
+// ExportHandler sends all the ballots of the completed rounds of a poll to its administrator.
+// The ballots are sent in JSON, or in CSV if the path starts with "csv". Participants are
+// anonymised by identifiers randomly drawn for each export. Ballots are sorted by round, then by
+// anonymous identifier.
+func ExportHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	csvFormat := false
+	if len(request.RemainingPath) >= 2 {
+		switch request.RemainingPath[0] {
+		case "csv":
+			csvFormat = true
+		case "json":
+		default:
+			panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Unknown format"))
+		}
+	}
+
+	segment, err := salted.FromRequest(request)
+	must(err)
+
+	const (
+		qPoll = `
+		  SELECT Salt, Title, NbChoices, CurrentRound
+		    FROM Polls
+		   WHERE Id = ? AND Admin = ?`
+		qBallots = `
+		  SELECT p.User, p.Round, IFNULL(w.Weight, 1), b.Alternative, b.Rank, b.Modified
+		    FROM Participants AS p
+		    LEFT OUTER JOIN Weights AS w ON (p.Poll, p.User) = (w.Poll, w.User)
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   WHERE p.Poll = ? AND p.Round < ?
+		   ORDER BY p.Round, p.User, b.Rank, b.Alternative`
+	)
+
+	var answer ExportAnswer
+	var salt uint32
+	pollInfo := PollInfo{Id: segment.Id}
+	err = db.DB.QueryRowContext(ctx, qPoll, segment.Id, request.User.Id).
+		Scan(&salt, &answer.Title, &pollInfo.NbChoices, &pollInfo.CurrentRound)
+	if err == sql.ErrNoRows || (err == nil && salt != segment.Salt) {
+		panic(noPollError("Not the administrator of the poll"))
+	}
+	must(err)
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+
+	rows, err := db.DB.QueryContext(ctx, qBallots, pollInfo.Id, pollInfo.CurrentRound)
+	must(err)
+	defer rows.Close()
+	var users []uint32 // users[i] is the participant of answer.Ballots[i].
+	var current *ExportBallot
+	for rows.Next() {
+		var user uint32
+		var round uint8
+		var weight uint32
+		var alternative, rank sql.NullInt32
+		var modified sql.NullTime
+		must(rows.Scan(&user, &round, &weight, &alternative, &rank, &modified))
+
+		if current == nil || current.Round != round || users[len(users)-1] != user {
+			answer.Ballots = append(answer.Ballots, ExportBallot{Round: round, Weight: weight})
+			users = append(users, user)
+			current = &answer.Ballots[len(answer.Ballots)-1]
+		}
+
+		if !alternative.Valid {
+			current.Blank = true
+			continue
+		}
+		current.Alternatives = append(current.Alternatives, uint8(alternative.Int32))
+		current.Ranks = append(current.Ranks, int(rank.Int32))
+		if modified.Valid && (current.Modified == nil || modified.Time.After(*current.Modified)) {
+			current.Modified = &modified.Time
+		}
+	}
+	must(rows.Err())
+
+	anonymous, err := exportAnonymous(users)
+	must(err)
+	for i := range answer.Ballots {
+		answer.Ballots[i].Participant = anonymous[users[i]]
+	}
+	sort.Slice(answer.Ballots, func(i, j int) bool {
+		if answer.Ballots[i].Round != answer.Ballots[j].Round {
+			return answer.Ballots[i].Round < answer.Ballots[j].Round
+		}
+		return answer.Ballots[i].Participant < answer.Ballots[j].Participant
+	})
+
+	if !csvFormat {
+		response.SendJSON(ctx, answer)
+		return
+	}
+	content, err := answer.CSV()
+	must(err)
+	response.SendFile(ctx, "poll.csv", "text/csv", content)
+}
+
+// CSV encodes the ballots in CSV, one line for each alternative of each ballot.
+// Blank ballots are represented by one line with empty Rank, Alternative, Name and Modified.
+func (self *ExportAnswer) CSV() ([]byte, error) {
+	var buff bytes.Buffer
+	writer := csv.NewWriter(&buff)
+	writer.Write([]string{"Round", "Participant", "Weight", "Rank", "Alternative", "Name", "Modified"})
+	for _, ballot := range self.Ballots {
+		round := strconv.FormatUint(uint64(ballot.Round), 10)
+		participant := strconv.FormatUint(uint64(ballot.Participant), 10)
+		weight := strconv.FormatUint(uint64(ballot.Weight), 10)
+		if len(ballot.Alternatives) == 0 {
+			writer.Write([]string{round, participant, weight, "", "", "", ""})
+			continue
+		}
+		var modified string
+		if ballot.Modified != nil {
+			modified = ballot.Modified.UTC().Format(time.RFC3339)
+		}
+		for i, alt := range ballot.Alternatives {
+			var name string
+			if int(alt) < len(self.Alternatives) {
+				name = self.Alternatives[alt].Name
+			}
+			writer.Write([]string{round, participant, weight, strconv.Itoa(ballot.Ranks[i]),
+				strconv.FormatUint(uint64(alt), 10), name, modified})
+		}
+	}
+	writer.Flush()
+	return buff.Bytes(), writer.Error()
+}
@@ -0,0 +1,230 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestExportAnswer_CSV(t *testing.T) {
+	modified := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	answer := ExportAnswer{
+		Title: "Test",
+		Alternatives: []PollAlternative{
+			{Id: 0, Name: "Ham", Cost: 1},
+			{Id: 1, Name: "Stram, Gram", Cost: 1},
+		},
+		Ballots: []ExportBallot{
+			{Round: 0, Participant: 1, Weight: 3, Alternatives: AlternativeList{1, 0},
+				Ranks: []int{1, 2}, Modified: &modified},
+			{Round: 0, Participant: 2, Weight: 1, Blank: true},
+		},
+	}
+	expect := "Round,Participant,Weight,Rank,Alternative,Name,Modified\n" +
+		"0,1,3,1,1,\"Stram, Gram\",2021-01-02T03:04:05Z\n" +
+		"0,1,3,2,0,Ham,2021-01-02T03:04:05Z\n" +
+		"0,2,1,,,,\n"
+
+	got, err := answer.CSV()
+	mustt(t, err)
+	if string(got) != expect {
+		t.Errorf("Got %s. Expect %s.", got, expect)
+	}
+}
+
+func TestExportAnonymous(t *testing.T) {
+	users := []uint32{42, 7, 42, 13, 7, 100}
+	got, err := exportAnonymous(users)
+	mustt(t, err)
+	if len(got) != 4 {
+		t.Fatalf("Got %d identifiers. Expect 4.", len(got))
+	}
+	seen := make(map[uint32]bool)
+	for user, id := range got {
+		if id < 1 || id > 4 || seen[id] {
+			t.Errorf("Wrong identifier %d for user %d.", id, user)
+		}
+		seen[id] = true
+	}
+}
+
+// exportCanonical relabels the participants of the answer by order of appearance, ballots being
+// sorted by round then by weight. The answer can then be compared whatever the random identifiers.
+func exportCanonical(answer ExportAnswer) ExportAnswer {
+	ballots := append([]ExportBallot{}, answer.Ballots...)
+	sort.SliceStable(ballots, func(i, j int) bool {
+		if ballots[i].Round != ballots[j].Round {
+			return ballots[i].Round < ballots[j].Round
+		}
+		return ballots[i].Weight < ballots[j].Weight
+	})
+	labels := make(map[uint32]uint32)
+	for i := range ballots {
+		label, ok := labels[ballots[i].Participant]
+		if !ok {
+			label = uint32(len(labels) + 1)
+			labels[ballots[i].Participant] = label
+		}
+		ballots[i].Participant = label
+	}
+	answer.Ballots = ballots
+	return answer
+}
+
+// exportCSVRecords returns the records of a CSV export without the participant column, the records
+// after the header being sorted.
+func exportCSVRecords(t *testing.T, content []byte) (ret []string) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	mustt(t, err)
+	for _, record := range records {
+		ret = append(ret, strings.Join(append(record[:1:1], record[2:]...), ","))
+	}
+	if len(ret) > 1 {
+		sort.Strings(ret[1:])
+	}
+	return
+}
+
+func TestExportHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith("Admin")
+	other := env.CreateUserWith("Other")
+
+	pollId := env.CreatePollWith("Export", admin, db.ElectorateAll, []string{"Ham", "Stram"})
+	env.Vote(pollId, 0, other, 1)
+	env.Vote(pollId, 0, admin, 0)
+	env.QuietExec(`UPDATE Ballots SET Modified = '2021-01-02 03:04:05' WHERE Poll = ?`, pollId)
+	env.QuietExec(`INSERT INTO Weights (Poll, User, Weight) VALUE (?, ?, 4)`, pollId, other)
+	env.Must(t)
+
+	request := *makePollRequest(t, pollId, &admin)
+	csvTarget := "/a/test/csv/" + (*request.Target)[len("/a/test/"):]
+	csvRequest := srvt.Request{Target: &csvTarget, UserId: &admin}
+	unknownTarget := "/a/test/xml/" + (*request.Target)[len("/a/test/"):]
+	unknownRequest := srvt.Request{Target: &unknownTarget, UserId: &admin}
+
+	modified := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	answer := ExportAnswer{
+		Title: "Export",
+		Alternatives: []PollAlternative{
+			{Id: 0, Name: "Ham", Cost: 1},
+			{Id: 1, Name: "Stram", Cost: 1},
+		},
+	}
+	completed := answer
+	completed.Ballots = []ExportBallot{
+		{Round: 0, Participant: 1, Weight: 1, Alternatives: AlternativeList{0}, Ranks: []int{1},
+			Modified: &modified},
+		{Round: 0, Participant: 2, Weight: 4, Alternatives: AlternativeList{1}, Ranks: []int{1},
+			Modified: &modified},
+		{Round: 1, Participant: 2, Weight: 4, Blank: true},
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "No completed round",
+			Request: request,
+			Checker: srvt.CheckJSON{Body: answer},
+		},
+		&srvt.T{
+			Name: "Completed rounds",
+			Update: func(t *testing.T) {
+				const qParticipate = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, 1)`
+				env.NextRound(pollId)
+				env.QuietExec(qParticipate, other, pollId)
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: srvt.CheckerFun(func(t *testing.T, response *http.Response,
+				request *server.Request) {
+				srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+				var got ExportAnswer
+				mustt(t, json.NewDecoder(response.Body).Decode(&got))
+				for i := 1; i < len(got.Ballots); i++ {
+					prev, cur := got.Ballots[i-1], got.Ballots[i]
+					if prev.Round > cur.Round ||
+						(prev.Round == cur.Round && prev.Participant >= cur.Participant) {
+						t.Errorf("Ballots not sorted at index %d.", i)
+					}
+				}
+				gotJSON, err := json.Marshal(exportCanonical(got))
+				mustt(t, err)
+				expectJSON, err := json.Marshal(completed)
+				mustt(t, err)
+				if !bytes.Equal(gotJSON, expectJSON) {
+					t.Errorf("Got %s. Expect %s.", gotJSON, expectJSON)
+				}
+			}),
+		},
+		&srvt.T{
+			Name:    "CSV",
+			Request: csvRequest,
+			Checker: srvt.CheckerFun(func(t *testing.T, response *http.Response,
+				request *server.Request) {
+				srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+				if got := response.Header.Get("Content-Type"); got != "text/csv" {
+					t.Errorf("Got content type %s. Expect text/csv.", got)
+				}
+				var buff bytes.Buffer
+				_, err := buff.ReadFrom(response.Body)
+				mustt(t, err)
+				expect, err := completed.CSV()
+				mustt(t, err)
+				got := exportCSVRecords(t, buff.Bytes())
+				if want := exportCSVRecords(t, expect); !reflect.DeepEqual(got, want) {
+					t.Errorf("Got %v. Expect %v.", got, want)
+				}
+			}),
+		},
+		&srvt.T{
+			Name:    "Unknown format",
+			Request: unknownRequest,
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&srvt.T{
+			Name:    "Not admin",
+			Request: *makePollRequest(t, pollId, &other),
+			Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No poll"},
+		},
+		&srvt.T{
+			Name:    "No user",
+			Request: *makePollRequest(t, pollId, nil),
+			Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+	}
+	srvt.RunFunc(t, tests, ExportHandler)
+}
@@ -41,3 +41,12 @@ func must(err error) {
 		panic(err)
 	}
 }
+
+// checkLoggedUser ensures that the request comes from a logged user.
+// Errors are sent by panic.
+func checkLoggedUser(request *server.Request) {
+	if request.User == nil || !request.User.Logged {
+		must(request.SessionError)
+		panic(server.UnauthorizedHttpError("Unlogged user"))
+	}
+}
@@ -0,0 +1,56 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/JBoudou/Itero/mid/outcome"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/rules"
+)
+
+// HistoryInfoAnswer contains the counts of all the completed rounds of a poll.
+// Counts[r][a] is the total weight of the participants who ranked alternative a first at round r.
+type HistoryInfoAnswer struct {
+	Alternatives []PollAlternative
+	Counts       [][]uint32
+}
+
+// HistoryInfoHandler sends the plurality counts of all the completed rounds.
+// As for CountInfoHandler, only the preferred alternatives of ranked ballots are counted, and
+// ballots are weighted by delegations.
+func HistoryInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo := checkInformationAccess(ctx, request, InformationTypeCounts)
+
+	var answer HistoryInfoAnswer
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+	profiles, err := outcome.LoadProfiles(ctx, pollInfo.Id, pollInfo.CurrentRound)
+	must(err)
+	answer.Counts = make([][]uint32, len(profiles))
+	for r, profile := range profiles {
+		result := rules.Plurality{}.Outcome(profile)
+		answer.Counts[r] = make([]uint32, pollInfo.NbChoices)
+		for alt, score := range result.Scores {
+			if alt < len(answer.Counts[r]) {
+				answer.Counts[r][alt] = uint32(score)
+			}
+		}
+	}
+
+	response.SendJSON(ctx, answer)
+}
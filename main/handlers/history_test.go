@@ -0,0 +1,133 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestHistoryInfoHandler(t *testing.T) {
+	precheck(t)
+
+	const qReport = `UPDATE Polls SET ReportVote = TRUE WHERE Id = ?`
+
+	var env dbt.Env
+	defer env.Close()
+	var users [3]uint32
+	for i := range users {
+		users[i] = env.CreateUserWith(strconv.FormatInt(int64(i), 10))
+	}
+
+	alt := []string{"Ham", "Stram", "Gram"}
+	altAns := []PollAlternative{
+		{Id: 0, Name: "Ham", Cost: 1},
+		{Id: 1, Name: "Stram", Cost: 1},
+		{Id: 2, Name: "Gram", Cost: 1},
+	}
+
+	pollId := env.CreatePollWith("Test", users[0], db.ElectorateAll, alt)
+	env.Vote(pollId, 0, users[0], 2)
+	env.Vote(pollId, 0, users[1], 2)
+	env.Vote(pollId, 0, users[2], 0)
+	env.Must(t)
+
+	request := *makePollRequest(t, pollId, &users[0])
+
+	makeChecker := func(counts ...[]uint32) srvt.Checker {
+		if counts == nil {
+			counts = [][]uint32{}
+		}
+		return srvt.CheckJSON{Body: HistoryInfoAnswer{Alternatives: altAns, Counts: counts}}
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "Round Zero",
+			Request: request,
+			Checker: makeChecker(),
+		},
+		&srvt.T{
+			Name: "First round",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: makeChecker([]uint32{1, 0, 2}),
+		},
+		&srvt.T{
+			Name: "Abstain",
+			Update: func(t *testing.T) {
+				env.Vote(pollId, 1, users[0], 1)
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: makeChecker([]uint32{1, 0, 2}, []uint32{0, 1, 0}),
+		},
+		&srvt.T{
+			Name: "Carry forward",
+			Update: func(t *testing.T) {
+				env.QuietExec(qReport, pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: makeChecker([]uint32{1, 0, 2}, []uint32{1, 1, 1}),
+		},
+		&srvt.T{
+			Name: "Empty round",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: makeChecker([]uint32{1, 0, 2}, []uint32{1, 1, 1}, []uint32{1, 1, 1}),
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:         "Unlogged public",
+			Electorate:   db.ElectorateAll,
+			Alternatives: alt,
+			UserType:     pollTestUserTypeUnlogged,
+			Vote:         []pollTestVote{{2, 0, 0}, {3, 0, 0}, {4, 0, 2}},
+			Round:        1,
+			Checker:      makeChecker([]uint32{2, 0, 1}),
+		},
+		&pollTest{
+			Name:         "Hidden counts",
+			Electorate:   db.ElectorateAll,
+			Alternatives: alt,
+			Information:  db.InformationWinner,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         []pollTestVote{{2, 0, 0}, {3, 0, 0}, {4, 0, 2}},
+			Round:        1,
+			Checker:      srvt.CheckError{Code: http.StatusForbidden, Body: "Hidden information"},
+		},
+	}
+	srvt.RunFunc(t, tests, HistoryInfoHandler)
+}
@@ -0,0 +1,234 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// CalendarTokenAnswer contains the secret token of the calendar feed of the user.
+// The feed is available at /a/ical/<Token>.ics.
+type CalendarTokenAnswer struct {
+	Token string
+}
+
+const calendarTokenBytes = 32
+
+// createCalendarToken stores a new calendar token for the user, replacing any previous one.
+// Errors are sent by panic.
+func createCalendarToken(ctx context.Context, user uint32) string {
+	const qUpsert = `
+	  INSERT INTO CalendarTokens (User, Token) VALUE (?, ?)
+	      ON DUPLICATE KEY UPDATE Token = VALUES(Token), Created = CURRENT_TIMESTAMP`
+
+	buff := make([]byte, calendarTokenBytes)
+	_, err := rand.Read(buff)
+	must(err)
+	token := hex.EncodeToString(buff)
+	_, err = db.DB.ExecContext(ctx, qUpsert, user, token)
+	must(err)
+	return token
+}
+
+// CalendarTokenHandler sends the calendar token of the user, creating it if needed.
+func CalendarTokenHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	const qSelect = `SELECT Token FROM CalendarTokens WHERE User = ?`
+	var answer CalendarTokenAnswer
+	err := db.DB.QueryRowContext(ctx, qSelect, request.User.Id).Scan(&answer.Token)
+	if err == sql.ErrNoRows {
+		answer.Token = createCalendarToken(ctx, request.User.Id)
+	} else {
+		must(err)
+	}
+
+	response.SendJSON(ctx, answer)
+}
+
+// CalendarTokenResetHandler replaces the calendar token of the user, such that the previous feed
+// address is no longer valid.
+func CalendarTokenResetHandler(ctx context.Context, response server.Response,
+	request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	response.SendJSON(ctx, CalendarTokenAnswer{Token: createCalendarToken(ctx, request.User.Id)})
+}
+
+// CalendarHandler sends an iCalendar feed of the deadlines of the polls the user administrates or
+// participates in. The user is identified by the token in the last element of the path, with
+// extension ".ics". No session is needed, so that calendar applications can subscribe to the feed.
+//
+// The feed contains events for the start of waiting polls, the end of current rounds, and the
+// deadline of polls. It is computed on each request, hence it follows the progress of the polls.
+func CalendarHandler(ctx context.Context, response server.Response, request *server.Request) {
+	const (
+		qUser = `SELECT User FROM CalendarTokens WHERE Token = ?`
+		qList = `
+		  SELECT p.Id, p.Salt, p.Title, p.State, p.CurrentRound, p.Start,
+		         RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline,
+		                       p.CurrentRound, p.MinNbRounds),
+		         p.Deadline
+		    FROM Polls AS p
+		   WHERE p.State != 'Terminated'
+		     AND (   p.Admin = ?
+		          OR EXISTS (SELECT 1 FROM Participants AS a WHERE a.Poll = p.Id AND a.User = ?)
+		          OR EXISTS (SELECT 1 FROM Invitations  AS i WHERE i.Poll = p.Id AND i.User = ?))
+		   ORDER BY p.Id`
+	)
+
+	if len(request.RemainingPath) == 0 {
+		panic(server.NewHttpError(http.StatusNotFound, "Not found", "No token"))
+	}
+	token := request.RemainingPath[len(request.RemainingPath)-1]
+	if !strings.HasSuffix(token, ".ics") {
+		panic(server.NewHttpError(http.StatusNotFound, "Not found", "Wrong extension"))
+	}
+	token = strings.TrimSuffix(token, ".ics")
+
+	var user uint32
+	err := db.DB.QueryRowContext(ctx, qUser, token).Scan(&user)
+	if err == sql.ErrNoRows {
+		panic(server.NewHttpError(http.StatusNotFound, "Not found", "Unknown token"))
+	}
+	must(err)
+
+	rows, err := db.DB.QueryContext(ctx, qList, user, user, user)
+	must(err)
+	defer rows.Close()
+
+	now := time.Now()
+	cal := &icalWriter{}
+	cal.Line("BEGIN", "VCALENDAR")
+	cal.Line("VERSION", "2.0")
+	cal.Line("PRODID", "-//Itero//Poll deadlines//EN")
+	cal.Line("CALSCALE", "GREGORIAN")
+	cal.Line("X-WR-CALNAME", "Itero")
+	cal.Line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	cal.Line("X-PUBLISHED-TTL", "PT1H")
+
+	for rows.Next() {
+		var segment salted.Segment
+		var title, state string
+		var round uint8
+		var start, roundDeadline, deadline sql.NullTime
+		must(rows.Scan(&segment.Id, &segment.Salt, &title, &state, &round, &start, &roundDeadline,
+			&deadline))
+		encoded, err := segment.Encode()
+		must(err)
+		event := icalEvent{segment: encoded, stamp: now}
+
+		if state == "Waiting" && start.Valid {
+			event.uid, event.summary, event.date = "start", "Start of "+title, start.Time
+			cal.Event(event)
+		}
+		if state == "Active" && roundDeadline.Valid &&
+			(!deadline.Valid || roundDeadline.Time.Before(deadline.Time)) {
+			event.uid = fmt.Sprintf("round%d", round)
+			event.summary = fmt.Sprintf("End of round %d of %s", round+1, title)
+			event.date = roundDeadline.Time
+			cal.Event(event)
+		}
+		if deadline.Valid {
+			event.uid, event.summary, event.date = "deadline", "Deadline of "+title, deadline.Time
+			cal.Event(event)
+		}
+	}
+	must(rows.Err())
+
+	cal.Line("END", "VCALENDAR")
+	response.SendFile(ctx, "itero.ics", "text/calendar; charset=utf-8", cal.Bytes())
+}
+
+//
+// iCalendar
+//
+
+type icalEvent struct {
+	uid     string // Unique among the events of the poll.
+	segment string
+	summary string
+	date    time.Time
+	stamp   time.Time
+}
+
+// icalWriter produces iCalendar content, as defined by RFC 5545.
+type icalWriter struct {
+	bytes.Buffer
+}
+
+const (
+	icalTimeFormat = "20060102T150405Z"
+	icalLineLength = 75
+)
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalText escapes a value of type TEXT.
+func icalText(value string) string {
+	return icalEscaper.Replace(value)
+}
+
+// Line writes a content line, folded such that no line is longer than 75 octets.
+// The value must already be escaped.
+func (self *icalWriter) Line(name, value string) {
+	line := name + ":" + value
+	first := true
+	for len(line) > 0 {
+		max := icalLineLength
+		if !first {
+			max -= 1
+			self.WriteByte(' ')
+		}
+		cut := len(line)
+		if cut > max {
+			cut = max
+			// Do not split UTF-8 sequences.
+			for cut > 0 && line[cut]&0xC0 == 0x80 {
+				cut -= 1
+			}
+		}
+		self.WriteString(line[:cut])
+		self.WriteString("\r\n")
+		line = line[cut:]
+		first = false
+	}
+}
+
+func (self *icalWriter) Event(event icalEvent) {
+	self.Line("BEGIN", "VEVENT")
+	self.Line("UID", event.uid+"-"+event.segment+"@itero")
+	self.Line("DTSTAMP", event.stamp.UTC().Format(icalTimeFormat))
+	self.Line("DTSTART", event.date.UTC().Format(icalTimeFormat))
+	self.Line("SUMMARY", icalText(event.summary))
+	self.Line("URL", server.BaseURL()+"r/poll/"+event.segment)
+	self.Line("TRANSP", "TRANSPARENT")
+	self.Line("END", "VEVENT")
+}
@@ -0,0 +1,195 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestICalText(t *testing.T) {
+	got := icalText("a\\b;c,d\ne")
+	if expect := `a\\b\;c\,d\ne`; got != expect {
+		t.Errorf("Got %s. Expect %s.", got, expect)
+	}
+}
+
+func TestICalWriter_Line(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "Short", value: "Poll"},
+		{name: "Long", value: strings.Repeat("abcdefghij", 20)},
+		{name: "Multibyte", value: strings.Repeat("é", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cal icalWriter
+			cal.Line("SUMMARY", tt.value)
+			got := cal.String()
+
+			if !strings.HasSuffix(got, "\r\n") {
+				t.Errorf("Missing final CRLF.")
+			}
+			lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > icalLineLength {
+					t.Errorf("Line %d too long: %d octets.", i, len(line))
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("Continuation line %d does not start with a space.", i)
+				}
+			}
+			unfolded := strings.ReplaceAll(strings.TrimSuffix(got, "\r\n"), "\r\n ", "")
+			if expect := "SUMMARY:" + tt.value; unfolded != expect {
+				t.Errorf("Wrong unfolded line. Got %s. Expect %s.", unfolded, expect)
+			}
+		})
+	}
+}
+
+func TestCalendarHandlers(t *testing.T) {
+	precheck(t)
+
+	const (
+		qWaiting = `
+		  UPDATE Polls SET State = 'Waiting', Start = CURRENT_TIMESTAMP + INTERVAL 1 DAY WHERE Id = ?`
+		qActive = `
+		  UPDATE Polls SET CurrentRoundStart = CURRENT_TIMESTAMP,
+		                   Deadline = CURRENT_TIMESTAMP + INTERVAL 7 DAY
+		   WHERE Id = ?`
+	)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUserWith("Calendar")
+	otherId := env.CreateUserWith("CalendarOther")
+	waiting := env.CreatePoll("Calendar Waiting", userId, db.ElectorateAll)
+	active := env.CreatePoll("Calendar Active", otherId, db.ElectorateAll)
+	hidden := env.CreatePoll("Calendar Hidden", otherId, db.ElectorateAll)
+	env.QuietExec(qWaiting, waiting)
+	env.QuietExec(qActive, active)
+	env.QuietExec(qActive, hidden)
+	env.Vote(active, 0, userId, 0)
+	env.Must(t)
+
+	var token string
+	tokenChecker := func(changed bool) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+			var answer CalendarTokenAnswer
+			mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+			if len(answer.Token) != 2*calendarTokenBytes {
+				t.Errorf("Wrong token %s.", answer.Token)
+			}
+			if token != "" && (answer.Token != token) == !changed {
+				t.Errorf("Token changed: %t. Expect %t.", answer.Token != token, changed)
+			}
+			token = answer.Token
+		})
+	}
+
+	t.Run("Token", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: srvt.Request{},
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			},
+			&srvt.T{
+				Name:    "Create",
+				Request: srvt.Request{UserId: &userId},
+				Checker: tokenChecker(false),
+			},
+			&srvt.T{
+				Name:    "Same",
+				Request: srvt.Request{UserId: &userId},
+				Checker: tokenChecker(false),
+			},
+		}, CalendarTokenHandler)
+	})
+	if token == "" {
+		t.Fatal("No token.")
+	}
+	oldToken := token
+
+	t.Run("Reset", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId, Method: "POST"},
+				Checker: tokenChecker(true),
+			},
+		}, CalendarTokenResetHandler)
+	})
+
+	target := func(token string) *string {
+		ret := "/a/test/" + token + ".ics"
+		return &ret
+	}
+	feedChecker := srvt.CheckerFun(func(t *testing.T, response *http.Response,
+		request *server.Request) {
+
+		srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+		body, err := ioutil.ReadAll(response.Body)
+		mustt(t, err)
+		got := strings.ReplaceAll(string(body), "\r\n ", "")
+		for _, expect := range []string{
+			"BEGIN:VCALENDAR\r\n",
+			"SUMMARY:Start of Calendar Waiting\r\n",
+			"SUMMARY:End of round 1 of Calendar Active\r\n",
+			"SUMMARY:Deadline of Calendar Active\r\n",
+			"END:VCALENDAR\r\n",
+		} {
+			if !strings.Contains(got, expect) {
+				t.Errorf("Missing %q in %s.", expect, got)
+			}
+		}
+		if strings.Contains(got, "Calendar Hidden") {
+			t.Errorf("Unrelated poll in %s.", got)
+		}
+	})
+
+	t.Run("Feed", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Old token",
+				Request: srvt.Request{Target: target(oldToken)},
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "Not found"},
+			},
+			&srvt.T{
+				Name:    "No extension",
+				Request: srvt.Request{Target: target(token + "/x")},
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "Not found"},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{Target: target(token)},
+				Checker: feedChecker,
+			},
+		}, CalendarHandler)
+	})
+}
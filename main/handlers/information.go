@@ -0,0 +1,160 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/JBoudou/Itero/mid/outcome"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/rules"
+)
+
+// checkInformationAccess ensures that the user can access the poll and that the information policy
+// of the poll allows to send information of the given type.
+// Errors are sent by panic.
+func checkInformationAccess(ctx context.Context, request *server.Request, infoType InformationType) (
+	pollInfo PollInfo) {
+
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+	if !pollInfo.AllowsInformation(infoType) {
+		panic(server.NewHttpError(http.StatusForbidden, "Hidden information",
+			"The poll does not provide this information"))
+	}
+	return
+}
+
+// checkInformationRequest does all the verifications common to information handlers and returns
+// the information on the poll together with the requested round.
+// Errors are sent by panic.
+func checkInformationRequest(ctx context.Context, request *server.Request, infoType InformationType) (
+	pollInfo PollInfo, round uint8) {
+
+	pollInfo = checkInformationAccess(ctx, request, infoType)
+
+	// Get the round to return results of.
+	round = getPollRoundFromRequest(request, pollInfo.CurrentRound-1)
+	if round >= pollInfo.CurrentRound {
+		panic(server.NewHttpError(http.StatusBadRequest, "Protocol error", "No result for this round"))
+	}
+	return
+}
+
+//
+// Winner
+//
+
+type WinnerInfoAnswer struct {
+	Winners []PollAlternative
+}
+
+// WinnerInfoHandler sends the winners of a previous round, according to the rule of the poll.
+func WinnerInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeWinner)
+	result, err := outcome.Compute(ctx, pollInfo.Id, round)
+	must(err)
+
+	var alternatives []PollAlternative
+	allAlternatives(ctx, pollInfo, &alternatives)
+
+	answer := WinnerInfoAnswer{Winners: make([]PollAlternative, len(result.Winners))}
+	for i, alt := range result.Winners {
+		answer.Winners[i] = alternatives[alt]
+	}
+	response.SendJSON(ctx, answer)
+}
+
+//
+// Ranking
+//
+
+// RankingInfoAnswer lists all the alternatives from the best to the worst, without their scores.
+type RankingInfoAnswer struct {
+	Ranking []PollAlternative
+}
+
+// RankingInfoHandler sends the ranking of the alternatives at a previous round, according to the
+// rule of the poll.
+func RankingInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeRanking)
+	result, err := outcome.Compute(ctx, pollInfo.Id, round)
+	must(err)
+
+	var alternatives []PollAlternative
+	allAlternatives(ctx, pollInfo, &alternatives)
+
+	answer := RankingInfoAnswer{Ranking: make([]PollAlternative, len(result.Ranking))}
+	for i, alt := range result.Ranking {
+		answer.Ranking[i] = alternatives[alt]
+	}
+	response.SendJSON(ctx, answer)
+}
+
+//
+// Matrix
+//
+
+// MatrixInfoAnswer contains the pairwise majority matrix of a round.
+// Matrix[a][b] is the number of participants preferring alternative a to alternative b.
+type MatrixInfoAnswer struct {
+	Alternatives []PollAlternative
+	Matrix       [][]float64
+}
+
+// MatrixInfoHandler sends the pairwise majority matrix of a previous round.
+func MatrixInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeMatrix)
+	profile, err := outcome.LoadProfile(ctx, pollInfo.Id, round)
+	must(err)
+
+	var answer MatrixInfoAnswer
+	answer.Matrix = rules.NewMatrix(profile)
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+	response.SendJSON(ctx, answer)
+}
+
+//
+// Trends
+//
+
+// TrendsInfoAnswer contains the scores of the alternatives for all rounds up to the requested one.
+// Scores[r][a] is the score of alternative a at round r, according to the rule of the poll.
+type TrendsInfoAnswer struct {
+	Alternatives []PollAlternative
+	Scores       [][]float64
+}
+
+// TrendsInfoHandler sends the evolution of the scores of the alternatives, from the first round to
+// a previous round.
+func TrendsInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeTrends)
+
+	rule, err := outcome.LoadRule(ctx, pollInfo.Id)
+	must(err)
+	profiles, err := outcome.LoadProfiles(ctx, pollInfo.Id, round+1)
+	must(err)
+
+	var answer TrendsInfoAnswer
+	answer.Scores = make([][]float64, len(profiles))
+	for r, profile := range profiles {
+		answer.Scores[r] = rule.Outcome(profile).Scores
+	}
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+	response.SendJSON(ctx, answer)
+}
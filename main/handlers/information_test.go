@@ -0,0 +1,178 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+var (
+	infoTestAlternatives = []string{"Ham", "Stram", "Gram"}
+	infoTestAnswers      = []PollAlternative{
+		{Id: 0, Name: "Ham", Cost: 1},
+		{Id: 1, Name: "Stram", Cost: 1},
+		{Id: 2, Name: "Gram", Cost: 1},
+	}
+	infoTestVotes = []pollTestVote{{2, 0, 0}, {3, 0, 0}, {4, 0, 2}}
+)
+
+func infoTestHidden() srvt.Checker {
+	return srvt.CheckError{Code: http.StatusForbidden, Body: "Hidden information"}
+}
+
+func TestWinnerInfoHandler(t *testing.T) {
+	precheck(t)
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:         "Winner",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationWinner,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker: srvt.CheckJSON{Body: WinnerInfoAnswer{
+				Winners: []PollAlternative{infoTestAnswers[0]},
+			}},
+		},
+		&pollTest{
+			Name:         "Counts",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker: srvt.CheckJSON{Body: WinnerInfoAnswer{
+				Winners: []PollAlternative{infoTestAnswers[0]},
+			}},
+		},
+		&pollTest{
+			Name:         "Matrix",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationMatrix,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker:      infoTestHidden(),
+		},
+		&pollTest{
+			Name:         "Round zero",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationWinner,
+			UserType:     pollTestUserTypeLogged,
+			Checker:      srvt.CheckError{Code: http.StatusBadRequest, Body: "Protocol error"},
+		},
+	}
+	srvt.RunFunc(t, tests, WinnerInfoHandler)
+}
+
+func TestRankingInfoHandler(t *testing.T) {
+	precheck(t)
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:         "Ranking",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationRanking,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker: srvt.CheckJSON{Body: RankingInfoAnswer{
+				Ranking: []PollAlternative{infoTestAnswers[0], infoTestAnswers[2], infoTestAnswers[1]},
+			}},
+		},
+		&pollTest{
+			Name:         "Winner",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationWinner,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker:      infoTestHidden(),
+		},
+	}
+	srvt.RunFunc(t, tests, RankingInfoHandler)
+}
+
+func TestMatrixInfoHandler(t *testing.T) {
+	precheck(t)
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:         "Matrix",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationMatrix,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker: srvt.CheckJSON{Body: MatrixInfoAnswer{
+				Alternatives: infoTestAnswers,
+				Matrix:       [][]float64{{0, 2, 2}, {0, 0, 0}, {1, 1, 0}},
+			}},
+		},
+		&pollTest{
+			Name:         "Counts",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker:      infoTestHidden(),
+		},
+	}
+	srvt.RunFunc(t, tests, MatrixInfoHandler)
+}
+
+func TestTrendsInfoHandler(t *testing.T) {
+	precheck(t)
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:         "Trends",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			Information:  db.InformationTrends,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         append([]pollTestVote{{2, 1, 1}}, infoTestVotes...),
+			Round:        2,
+			Checker: srvt.CheckJSON{Body: TrendsInfoAnswer{
+				Alternatives: infoTestAnswers,
+				Scores:       [][]float64{{2, 0, 1}, {0, 1, 0}},
+			}},
+		},
+		&pollTest{
+			Name:         "Counts",
+			Electorate:   db.ElectorateAll,
+			Alternatives: infoTestAlternatives,
+			UserType:     pollTestUserTypeLogged,
+			Vote:         infoTestVotes,
+			Round:        1,
+			Checker:      infoTestHidden(),
+		},
+	}
+	srvt.RunFunc(t, tests, TrendsInfoHandler)
+}
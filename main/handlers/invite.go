@@ -0,0 +1,152 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+// InviteQuery is the body of invitation requests.
+type InviteQuery struct {
+	Emails []string
+}
+
+// InviteAnswer lists the addresses that have actually been invited by a request. Addresses that
+// were already invited to the poll are not listed.
+type InviteAnswer struct {
+	Invited []string
+}
+
+var inviteEmailRegexp = regexp.MustCompile("^[^\\s@]+@[^\\s.]+\\.\\S\\S+$")
+
+// checkInvited ensures that the user has been invited to the poll, or is its administrator.
+func checkInvited(ctx context.Context, pollId uint32, user *server.User) (err error) {
+	if user == nil {
+		return server.NewHttpError(http.StatusForbidden, "Not invited", "No user")
+	}
+
+	const qInvited = `
+	  SELECT 1 FROM Invitations WHERE Poll = ? AND User = ?
+	   UNION ALL
+	  SELECT 1 FROM Polls WHERE Id = ? AND Admin = ?`
+	rows, err := db.DB.QueryContext(ctx, qInvited, pollId, user.Id, pollId, user.Id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = server.NewHttpError(http.StatusForbidden, "Not invited", "Invitation required")
+	}
+	return
+}
+
+type inviteHandler struct {
+	evtManager events.Manager
+}
+
+// InviteHandler adds email addresses to the invitation list of a poll whose electorate is Invited.
+// Addresses of registered users are bound to their account. A pseudo-user is created for each
+// other address. An invitation email is sent to each new invitee.
+func InviteHandler(evtManager events.Manager) inviteHandler {
+	return inviteHandler{evtManager: evtManager}
+}
+
+func (self inviteHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	const (
+		qExists = `SELECT 1 FROM Invitations WHERE Poll = ? AND Email = ?`
+		qUser   = `SELECT Id FROM Users WHERE Email = ?`
+		qPseudo = `INSERT INTO Users (Email) VALUE (NULL)`
+		qInvite = `INSERT INTO Invitations (Poll, Email, User) VALUE (?, ?, ?)`
+	)
+
+	var query InviteQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if len(query.Emails) == 0 {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "No email"))
+	}
+	emails := make([]string, 0, len(query.Emails))
+	seen := make(map[string]bool, len(query.Emails))
+	for _, email := range query.Emails {
+		email = strings.TrimSpace(email)
+		if seen[email] {
+			continue
+		}
+		if !inviteEmailRegexp.MatchString(email) {
+			panic(server.NewHttpError(http.StatusBadRequest, "Email invalid", "Wrong email format"))
+		}
+		seen[email] = true
+		emails = append(emails, email)
+	}
+
+	var answer InviteAnswer
+	var users []uint32
+	states := []db.State{db.StateWaiting, db.StateActive, db.StatePaused}
+	poll := controlPoll(ctx, request, states, func(tx *sql.Tx, poll controlledPoll) {
+		if poll.Electorate != db.ElectorateInvited {
+			panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Electorate is not Invited"))
+		}
+
+		answer.Invited = make([]string, 0, len(emails))
+		users = make([]uint32, 0, len(emails))
+		for _, email := range emails {
+			rows, err := tx.QueryContext(ctx, qExists, poll.Id, email)
+			must(err)
+			exists := rows.Next()
+			rows.Close()
+			if exists {
+				continue
+			}
+
+			var user uint32
+			rows, err = tx.QueryContext(ctx, qUser, email)
+			must(err)
+			registered := rows.Next()
+			if registered {
+				err = rows.Scan(&user)
+			}
+			rows.Close()
+			must(err)
+			if !registered {
+				result, err := tx.ExecContext(ctx, qPseudo)
+				must(err)
+				user, err = db.IdFromResult(result)
+				must(err)
+			}
+
+			_, err = tx.ExecContext(ctx, qInvite, poll.Id, email, user)
+			must(err)
+			answer.Invited = append(answer.Invited, email)
+			users = append(users, user)
+		}
+	})
+
+	response.SendJSON(ctx, answer)
+	for _, user := range users {
+		self.evtManager.Send(services.InviteEvent{Poll: poll.Id, User: user})
+	}
+}
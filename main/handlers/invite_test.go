@@ -0,0 +1,165 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+func inviteTestRequest(body string) srvt.Request {
+	return srvt.Request{Method: "POST", Body: body}
+}
+
+func inviteTestEventPredicate(param PollTestCheckerFactoryParam, evt events.Event) bool {
+	converted, ok := evt.(services.InviteEvent)
+	return ok && converted.Poll == param.PollId
+}
+
+func TestInviteHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	const (
+		newEmail = "invite.handler@example.test"
+		oldEmail = "TestInviteHandler/Already@example.com"
+	)
+	adminEmail := dbt.UserEmailWith("TestInviteHandler/Success")
+
+	successChecker := func(param PollTestCheckerFactoryParam) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckJSON{Body: InviteAnswer{Invited: []string{newEmail, adminEmail}}}.
+				Check(t, response, request)
+
+			const qCheck = `
+			  SELECT i.User, u.Name, u.Hash
+			    FROM Invitations AS i JOIN Users AS u ON i.User = u.Id
+			   WHERE i.Poll = ? AND i.Email = ?`
+			var user uint32
+			var name sql.NullString
+			var hash []byte
+			mustt(t, db.DB.QueryRow(qCheck, param.PollId, adminEmail).Scan(&user, &name, &hash))
+			if user != param.UserId {
+				t.Errorf("Registered invitee bound to user %d. Expect %d.", user, param.UserId)
+			}
+			mustt(t, db.DB.QueryRow(qCheck, param.PollId, newEmail).Scan(&user, &name, &hash))
+			if name.Valid || hash != nil {
+				t.Errorf("Invitee %d is not a pseudo-user.", user)
+			}
+		})
+	}
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Not logged",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeNone,
+			Request:    inviteTestRequest(`{"Emails": ["` + newEmail + `"]}`),
+			Checker:    srvt.CheckStatus{Code: http.StatusForbidden},
+		},
+		&pollTest{
+			Name:       "Not admin",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeLogged,
+			Request:    inviteTestRequest(`{"Emails": ["` + newEmail + `"]}`),
+			Checker:    srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+		&pollTest{
+			Name:       "Wrong electorate",
+			Electorate: db.ElectorateLogged,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    inviteTestRequest(`{"Emails": ["` + newEmail + `"]}`),
+			Checker:    srvt.CheckStatus{Code: http.StatusBadRequest},
+		},
+		&pollTest{
+			Name:       "Wrong email",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeAdmin,
+			Request:    inviteTestRequest(`{"Emails": ["not an email"]}`),
+			Checker:    srvt.CheckError{Code: http.StatusBadRequest, Body: "Email invalid"},
+		},
+		&pollTest{
+			Name:           "Already",
+			Electorate:     db.ElectorateInvited,
+			UserType:       pollTestUserTypeAdmin,
+			Invited:        true,
+			Request:        inviteTestRequest(`{"Emails": ["` + oldEmail + `"]}`),
+			Checker:        srvt.CheckJSON{Body: InviteAnswer{Invited: []string{}}},
+			EventPredicate: inviteTestEventPredicate,
+			EventCount:     0,
+		},
+		&pollTest{
+			Name:           "Success",
+			Electorate:     db.ElectorateInvited,
+			UserType:       pollTestUserTypeAdmin,
+			Request:        inviteTestRequest(`{"Emails": ["` + newEmail + `", " ` + adminEmail + ` "]}`),
+			Checker:        pollTestCheckerFactory(successChecker),
+			EventPredicate: inviteTestEventPredicate,
+			EventCount:     2,
+		},
+	}
+	srvt.Run(t, tests, InviteHandler)
+}
+
+func TestCheckPollAccess_Invited(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Unlogged",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeNone,
+			Checker:    srvt.CheckError{Code: http.StatusForbidden, Body: "Not invited"},
+		},
+		&pollTest{
+			Name:       "Logged not invited",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeLogged,
+			Checker:    srvt.CheckError{Code: http.StatusForbidden, Body: "Not invited"},
+		},
+		&pollTest{
+			Name:       "Admin",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeAdmin,
+			Checker:    srvt.CheckStatus{Code: http.StatusOK},
+		},
+		&pollTest{
+			Name:       "Logged invited",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeLogged,
+			Invited:    true,
+			Checker:    srvt.CheckStatus{Code: http.StatusOK},
+		},
+		&pollTest{
+			Name:       "Unlogged invited",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeUnlogged,
+			Invited:    true,
+			Checker:    srvt.CheckStatus{Code: http.StatusOK},
+		},
+	}
+	srvt.RunFunc(t, tests, PollHandler)
+}
@@ -19,7 +19,6 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"net/http"
 
 	"github.com/JBoudou/Itero/mid/db"
 	"github.com/JBoudou/Itero/mid/salted"
@@ -73,16 +72,13 @@ type listAnswerEntry struct {
 	Launchable   bool `json:",omitempty"`
 }
 
-// ListHandler lists the available polls.
-func ListHandler(ctx context.Context, response server.Response, request *server.Request) {
-	if request.User == nil {
-		// TODO change that
-		response.SendError(ctx, server.NewHttpError(http.StatusNotImplemented, "Unimplemented", ""))
-		return
-	}
-
-	const (
-		qPublic = `
+// listPublicQuery selects the polls, not administrated by the user, that the user participates in
+// or can participate in. listOwnQuery selects the polls administrated by the user. Both queries
+// must be given the id of the user twice. listUnloggedQuery selects the polls an unlogged user
+// participates in or can participate in. It must be given the id of the user once, or zero for
+// anonymous visitors. All queries select the columns scanned by makeListEntriesList.
+const (
+	listPublicQuery = `
 	    SELECT p.Id, p.Salt, p.Title, p.CurrentRound, p.MaxNbRounds,
 	           RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline,
 	                         p.CurrentRound, p.MinNbRounds) AS Deadline,
@@ -99,11 +95,13 @@ func ListHandler(ctx context.Context, response server.Response, request *server.
 	               GROUP BY Poll
 	           ) AS a ON p.Id = a.Poll, Users AS u
 	     WHERE ( (p.State != 'Waiting' AND p.CurrentRound = 0 AND NOT p.Hidden AND
-		 							(u.Verified OR p.Electorate != 'Verified'))
+		 							(u.Verified OR p.Electorate != 'Verified') AND p.Electorate != 'Invited')
+	              OR (p.State != 'Waiting' AND p.CurrentRound = 0 AND
+	                  EXISTS (SELECT 1 FROM Invitations AS i WHERE i.Poll = p.Id AND i.User = u.Id))
 	              OR a.Poll IS NOT NULL )
-	       AND u.Id = ? AND p.Admin != u.Id
-	     ORDER BY Action ASC, Deadline ASC`
-		qOwn = `
+	       AND u.Id = ? AND p.Admin != u.Id`
+
+	listOwnQuery = `
 	    SELECT p.Id, p.Salt, p.Title, p.CurrentRound, p.MaxNbRounds,
 	           CASE WHEN p.State = 'Waiting' THEN p.Start
 	                ELSE RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline,
@@ -124,23 +122,64 @@ func ListHandler(ctx context.Context, response server.Response, request *server.
 	               WHERE User = ?
 	               GROUP BY Poll
 	           ) AS a ON p.Id = a.Poll
-	     WHERE p.Admin = ?
-	     ORDER BY Action ASC, Deadline ASC`
-	)
+	     WHERE p.Admin = ?`
 
-	var publicList []listAnswerEntry
-	rows, err := db.DB.QueryContext(ctx, qPublic, request.User.Id, request.User.Id)
-	must(err)
-	publicList, err = makeListEntriesList(rows)
-	must(err)
+	listUnloggedQuery = `
+	    SELECT p.Id, p.Salt, p.Title, p.CurrentRound, p.MaxNbRounds,
+	           RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline,
+	                         p.CurrentRound, p.MinNbRounds) AS Deadline,
+	           CASE WHEN p.State = 'Terminated' THEN 3
+	                WHEN a.Poll IS NULL THEN 2
+	                WHEN a.LastRound >= p.CurrentRound THEN 1
+	                ELSE 0 END AS Action,
+	           FALSE AS Deletable,
+	           FALSE AS Launchable
+	      FROM Polls AS p LEFT OUTER JOIN (
+	               SELECT Poll, MAX(Round) AS LastRound
+	                FROM Participants
+	               WHERE User = ?
+	               GROUP BY Poll
+	           ) AS a ON p.Id = a.Poll
+	     WHERE (p.State = 'Active' AND p.CurrentRound = 0 AND NOT p.Hidden AND p.Electorate = 'All')
+	           OR a.Poll IS NOT NULL`
+)
 
-	var ownList []listAnswerEntry
-	rows, err = db.DB.QueryContext(ctx, qOwn, request.User.Id, request.User.Id)
-	must(err)
-	ownList, err = makeListEntriesList(rows)
-	must(err)
+// listBaseQuery returns the query listing either the public or the own polls of the user, with its
+// arguments. Unlogged users and anonymous visitors, for which user is nil, have no own polls.
+func listBaseQuery(user *server.User, own bool) (query string, args []interface{}) {
+	switch {
+	case user != nil && user.Logged && own:
+		return listOwnQuery, []interface{}{user.Id, user.Id}
+	case user != nil && user.Logged:
+		return listPublicQuery, []interface{}{user.Id, user.Id}
+	case own:
+		return "", nil
+	case user != nil:
+		return listUnloggedQuery, []interface{}{user.Id}
+	default:
+		return listUnloggedQuery, []interface{}{0}
+	}
+}
+
+// ListHandler lists the available polls. Unlogged users and anonymous visitors receive only the
+// public polls they participate in or can participate in.
+func ListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	const order = `
+	     ORDER BY Action ASC, Deadline ASC`
+
+	makeList := func(own bool) (list []listAnswerEntry) {
+		query, args := listBaseQuery(request.User, own)
+		if query == "" {
+			return []listAnswerEntry{}
+		}
+		rows, err := db.DB.QueryContext(ctx, query+order, args...)
+		must(err)
+		list, err = makeListEntriesList(rows)
+		must(err)
+		return
+	}
 
-	response.SendJSON(ctx, ListAnswer{Public: publicList, Own: ownList})
+	response.SendJSON(ctx, ListAnswer{Public: makeList(false), Own: makeList(true)})
 }
 
 func makeListEntriesList(rows *sql.Rows) (list []listAnswerEntry, err error) {
@@ -163,9 +163,8 @@ func TestListHandler(t *testing.T) {
 		// TODO make them all independent
 
 		&srvt.T{
-			Name: "No session",
-			// TODO fix this test once implemented
-			Checker: srvt.CheckStatus{http.StatusNotImplemented},
+			Name:    "No session",
+			Checker: listChecker{},
 		},
 		&srvt.T{
 			Name: "PublicRegistered Poll",
@@ -300,6 +299,52 @@ func TestListHandler(t *testing.T) {
 			Checker: listCheckFactory(listCheckFactoryKindOwn,
 				listCheckerEntry{action: PollActionWait, deletable: true, launchable: true}),
 		},
+		&pollTest{
+			Name:       "anonymous public",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeNone,
+			Checker:    listCheckFactory(listCheckFactoryKindPublic, listCheckerEntry{action: PollActionPart}),
+		},
+		&pollTest{
+			Name:       "anonymous hidden",
+			Electorate: db.ElectorateAll,
+			Hidden:     true,
+			UserType:   pollTestUserTypeNone,
+			Checker:    listCheckFactory(listCheckFactoryKindNone, listCheckerEntry{action: PollActionPart}),
+		},
+		&pollTest{
+			Name:       "anonymous poll logged",
+			Electorate: db.ElectorateLogged,
+			UserType:   pollTestUserTypeNone,
+			Checker:    listCheckFactory(listCheckFactoryKindNone, listCheckerEntry{action: PollActionPart}),
+		},
+		&pollTest{
+			Name:       "anonymous waiting",
+			Electorate: db.ElectorateAll,
+			Waiting:    true,
+			UserType:   pollTestUserTypeNone,
+			Checker:    listCheckFactory(listCheckFactoryKindNone, listCheckerEntry{action: PollActionWait}),
+		},
+		&pollTest{
+			Name:       "unlogged public",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeUnlogged,
+			Checker:    listCheckFactory(listCheckFactoryKindPublic, listCheckerEntry{action: PollActionPart}),
+		},
+		&pollTest{
+			Name:        "unlogged hidden participate",
+			Electorate:  db.ElectorateAll,
+			Hidden:      true,
+			Participate: []pollTestParticipate{{1, 0}},
+			UserType:    pollTestUserTypeUnlogged,
+			Checker:     listCheckFactory(listCheckFactoryKindPublic, listCheckerEntry{action: PollActionModif}),
+		},
+		&pollTest{
+			Name:       "unlogged poll logged",
+			Electorate: db.ElectorateLogged,
+			UserType:   pollTestUserTypeUnlogged,
+			Checker:    listCheckFactory(listCheckFactoryKindNone, listCheckerEntry{action: PollActionPart}),
+		},
 	}
 
 	srvt.RunFunc(t, tests, ListHandler)
@@ -0,0 +1,216 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// ListQuery selects one page of either the public or the own list of polls, as sent by ListHandler.
+// Polls are sorted as by ListHandler. Cursor is empty for the first page, and is the Next value of
+// the previous answer for the following pages. Limit is the maximal number of polls in the page.
+//
+// All other fields are filters. Empty filters are ignored. Admin is the name of the administrator.
+// After and Before bound the Deadline of the polls, excluding polls without deadline. Search is
+// a full-text search on the title and the description of the polls.
+type ListQuery struct {
+	Own    bool
+	Cursor string `json:",omitempty"`
+	Limit  uint8  `json:",omitempty"`
+
+	States      []db.State      `json:",omitempty"`
+	Actions     []PollAction    `json:",omitempty"`
+	Electorates []db.Electorate `json:",omitempty"`
+	Admin       string          `json:",omitempty"`
+	After       time.Time       `json:",omitempty"`
+	Before      time.Time       `json:",omitempty"`
+	Search      string          `json:",omitempty"`
+}
+
+// ListQueryAnswer is a page of polls. Next is the cursor of the next page. It is empty if there is
+// no more poll.
+type ListQueryAnswer struct {
+	Polls []listAnswerEntry
+	Next  string `json:",omitempty"`
+}
+
+const (
+	listDefaultLimit = 20
+	listMaxLimit     = 100
+)
+
+// listCursor is the position of a poll in the list. It is sent encoded to the client.
+// Deadline is listNoDeadline for polls without deadline.
+type listCursor struct {
+	Action   PollAction
+	Deadline time.Time
+	Id       uint32
+}
+
+// listNoDeadline replaces NULL deadlines in comparisons. It is before all actual deadlines,
+// as NULL values are sorted first.
+var listNoDeadline = time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func (self listCursor) encode() (string, error) {
+	raw, err := json.Marshal(self)
+	return base64.RawURLEncoding.EncodeToString(raw), err
+}
+
+func decodeListCursor(str string) (ret listCursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(str)
+	if err == nil {
+		err = json.Unmarshal(raw, &ret)
+	}
+	return
+}
+
+// listSearchTerms converts a search string into a full-text query in boolean mode, requiring all
+// words, possibly as prefixes. Operators are removed from the search string.
+func listSearchTerms(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = "+" + word + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// listFilter accumulates conditions on the columns of the list queries (with alias l) and of the
+// polls (with alias p).
+type listFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (self *listFilter) add(condition string, args ...interface{}) {
+	self.conditions = append(self.conditions, condition)
+	self.args = append(self.args, args...)
+}
+
+func (self *listFilter) in(column string, values []interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	self.add(column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")", values...)
+}
+
+// ListQueryHandler sends a page of the list of polls, possibly filtered. As for ListHandler,
+// unlogged users and anonymous visitors have no own polls.
+func ListQueryHandler(ctx context.Context, response server.Response, request *server.Request) {
+	must(request.CheckPOST(ctx))
+
+	var query ListQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if query.Limit == 0 {
+		query.Limit = listDefaultLimit
+	} else if query.Limit > listMaxLimit {
+		query.Limit = listMaxLimit
+	}
+
+	filter := listFilter{}
+	if query.Cursor != "" {
+		cursor, err := decodeListCursor(query.Cursor)
+		if err != nil {
+			panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+		}
+		filter.add("(l.Action, IFNULL(l.Deadline, ?), l.Id) > (?, ?, ?)",
+			listNoDeadline, cursor.Action, cursor.Deadline, cursor.Id)
+	}
+	values := make([]interface{}, 0, 4)
+	for _, state := range query.States {
+		values = append(values, state)
+	}
+	filter.in("p.State", values)
+	values = values[:0]
+	for _, action := range query.Actions {
+		values = append(values, action)
+	}
+	filter.in("l.Action", values)
+	values = values[:0]
+	for _, electorate := range query.Electorates {
+		values = append(values, electorate)
+	}
+	filter.in("p.Electorate", values)
+	if query.Admin != "" {
+		filter.add("p.Admin = (SELECT u.Id FROM Users AS u WHERE u.Name = ?)", query.Admin)
+	}
+	if !query.After.IsZero() {
+		filter.add("l.Deadline >= ?", query.After)
+	}
+	if !query.Before.IsZero() {
+		filter.add("l.Deadline < ?", query.Before)
+	}
+	if terms := listSearchTerms(query.Search); terms != "" {
+		filter.add("MATCH (p.Title, p.Description) AGAINST (? IN BOOLEAN MODE)", terms)
+	}
+
+	base, baseArgs := listBaseQuery(request.User, query.Own)
+	if base == "" {
+		response.SendJSON(ctx, ListQueryAnswer{Polls: []listAnswerEntry{}})
+		return
+	}
+	where := ""
+	if len(filter.conditions) > 0 {
+		where = "\n\t   WHERE " + strings.Join(filter.conditions, "\n\t     AND ")
+	}
+	qList := `
+	  SELECT l.Id, l.Salt, l.Title, l.CurrentRound, l.MaxNbRounds, l.Deadline, l.Action,
+	         l.Deletable, l.Launchable
+	    FROM (` + base + `) AS l
+	    JOIN Polls AS p ON l.Id = p.Id` + where + `
+	   ORDER BY l.Action ASC, IFNULL(l.Deadline, ?) ASC, l.Id ASC
+	   LIMIT ?`
+
+	args := make([]interface{}, 0, len(baseArgs)+len(filter.args)+2)
+	args = append(args, baseArgs...)
+	args = append(args, filter.args...)
+	args = append(args, listNoDeadline, int(query.Limit)+1)
+
+	rows, err := db.DB.QueryContext(ctx, qList, args...)
+	must(err)
+	list, err := makeListEntriesList(rows)
+	must(err)
+
+	answer := ListQueryAnswer{Polls: list}
+	if len(list) > int(query.Limit) {
+		answer.Polls = list[:query.Limit]
+		last := answer.Polls[query.Limit-1]
+		segment, err := salted.Decode(last.Segment)
+		must(err)
+		cursor := listCursor{Action: last.Action, Deadline: listNoDeadline, Id: segment.Id}
+		if last.Deadline.Valid {
+			cursor.Deadline = last.Deadline.Time
+		}
+		answer.Next, err = cursor.encode()
+		must(err)
+	}
+
+	response.SendJSON(ctx, answer)
+}
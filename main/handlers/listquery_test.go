@@ -0,0 +1,198 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestListCursor(t *testing.T) {
+	cursor := listCursor{
+		Action:   PollActionPart,
+		Deadline: time.Date(2021, time.March, 4, 12, 30, 0, 0, time.UTC),
+		Id:       42,
+	}
+	encoded, err := cursor.encode()
+	mustt(t, err)
+	got, err := decodeListCursor(encoded)
+	mustt(t, err)
+	if got != cursor {
+		t.Errorf("Got %v. Expect %v.", got, cursor)
+	}
+
+	if _, err := decodeListCursor("not a cursor"); err == nil {
+		t.Errorf("Expect an error.")
+	}
+}
+
+func TestListSearchTerms(t *testing.T) {
+	tests := []struct {
+		search string
+		expect string
+	}{
+		{search: "", expect: ""},
+		{search: "  ", expect: ""},
+		{search: "lunch", expect: "+lunch*"},
+		{search: "best  lunch", expect: "+best* +lunch*"},
+		{search: `-"lunch" >place<`, expect: "+lunch* +place*"},
+		{search: "déjeuner 2021", expect: "+déjeuner* +2021*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if got := listSearchTerms(tt.search); got != tt.expect {
+				t.Errorf("Got %s. Expect %s.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestListQueryHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	const adminSalt = "ListQueryAdmin"
+	userId := env.CreateUserWith("ListQuery")
+	adminId := env.CreateUserWith(adminSalt)
+	env.CreatePoll("ListQuery lunch", adminId, db.ElectorateAll)
+	env.CreatePoll("ListQuery dinner", adminId, db.ElectorateAll)
+	env.CreatePoll("ListQuery breakfast", adminId, db.ElectorateAll)
+	env.Must(t)
+
+	makeRequest := func(user *uint32, query ListQuery) srvt.Request {
+		encoded, err := json.Marshal(query)
+		mustt(t, err)
+		return srvt.Request{UserId: user, Method: "POST", Body: string(encoded)}
+	}
+
+	// Retrieves all pages and returns the titles of the polls.
+	fetchAll := func(t *testing.T, user *uint32, query ListQuery) (titles map[string]bool) {
+		titles = make(map[string]bool)
+		for page, more := 0, true; more; page++ {
+			checker := srvt.CheckerFun(func(t *testing.T, response *http.Response,
+				request *server.Request) {
+
+				srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+				var answer ListQueryAnswer
+				mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+				if len(answer.Polls) > int(query.Limit) {
+					t.Errorf("Too many polls. Got %d. Expect at most %d.",
+						len(answer.Polls), query.Limit)
+				}
+				for _, entry := range answer.Polls {
+					if titles[entry.Title] {
+						t.Errorf("Duplicate %s.", entry.Title)
+					}
+					titles[entry.Title] = true
+				}
+				query.Cursor = answer.Next
+			})
+			request := makeRequest(user, query)
+			srvt.RunFunc(t, []srvt.Test{&srvt.T{
+				Name:    "Page",
+				Request: request,
+				Checker: checker,
+			}}, ListQueryHandler)
+			more = query.Cursor != ""
+			if page > 3 {
+				t.Fatalf("Too many pages.")
+			}
+		}
+		return
+	}
+
+	adminName := dbt.UserNameWith(adminSalt)
+	all := map[string]bool{"ListQuery lunch": true, "ListQuery dinner": true,
+		"ListQuery breakfast": true}
+
+	t.Run("Errors", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Wrong cursor",
+				Request: makeRequest(&userId, ListQuery{Cursor: "wrong"}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+		}, ListQueryHandler)
+	})
+
+	tests := []struct {
+		name      string
+		anonymous bool
+		query     ListQuery
+		expect    map[string]bool
+	}{
+		{
+			name:   "Pages",
+			query:  ListQuery{Admin: adminName, Limit: 2},
+			expect: all,
+		},
+		{
+			name:   "Single page",
+			query:  ListQuery{Admin: adminName, Limit: 3},
+			expect: all,
+		},
+		{
+			name:   "Own",
+			query:  ListQuery{Own: true, Admin: adminName, Limit: 3},
+			expect: map[string]bool{},
+		},
+		{
+			name:   "Search",
+			query:  ListQuery{Admin: adminName, Search: "lunch", Limit: 3},
+			expect: map[string]bool{"ListQuery lunch": true},
+		},
+		{
+			name:      "Anonymous",
+			anonymous: true,
+			query:     ListQuery{Admin: adminName, Limit: 2},
+			expect:    all,
+		},
+		{
+			name:      "Anonymous own",
+			anonymous: true,
+			query:     ListQuery{Own: true, Admin: adminName, Limit: 2},
+			expect:    map[string]bool{},
+		},
+		{
+			name: "Electorate",
+			query: ListQuery{Admin: adminName, Limit: 3,
+				Electorates: []db.Electorate{db.ElectorateVerified}},
+			expect: map[string]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &userId
+			if tt.anonymous {
+				user = nil
+			}
+			got := fetchAll(t, user, tt.query)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// LiveAnswer is a message sent to the members of the live room of a poll.
+// RoundDeadline is omitted if the current round has no deadline. Participants is the number of
+// participants of the current round, omitted if the poll is sealed. Result is only sent when a
+// round ends. Comment is only sent when a comment changes.
+type LiveAnswer struct {
+	State         string
+	CurrentRound  uint8
+	RoundDeadline *time.Time   `json:",omitempty"`
+	Participants  *uint32      `json:",omitempty"`
+	Result        *LiveResult  `json:",omitempty"`
+	Comment       *LiveComment `json:",omitempty"`
+}
+
+// LiveResult is the outcome of a round that just ended. Winners are sent only if the information
+// policy of the poll allows it.
+type LiveResult struct {
+	Round   uint8
+	Winners AlternativeList `json:",omitempty"`
+}
+
+// LiveComment identifies a comment that has just changed. Action is either "Posted", "Edited" or
+// "Deleted".
+type LiveComment struct {
+	Id     uint32
+	Action string
+}
+
+var liveCommentActions = map[services.CommentAction]string{
+	services.CommentPosted:  "Posted",
+	services.CommentEdited:  "Edited",
+	services.CommentDeleted: "Deleted",
+}
+
+type liveHandler struct {
+	rooms services.LiveRooms
+}
+
+// LiveHandler opens a WebSocket through which the state of a poll is sent each time it changes.
+// Since browsers cannot add headers to WebSocket handshakes, the session id of logged users must be
+// sent as the query parameter X-CSRF.
+func LiveHandler(rooms services.LiveRooms) *liveHandler {
+	return &liveHandler{rooms: rooms}
+}
+
+func (self *liveHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+	withWinners := pollInfo.AllowsInformation(InformationTypeWinner)
+	sealed := pollInfo.Sealed()
+
+	updates, leave := self.rooms.Join(pollInfo.Id)
+	defer leave()
+
+	messages := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(messages)
+		for update := range updates {
+			answer := LiveAnswer{
+				State:        string(update.State),
+				CurrentRound: update.CurrentRound,
+			}
+			if !sealed {
+				participants := update.Participants
+				answer.Participants = &participants
+			}
+			if !update.RoundDeadline.IsZero() {
+				deadline := update.RoundDeadline
+				answer.RoundDeadline = &deadline
+			}
+			if update.Result != nil {
+				answer.Result = &LiveResult{Round: update.Result.Round}
+				if withWinners {
+					answer.Result.Winners = update.Result.Winners
+				}
+			}
+			if update.Comment != nil {
+				answer.Comment = &LiveComment{
+					Id:     update.Comment.Id,
+					Action: liveCommentActions[update.Comment.Action],
+				}
+			}
+			select {
+			case messages <- answer:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	response.SendWebSocket(ctx, request, messages)
+	close(done)
+}
@@ -0,0 +1,141 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+// liveRoomsMock sends all its updates to each new member, then closes the channel.
+type liveRoomsMock struct {
+	updates []services.LiveRoomUpdate
+}
+
+func (self liveRoomsMock) Join(poll uint32) (<-chan services.LiveRoomUpdate, func()) {
+	ret := make(chan services.LiveRoomUpdate, len(self.updates))
+	for _, update := range self.updates {
+		ret <- update
+	}
+	close(ret)
+	return ret, func() {}
+}
+
+// liveTest records the messages sent through the WebSocket.
+// If expect is nil, the Checker of the pollTest is used instead.
+type liveTest struct {
+	pollTest
+	expect []interface{}
+	got    []interface{}
+}
+
+func (self *liveTest) ChangeResponse(t *testing.T, response server.Response) server.Response {
+	return srvt.ResponseSpy{
+		Backend: response,
+		T:       t,
+		SocketFct: func(t *testing.T, ctx context.Context, request *server.Request,
+			messages <-chan interface{}) {
+			for msg := range messages {
+				self.got = append(self.got, msg)
+			}
+		},
+	}
+}
+
+func (self *liveTest) Check(t *testing.T, response *http.Response, request *server.Request) {
+	if self.expect == nil {
+		self.pollTest.Check(t, response, request)
+		return
+	}
+	if !reflect.DeepEqual(self.got, self.expect) {
+		t.Errorf("Got %v. Expect %v.", self.got, self.expect)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	deadline := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	rooms := liveRoomsMock{updates: []services.LiveRoomUpdate{
+		{State: db.StateActive, CurrentRound: 1, RoundDeadline: deadline, Participants: 2},
+		{State: db.StateActive, CurrentRound: 2, Participants: 0,
+			Result: &services.LiveRoomResult{Round: 1, Winners: []uint8{1}}},
+		{State: db.StateActive, CurrentRound: 2, Participants: 0,
+			Comment: &services.LiveRoomComment{Id: 3, Action: services.CommentDeleted}},
+	}}
+	two, zero := uint32(2), uint32(0)
+	first := LiveAnswer{State: "Active", CurrentRound: 1, RoundDeadline: &deadline, Participants: &two}
+	comment := LiveAnswer{State: "Active", CurrentRound: 2, Participants: &zero,
+		Comment: &LiveComment{Id: 3, Action: "Deleted"}}
+
+	tests := []srvt.Test{
+		&liveTest{
+			pollTest: pollTest{
+				Name:       "No access",
+				Electorate: db.ElectorateLogged,
+				UserType:   pollTestUserTypeNone,
+				Checker:    srvt.CheckStatus{Code: http.StatusForbidden},
+			},
+		},
+		&liveTest{
+			pollTest: pollTest{
+				Name:        "Winners",
+				Electorate:  db.ElectorateAll,
+				Information: db.InformationCounts,
+				UserType:    pollTestUserTypeLogged,
+			},
+			expect: []interface{}{first, LiveAnswer{State: "Active", CurrentRound: 2,
+				Participants: &zero, Result: &LiveResult{Round: 1, Winners: AlternativeList{1}}},
+				comment},
+		},
+		&liveTest{
+			pollTest: pollTest{
+				Name:        "Hidden winners",
+				Electorate:  db.ElectorateAll,
+				Information: db.InformationNone,
+				UserType:    pollTestUserTypeLogged,
+			},
+			expect: []interface{}{first, LiveAnswer{State: "Active", CurrentRound: 2,
+				Participants: &zero, Result: &LiveResult{Round: 1}}, comment},
+		},
+		&liveTest{
+			pollTest: pollTest{
+				Name:        "Sealed",
+				Electorate:  db.ElectorateAll,
+				Information: db.InformationCounts,
+				OneMove:     true,
+				UserType:    pollTestUserTypeLogged,
+			},
+			expect: []interface{}{
+				LiveAnswer{State: "Active", CurrentRound: 1, RoundDeadline: &deadline},
+				LiveAnswer{State: "Active", CurrentRound: 2,
+					Result: &LiveResult{Round: 1, Winners: AlternativeList{1}}},
+				LiveAnswer{State: "Active", CurrentRound: 2,
+					Comment: &LiveComment{Id: 3, Action: "Deleted"}}},
+		},
+	}
+	srvt.Run(t, tests, func() server.Handler { return LiveHandler(rooms) })
+}
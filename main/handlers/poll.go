@@ -37,6 +37,12 @@ type PollInfo struct {
 	CurrentRound uint8
 	Public       bool
 
+	Type              uint8
+	MaxBallotCost     float64
+	BallotCostIsCount bool
+	RoundType         uint8
+	Information       db.Information
+
 	Logged      bool
 	Participate bool
 }
@@ -49,6 +55,7 @@ func noPollError(reason string) server.HttpError {
 //
 // It checks that the request has a session and a valid poll segment. It also check that the user
 // participates in the poll. If she doesn't, poll.Participate is set to false.
+// For polls whose electorate is Invited, the user, logged or not, must have been invited.
 func checkPollAccess(ctx context.Context, request *server.Request) (poll PollInfo, err error) {
 	// Check user
 	if request.SessionError != nil {
@@ -68,7 +75,11 @@ func checkPollAccess(ctx context.Context, request *server.Request) (poll PollInf
 	// Check poll
 	var salt uint32
 	var electorate db.Electorate
-	const qPoll = `SELECT Salt, Electorate, NbChoices, State = 'Active', CurrentRound FROM Polls WHERE Id = ?`
+	const qPoll = `
+	  SELECT Salt, Electorate, NbChoices, State = 'Active', CurrentRound, Type, MaxBallotCost,
+	         BallotCostIsCount, RoundType, Information
+	    FROM Polls
+	   WHERE Id = ?`
 	rows, err := db.DB.QueryContext(ctx, qPoll, poll.Id)
 	defer rows.Close()
 	if err != nil {
@@ -78,7 +89,9 @@ func checkPollAccess(ctx context.Context, request *server.Request) (poll PollInf
 		err = noPollError("Id not found")
 		return
 	}
-	err = rows.Scan(&salt, &electorate, &poll.NbChoices, &poll.Active, &poll.CurrentRound)
+	err = rows.Scan(&salt, &electorate, &poll.NbChoices, &poll.Active, &poll.CurrentRound,
+		&poll.Type, &poll.MaxBallotCost, &poll.BallotCostIsCount, &poll.RoundType,
+		&poll.Information)
 	if err != nil {
 		return
 	}
@@ -88,7 +101,12 @@ func checkPollAccess(ctx context.Context, request *server.Request) (poll PollInf
 		return
 	}
 	poll.Public = electorate == db.ElectorateAll
-	if !poll.Logged && !poll.Public {
+	if electorate == db.ElectorateInvited {
+		err = checkInvited(ctx, poll.Id, request.User)
+		if err != nil {
+			return
+		}
+	} else if !poll.Logged && !poll.Public {
 		err = server.NewHttpError(http.StatusForbidden, "Unlogged", "Not a public poll")
 		return
 	}
@@ -126,20 +144,75 @@ func checkPollAccess(ctx context.Context, request *server.Request) (poll PollInf
 	return
 }
 
+// BallotType returns the type of ballot participants must send for the current round.
+// Polls of type 'Acceptance Set' whose ballots are limited to one alternative are uninominal. Other
+// polls of that type are approval polls.
 func (pollInfo PollInfo) BallotType() BallotType {
-	// TODO really compute the value
 	if !pollInfo.Active {
 		return BallotTypeClosed
 	}
-	return BallotTypeUninominal
+	if pollInfo.Type == db.PollTypeRanked {
+		return BallotTypeRanked
+	}
+	if pollInfo.BallotCostIsCount && pollInfo.MaxBallotCost < 2 {
+		return BallotTypeUninominal
+	}
+	return BallotTypeApproval
+}
+
+// Sealed tells whether ballots of the current round must be kept secret until the end of the round.
+func (pollInfo PollInfo) Sealed() bool {
+	return pollInfo.RoundType != db.RoundTypeFreelyAsynchronous
+}
+
+// OneMove tells whether participants can vote only once per round.
+func (pollInfo PollInfo) OneMove() bool {
+	return pollInfo.RoundType == db.RoundTypeOneMove
 }
 
+// InformationType returns the type of information participants receive about the other ballots.
+// Information is always computed from complete rounds only, hence ballots of sealed polls are never
+// revealed before the end of their round.
 func (pollInfo PollInfo) InformationType() InformationType {
-	// TODO really compute the value
+	if pollInfo.Information == db.InformationNone {
+		return InformationTypeNone
+	}
 	if pollInfo.CurrentRound == 0 {
 		return InformationTypeNoneYet
 	}
-	return InformationTypeCounts
+	switch pollInfo.Information {
+	case db.InformationWinner:
+		return InformationTypeWinner
+	case db.InformationRanking:
+		return InformationTypeRanking
+	case db.InformationMatrix:
+		return InformationTypeMatrix
+	case db.InformationTrends:
+		return InformationTypeTrends
+	default:
+		return InformationTypeCounts
+	}
+}
+
+// allowedInformation lists, for each information policy, the information that can be sent.
+var allowedInformation = map[db.Information][]InformationType{
+	db.InformationWinner:  {InformationTypeWinner},
+	db.InformationRanking: {InformationTypeWinner, InformationTypeRanking},
+	db.InformationCounts:  {InformationTypeWinner, InformationTypeRanking, InformationTypeCounts},
+	db.InformationMatrix:  {InformationTypeMatrix},
+	db.InformationTrends: {InformationTypeWinner, InformationTypeRanking, InformationTypeCounts,
+		InformationTypeTrends},
+}
+
+// AllowsInformation tells whether the information policy of the poll permits to send the given
+// type of information.
+func (pollInfo PollInfo) AllowsInformation(infoType InformationType) bool {
+	for _, allowed := range allowedInformation[pollInfo.Information] {
+		if allowed == infoType {
+			return true
+		}
+	}
+	return false
 }
 
 /** PollHandler **/
@@ -149,6 +222,8 @@ type BallotType uint8
 const (
 	BallotTypeClosed BallotType = iota
 	BallotTypeUninominal
+	BallotTypeApproval
+	BallotTypeRanked
 )
 
 type InformationType uint8
@@ -156,6 +231,11 @@ type InformationType uint8
 const (
 	InformationTypeNoneYet InformationType = iota
 	InformationTypeCounts
+	InformationTypeNone
+	InformationTypeWinner
+	InformationTypeRanking
+	InformationTypeMatrix
+	InformationTypeTrends
 )
 
 type PollAnswer struct {
@@ -175,6 +255,8 @@ type PollAnswer struct {
 	MaxNbRounds      uint8
 	Ballot           BallotType
 	Information      InformationType
+	Sealed           bool
+	OneMove          bool
 }
 
 // PollHandler provides general information about a poll.
@@ -185,6 +267,8 @@ func PollHandler(ctx context.Context, response server.Response, request *server.
 	answer := PollAnswer{
 		Ballot:       pollInfo.BallotType(),
 		Information:  pollInfo.InformationType(),
+		Sealed:       pollInfo.Sealed(),
+		OneMove:      pollInfo.OneMove(),
 		CurrentRound: pollInfo.CurrentRound,
 		Active:       pollInfo.Active,
 	}
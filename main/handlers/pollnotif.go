@@ -18,14 +18,17 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JBoudou/Itero/main/services"
 	"github.com/JBoudou/Itero/mid/db"
 	"github.com/JBoudou/Itero/mid/salted"
 	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/slog"
 )
 
 //
@@ -36,27 +39,23 @@ type PollNotifQuery struct {
 	LastUpdate time.Time
 }
 
+// PollNotifAnswerEntry is a notification about a poll. Segment is empty for deleted polls.
+// Id and Read are set only for notifications from the inbox of the user.
 type PollNotifAnswerEntry struct {
+	Id        uint64 `json:",omitempty"`
 	Timestamp time.Time
 	Segment   string
 	Title     string
 	Round     uint8
 	Action    services.PollNotifAction
+	Winners   AlternativeList `json:",omitempty"`
+	Voters    uint32          `json:",omitempty"`
+	Read      bool            `json:",omitempty"`
 }
 
-type pollNotifHandler struct {
-	notifChannel services.PollNotifChannel
-}
-
-// PollNotifHandler retrieves the current list of notifications for the user. The same notification
-// may be listed in more than one consecutive answers.
-func PollNotifHandler(notifChannel services.PollNotifChannel) *pollNotifHandler {
-	return &pollNotifHandler{
-		notifChannel: notifChannel,
-	}
-}
-
-func (self *pollNotifHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+// pollNotifUser returns the identifier of the user doing the request. Unlogged users are
+// accepted. Errors are sent by panic.
+func pollNotifUser(request *server.Request) uint32 {
 	if request.User == nil {
 		if request.SessionError != nil {
 			must(request.SessionError)
@@ -64,6 +63,73 @@ func (self *pollNotifHandler) Handle(ctx context.Context, response server.Respon
 			panic(server.UnauthorizedHttpError("Unlogged user"))
 		}
 	}
+	return request.User.Id
+}
+
+// pollNotifInboxQuery selects the notifications in the inbox of users, with the columns scanned by
+// makePollNotifEntries. It must be completed by a WHERE clause.
+const pollNotifInboxQuery = `
+	  SELECT n.Id, n.Created, n.Poll, p.Salt, n.Title, n.Round, n.Action, n.Winners, n.Seen
+	    FROM PollNotifications AS n LEFT OUTER JOIN Polls AS p ON n.Poll = p.Id`
+
+func makePollNotifEntries(rows *sql.Rows) (list []PollNotifAnswerEntry, err error) {
+	list = make([]PollNotifAnswerEntry, 0, 4)
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry PollNotifAnswerEntry
+		var segment salted.Segment
+		var salt sql.NullInt64
+		var winners []byte
+
+		err = rows.Scan(&entry.Id, &entry.Timestamp, &segment.Id, &salt, &entry.Title, &entry.Round,
+			&entry.Action, &winners, &entry.Read)
+		if err != nil {
+			return
+		}
+
+		if salt.Valid {
+			segment.Salt = uint32(salt.Int64)
+			entry.Segment, err = segment.Encode()
+			if err != nil {
+				return
+			}
+		}
+		if len(winners) > 0 {
+			entry.Winners = AlternativeList(winners)
+		}
+
+		list = append(list, entry)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// pollNotifEntry converts a notification from the stream into an answer entry. The boolean is
+// false if the notification does not concern the user.
+func pollNotifEntry(user uint32, notif *services.PollNotification) (
+	entry PollNotifAnswerEntry, ok bool) {
+
+	if member, ok := notif.Participants[user]; !ok || !member {
+		return entry, false
+	}
+	entry = PollNotifAnswerEntry{
+		Timestamp: notif.Timestamp,
+		Segment:   notif.Segment,
+		Title:     notif.Title,
+		Round:     notif.Round,
+		Action:    notif.Action,
+		Winners:   notif.Winners,
+		Voters:    notif.Voters,
+	}
+	return entry, true
+}
+
+// PollNotifHandler retrieves the notifications received by the user since the given time. The
+// same notification may be listed in more than one consecutive answers.
+func PollNotifHandler(ctx context.Context, response server.Response, request *server.Request) {
+	user := pollNotifUser(request)
 	must(request.CheckPOST(ctx))
 
 	var query PollNotifQuery
@@ -72,56 +138,185 @@ func (self *pollNotifHandler) Handle(ctx context.Context, response server.Respon
 		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
 	}
 
-	baseList := <-self.notifChannel
-	if len(baseList) == 0 {
-		response.SendJSON(ctx, make([]PollNotifAnswerEntry, 0))
-		return
+	const qList = pollNotifInboxQuery + `
+	   WHERE n.User = ? AND n.Created >= ?
+	   ORDER BY n.Created ASC, n.Id ASC`
+	rows, err := db.DB.QueryContext(ctx, qList, user, query.LastUpdate)
+	must(err)
+	answer, err := makePollNotifEntries(rows)
+	must(err)
+
+	response.SendJSON(ctx, answer)
+}
+
+//
+// PollNotif inbox
+//
+
+// PollNotifListQuery selects a page of the inbox of the user. Notifications are sent from the most
+// recent one. Before is the Id of the last notification of the previous page, or zero for the first
+// page. Limit is the maximal number of notifications in the page. If Unread is true, only unread
+// notifications are sent.
+type PollNotifListQuery struct {
+	Before uint64 `json:",omitempty"`
+	Limit  uint8  `json:",omitempty"`
+	Unread bool   `json:",omitempty"`
+}
+
+// PollNotifListAnswer is a page of the inbox of the user. Unread is the total number of unread
+// notifications in the inbox.
+type PollNotifListAnswer struct {
+	Notifications []PollNotifAnswerEntry
+	Unread        uint32
+}
+
+// PollNotifIdsQuery designates notifications in the inbox of the user, either by their Id, or all
+// of them.
+type PollNotifIdsQuery struct {
+	Ids []uint64 `json:",omitempty"`
+	All bool     `json:",omitempty"`
+}
+
+const (
+	pollNotifDefaultLimit = 20
+	pollNotifMaxLimit     = 100
+)
+
+// PollNotifListHandler sends a page of the inbox of the user.
+func PollNotifListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	user := pollNotifUser(request)
+	must(request.CheckPOST(ctx))
+
+	var query PollNotifListQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if query.Limit == 0 {
+		query.Limit = pollNotifDefaultLimit
+	} else if query.Limit > pollNotifMaxLimit {
+		query.Limit = pollNotifMaxLimit
 	}
 
-	const qCheck = `
-	  SELECT Title, Salt
-		  FROM Polls
-		 WHERE Id = ?
-		   AND (Admin = %[1]d OR Id IN ( SELECT Poll FROM Participants WHERE User = %[1]d ))`
-	stmt, err := db.DB.PrepareContext(ctx, fmt.Sprintf(qCheck, request.User.Id))
+	const (
+		qList = pollNotifInboxQuery + `
+		 WHERE n.User = ? AND (? = 0 OR n.Id < ?) AND NOT (? AND n.Seen)
+		 ORDER BY n.Id DESC
+		 LIMIT ?`
+		qUnread = `SELECT COUNT(*) FROM PollNotifications WHERE User = ? AND NOT Seen`
+	)
+
+	var answer PollNotifListAnswer
+	rows, err := db.DB.QueryContext(ctx, qList, user, query.Before, query.Before, query.Unread,
+		query.Limit)
+	must(err)
+	answer.Notifications, err = makePollNotifEntries(rows)
 	must(err)
-	defer stmt.Close()
+	must(db.DB.QueryRowContext(ctx, qUnread, user).Scan(&answer.Unread))
+
+	response.SendJSON(ctx, answer)
+}
+
+// pollNotifIdsExec executes the given statement on the notifications designated by the
+// PollNotifIdsQuery in the body of the request. The statement must be given the id of the user as
+// first argument, and must be terminated by a condition on column Id.
+func pollNotifIdsExec(ctx context.Context, response server.Response, request *server.Request,
+	statement string) {
+
+	user := pollNotifUser(request)
+	must(request.CheckPOST(ctx))
 
-	answer := make([]PollNotifAnswerEntry, 0, len(baseList)/2)
-	for _, notif := range baseList {
-		if notif.Timestamp.Before(query.LastUpdate) {
-			continue
+	var query PollNotifIdsQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if !query.All && len(query.Ids) == 0 {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "No notification"))
+	}
+
+	args := make([]interface{}, 0, len(query.Ids)+1)
+	args = append(args, user)
+	if query.All {
+		statement += ` IS NOT NULL`
+	} else {
+		statement += ` IN (?` + strings.Repeat(`, ?`, len(query.Ids)-1) + `)`
+		for _, id := range query.Ids {
+			args = append(args, id)
 		}
+	}
+	_, err := db.DB.ExecContext(ctx, statement, args...)
+	must(err)
 
-		entry := PollNotifAnswerEntry{
-			Timestamp: notif.Timestamp,
-			Round:     notif.Round,
-			Action:    notif.Action,
+	response.SendJSON(ctx, "Ok")
+}
+
+// PollNotifReadHandler marks notifications from the inbox of the user as read.
+func PollNotifReadHandler(ctx context.Context, response server.Response, request *server.Request) {
+	const qRead = `UPDATE PollNotifications SET Seen = TRUE WHERE User = ? AND Id`
+	pollNotifIdsExec(ctx, response, request, qRead)
+}
+
+// PollNotifDeleteHandler deletes notifications from the inbox of the user.
+func PollNotifDeleteHandler(ctx context.Context, response server.Response, request *server.Request) {
+	const qDelete = `DELETE FROM PollNotifications WHERE User = ? AND Id`
+	pollNotifIdsExec(ctx, response, request, qDelete)
+}
+
+//
+// PollNotifStreamHandler
+//
+
+type pollNotifStreamHandler struct {
+	stream services.PollNotifStream
+}
+
+// PollNotifStreamHandler sends the notifications for the user as a stream of Server-Sent Events,
+// as soon as they happen. Each event contains one PollNotifAnswerEntry, and its identifier can be
+// sent back in a Last-Event-ID header to receive the notifications missed while disconnected.
+// Since the session must be checked, clients must send the same headers as for other requests.
+func PollNotifStreamHandler(stream services.PollNotifStream) *pollNotifStreamHandler {
+	return &pollNotifStreamHandler{
+		stream: stream,
+	}
+}
+
+func (self *pollNotifStreamHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	user := pollNotifUser(request)
+
+	var lastId uint64
+	if header := request.Header("Last-Event-ID"); header != "" {
+		var err error
+		lastId, err = strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
 		}
+	}
 
-		if notif.Participants != nil {
-			if member, ok := notif.Participants[request.User.Id]; !ok || !member {
-				continue
-			}
-			entry.Title = notif.Title
+	notifs, cancel := self.stream.Subscribe(lastId)
+	defer cancel()
 
-		} else {
-			rows, err := stmt.QueryContext(ctx, notif.Id)
-			must(err)
-			if !rows.Next() {
+	events := make(chan server.ServerEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		defer func() {
+			if thrown := recover(); thrown != nil {
+				slog.CtxLogf(ctx, "Notification stream error: %v", thrown)
+			}
+		}()
+		for notif := range notifs {
+			entry, ok := pollNotifEntry(user, notif.Notification)
+			if !ok {
 				continue
 			}
-			segment := salted.Segment{Id: notif.Id}
-			err = rows.Scan(&entry.Title, &segment.Salt)
-			rows.Close()
-			must(err)
-
-			entry.Segment, err = segment.Encode()
-			must(err)
+			evt := server.ServerEvent{Id: strconv.FormatUint(notif.Id, 10), Data: entry}
+			select {
+			case events <- evt:
+			case <-done:
+				return
+			}
 		}
+	}()
 
-		answer = append(answer, entry)
-	}
-
-	response.SendJSON(ctx, answer)
+	response.SendEvents(ctx, events)
+	close(done)
 }
@@ -17,6 +17,7 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"reflect"
@@ -31,6 +32,7 @@ import (
 	srvt "github.com/JBoudou/Itero/mid/server/servertest"
 	"github.com/JBoudou/Itero/pkg/events"
 	"github.com/JBoudou/Itero/pkg/ioc"
+	"github.com/JBoudou/Itero/pkg/slog"
 )
 
 type pollNotifUserKind uint8
@@ -80,9 +82,12 @@ func (self *pollNotifHandlerTest) Prepare(t *testing.T, loc *ioc.Locator) *ioc.L
 
 	loc = loc.Sub()
 	loc.Refresh(&self.evtManager)
-	loc.Bind(func(evtManager events.Manager) (services.PollNotifChannel, error) {
-		return services.RunPollNotif(time.Second, evtManager)
-	})
+	inbox := services.PollNotifInboxService(&slog.WithStack{Target: t})
+	mustt(t, self.evtManager.AddReceiver(events.ReceiverFunc(func(evt events.Event) {
+		if inbox.FilterEvent(evt) {
+			inbox.ReceiveEvent(evt, nil)
+		}
+	})))
 
 	return loc
 }
@@ -94,6 +99,17 @@ func (self *pollNotifHandlerTest) GetRequest(t *testing.T) *srvt.Request {
 		time.Sleep(time.Millisecond)
 	}
 
+	// Wait for the notifications to be stored. The admin always receives them.
+	const qCount = `SELECT COUNT(*) FROM PollNotifications WHERE User = ?`
+	for try := 0; try < 100; try++ {
+		var count int
+		mustt(t, db.DB.QueryRow(qCount, self.admnId).Scan(&count))
+		if count >= len(self.events) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
 	userId := &self.partId
 	if self.userKind == pollNotifHandlerTestUserAdmin {
 		userId = &self.admnId
@@ -133,6 +149,7 @@ func (self *pollNotifHandlerTest) Check(t *testing.T, response *http.Response, r
 
 		// Fix things
 		got[i].Timestamp = time.Time{}
+		got[i].Id = 0
 		self.expect[i].Segment = segment
 		if self.expect[i].Title == "" {
 			self.expect[i].Title = "Title"
@@ -221,5 +238,250 @@ func TestPollNotifHandler(t *testing.T) {
 		},
 	}
 
-	srvt.Run(t, tests, PollNotifHandler)
+	srvt.RunFunc(t, tests, PollNotifHandler)
+}
+
+func TestPollNotifInboxHandlers(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUserWith(t.Name())
+	otherId := env.CreateUserWith(t.Name() + "Other")
+	pollId := env.CreatePoll("Inbox", userId, db.ElectorateAll)
+	env.Must(t)
+
+	const qInsert = `
+	  INSERT INTO PollNotifications (User, Poll, Action, Round, Title)
+	  VALUE (?, ?, ?, 0, 'Inbox')`
+	insert := func(user uint32, action services.PollNotifAction) uint64 {
+		result, err := db.DB.Exec(qInsert, user, pollId, action)
+		mustt(t, err)
+		id, err := result.LastInsertId()
+		mustt(t, err)
+		return uint64(id)
+	}
+	ids := []uint64{
+		insert(userId, services.PollNotifStart),
+		insert(userId, services.PollNotifNext),
+		insert(userId, services.PollNotifTerm),
+	}
+	otherNotif := insert(otherId, services.PollNotifStart)
+
+	segment, err := salted.Segment{Id: pollId, Salt: dbt.PollSalt}.Encode()
+	mustt(t, err)
+
+	makeRequest := func(body interface{}) srvt.Request {
+		encoded, err := json.Marshal(body)
+		mustt(t, err)
+		return srvt.Request{UserId: &userId, Method: "POST", Body: string(encoded)}
+	}
+
+	checkList := func(expectIds []uint64, expectUnread uint32) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response,
+			request *server.Request) {
+
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+			var answer PollNotifListAnswer
+			mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+			if answer.Unread != expectUnread {
+				t.Errorf("Wrong unread count. Got %d. Expect %d.", answer.Unread, expectUnread)
+			}
+			gotIds := make([]uint64, 0, len(answer.Notifications))
+			for _, entry := range answer.Notifications {
+				gotIds = append(gotIds, entry.Id)
+				if entry.Segment != segment || entry.Title != "Inbox" {
+					t.Errorf("Wrong entry %v.", entry)
+				}
+			}
+			if !reflect.DeepEqual(gotIds, expectIds) {
+				t.Errorf("Got ids %v. Expect %v.", gotIds, expectIds)
+			}
+		})
+	}
+
+	listTests := func(t *testing.T, tests []srvt.Test) {
+		srvt.RunFunc(t, tests, PollNotifListHandler)
+	}
+
+	listTests(t, []srvt.Test{
+		&srvt.T{
+			Name:    "No user",
+			Request: srvt.Request{Method: "POST", Body: `{}`},
+			Checker: srvt.CheckStatus{Code: http.StatusForbidden},
+		},
+		&srvt.T{
+			Name:    "All",
+			Request: makeRequest(PollNotifListQuery{}),
+			Checker: checkList([]uint64{ids[2], ids[1], ids[0]}, 3),
+		},
+		&srvt.T{
+			Name:    "Page",
+			Request: makeRequest(PollNotifListQuery{Before: ids[2], Limit: 1}),
+			Checker: checkList([]uint64{ids[1]}, 3),
+		},
+	})
+
+	srvt.RunFunc(t, []srvt.Test{
+		&srvt.T{
+			Name:    "Read nothing",
+			Request: makeRequest(PollNotifIdsQuery{}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+		&srvt.T{
+			Name:    "Read",
+			Request: makeRequest(PollNotifIdsQuery{Ids: []uint64{ids[1], otherNotif}}),
+			Checker: srvt.CheckStatus{Code: http.StatusOK},
+		},
+	}, PollNotifReadHandler)
+
+	listTests(t, []srvt.Test{
+		&srvt.T{
+			Name:    "After read",
+			Request: makeRequest(PollNotifListQuery{}),
+			Checker: checkList([]uint64{ids[2], ids[1], ids[0]}, 2),
+		},
+		&srvt.T{
+			Name:    "Unread",
+			Request: makeRequest(PollNotifListQuery{Unread: true}),
+			Checker: checkList([]uint64{ids[2], ids[0]}, 2),
+		},
+	})
+
+	srvt.RunFunc(t, []srvt.Test{
+		&srvt.T{
+			Name:    "Delete",
+			Request: makeRequest(PollNotifIdsQuery{Ids: []uint64{ids[0], otherNotif}}),
+			Checker: srvt.CheckStatus{Code: http.StatusOK},
+		},
+	}, PollNotifDeleteHandler)
+
+	srvt.RunFunc(t, []srvt.Test{
+		&srvt.T{
+			Name:    "Read all",
+			Request: makeRequest(PollNotifIdsQuery{All: true}),
+			Checker: srvt.CheckStatus{Code: http.StatusOK},
+		},
+	}, PollNotifReadHandler)
+
+	listTests(t, []srvt.Test{
+		&srvt.T{
+			Name:    "After delete",
+			Request: makeRequest(PollNotifListQuery{}),
+			Checker: checkList([]uint64{ids[2], ids[1]}, 0),
+		},
+	})
+
+	const qOther = `SELECT Seen FROM PollNotifications WHERE Id = ?`
+	var seen bool
+	mustt(t, db.DB.QueryRow(qOther, otherNotif).Scan(&seen))
+	if seen {
+		t.Errorf("Notification of another user marked as read.")
+	}
+}
+
+// pollNotifStreamMock sends all its entries whose identifier is greater than lastId, then closes
+// the channel.
+type pollNotifStreamMock struct {
+	entries []services.PollNotifStreamEntry
+}
+
+func (self pollNotifStreamMock) Subscribe(lastId uint64) (<-chan services.PollNotifStreamEntry, func()) {
+	ret := make(chan services.PollNotifStreamEntry, len(self.entries))
+	for _, entry := range self.entries {
+		if entry.Id > lastId {
+			ret <- entry
+		}
+	}
+	close(ret)
+	return ret, func() {}
+}
+
+func TestPollNotifStreamHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name() + "Admin")
+	alien := env.CreateUserWith(t.Name() + "Alien")
+	pollId := env.CreatePoll("Title", admin, db.ElectorateLogged)
+	env.Must(t)
+
+	segment, err := salted.Segment{Id: pollId, Salt: dbt.PollSalt}.Encode()
+	mustt(t, err)
+	timestamp := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	members := map[uint32]bool{admin: true}
+	stream := pollNotifStreamMock{entries: []services.PollNotifStreamEntry{
+		{Id: 5, Notification: &services.PollNotification{Timestamp: timestamp, Id: pollId,
+			Action: services.PollNotifStart, Title: "Title", Segment: segment, Participants: members}},
+		{Id: 6, Notification: &services.PollNotification{Timestamp: timestamp, Id: pollId,
+			Action: services.PollNotifVote, Voters: 3, Title: "Title", Segment: segment,
+			Participants: members}},
+		{Id: 7, Notification: &services.PollNotification{Timestamp: timestamp, Id: pollId + 1000,
+			Action: services.PollNotifStart, Participants: map[uint32]bool{}}},
+		{Id: 8, Notification: &services.PollNotification{Timestamp: timestamp, Id: pollId + 1000,
+			Action: services.PollNotifDelete, Title: "Deleted", Participants: map[uint32]bool{alien: true}}},
+	}}
+
+	eventText := func(id string, entry PollNotifAnswerEntry) string {
+		data, err := json.Marshal(entry)
+		mustt(t, err)
+		return "id: " + id + "\ndata: " + string(data) + "\n\n"
+	}
+	startEvent := eventText("5", PollNotifAnswerEntry{Timestamp: timestamp, Segment: segment,
+		Title: "Title", Action: services.PollNotifStart})
+	voteEvent := eventText("6", PollNotifAnswerEntry{Timestamp: timestamp, Segment: segment,
+		Title: "Title", Action: services.PollNotifVote, Voters: 3})
+	deleteEvent := eventText("8", PollNotifAnswerEntry{Timestamp: timestamp, Title: "Deleted",
+		Action: services.PollNotifDelete})
+
+	checkBody := func(expect string) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+			if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Got content type %s. Expect text/event-stream.", got)
+			}
+			var buff bytes.Buffer
+			_, err := buff.ReadFrom(response.Body)
+			mustt(t, err)
+			if got := buff.String(); got != expect {
+				t.Errorf("Got %q. Expect %q.", got, expect)
+			}
+		})
+	}
+
+	tests := []srvt.Test{
+		&srvt.T{
+			Name:    "No user",
+			Request: srvt.Request{},
+			Checker: srvt.CheckStatus{Code: http.StatusForbidden},
+		},
+		&srvt.T{
+			Name:    "Admin",
+			Request: srvt.Request{UserId: &admin},
+			Checker: checkBody(startEvent + voteEvent),
+		},
+		&srvt.T{
+			Name:    "Alien",
+			Request: srvt.Request{UserId: &alien},
+			Checker: checkBody(deleteEvent),
+		},
+		&srvt.T{
+			Name: "Last-Event-ID",
+			Request: srvt.Request{
+				UserId: &admin,
+				Header: http.Header{"Last-Event-ID": []string{"5"}},
+			},
+			Checker: checkBody(voteEvent),
+		},
+		&srvt.T{
+			Name: "Wrong Last-Event-ID",
+			Request: srvt.Request{
+				UserId: &admin,
+				Header: http.Header{"Last-Event-ID": []string{"five"}},
+			},
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+		},
+	}
+	srvt.Run(t, tests, func() server.Handler { return PollNotifStreamHandler(stream) })
 }
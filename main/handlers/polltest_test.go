@@ -58,17 +58,23 @@ type pollTest struct {
 	dbt.WithDB
 	WithEvent
 
-	Name         string        // Required.
-	Electorate   db.Electorate // Required.
-	Hidden       bool
-	Alternatives []string
-	Round        uint8
-	Waiting      bool
-	Participate  []pollTestParticipate // No need to add an entry for each vote.
-	Vote         []pollTestVote
+	Name          string        // Required.
+	Electorate    db.Electorate // Required.
+	Hidden        bool
+	Alternatives  []string
+	MaxBallotCost float64 // Value of MaxBallotCost, if positive.
+	Ranked        bool
+	OneMove       bool
+	Information   db.Information // Value of Information, if not empty.
+	Round         uint8
+	Waiting       bool
+	Paused        bool
+	Participate   []pollTestParticipate // No need to add an entry for each vote.
+	Vote          []pollTestVote
 
 	UserType pollTestUserType // Required.
 	Verified bool             // Whether the user doing the request is verified.
+	Invited  bool             // Whether the user doing the request is invited to the poll.
 
 	Request        srvt.Request // Just a squeleton that will be completed by the test.
 	Checker        interface{}  // Required. Either an srvt.Checker or a PollTestCheckerFactory.
@@ -123,6 +129,30 @@ func (self *pollTest) Prepare(t *testing.T, loc *ioc.Locator) *ioc.Locator {
 		mustt(t, err)
 	}
 
+	// MaxBallotCost
+	const qMaxBallotCost = `UPDATE Polls SET MaxBallotCost = ? WHERE Id = ?`
+	if self.MaxBallotCost > 0 {
+		self.DB.QuietExec(qMaxBallotCost, self.MaxBallotCost, self.pollId)
+	}
+
+	// Ranked
+	const qRanked = `UPDATE Polls SET Type = ? WHERE Id = ?`
+	if self.Ranked {
+		self.DB.QuietExec(qRanked, db.PollTypeRanked, self.pollId)
+	}
+
+	// Information
+	const qInformation = `UPDATE Polls SET Information = ? WHERE Id = ?`
+	if self.Information != "" {
+		self.DB.QuietExec(qInformation, self.Information, self.pollId)
+	}
+
+	// OneMove
+	const qOneMove = `UPDATE Polls SET RoundType = ? WHERE Id = ?`
+	if self.OneMove {
+		self.DB.QuietExec(qOneMove, db.RoundTypeOneMove, self.pollId)
+	}
+
 	// Users
 	switch self.UserType {
 	case pollTestUserTypeAdmin:
@@ -157,6 +187,12 @@ func (self *pollTest) Prepare(t *testing.T, loc *ioc.Locator) *ioc.Locator {
 		self.DB.QuietExec(qVerified, self.userId[1])
 	}
 
+	// Invited
+	const qInvited = `INSERT INTO Invitations (Poll, Email, User) VALUE (?, ?, ?)`
+	if self.Invited {
+		self.DB.QuietExec(qInvited, self.pollId, t.Name()+"@example.com", self.userId[1])
+	}
+
 	// Round
 	const qRound = `UPDATE Polls SET CurrentRound = ? WHERE Id = ?`
 	if self.Round > 0 {
@@ -172,6 +208,12 @@ func (self *pollTest) Prepare(t *testing.T, loc *ioc.Locator) *ioc.Locator {
 		self.DB.QuietExec(qWaiting, self.pollId)
 	}
 
+	// Paused
+	const qPaused = `UPDATE Polls SET State = 'Paused' WHERE Id = ?`
+	if self.Paused {
+		self.DB.QuietExec(qPaused, self.pollId)
+	}
+
 	// Participate
 	const qParticipate = `INSERT INTO Participants (User, Poll, Round) VALUE (?,?,?)`
 	for _, participate := range self.Participate {
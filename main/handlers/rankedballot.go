@@ -0,0 +1,50 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// RankedBallotAnswer represents the response sent by RankedBallotHandler.
+// Alternatives in Previous and Current are listed from the preferred one to the least preferred
+// one. These fields are not sent in the JSON representation if the user did not vote.
+// If the user abstained, these fields are replaced with fields PreviousIsBlank or CurrentIsBlank
+// with the boolean value true.
+type RankedBallotAnswer struct {
+	Previous        AlternativeList `json:",omitempty"`
+	PreviousIsBlank bool            `json:",omitempty"`
+	Current         AlternativeList `json:",omitempty"`
+	CurrentIsBlank  bool            `json:",omitempty"`
+	Alternatives    []PollAlternative
+}
+
+// RankedBallotHandler sends the previous ballot (if any), the current one (if any) and all the
+// alternatives.
+func RankedBallotHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+
+	var answer RankedBallotAnswer
+	answer.Previous, answer.PreviousIsBlank, answer.Current, answer.CurrentIsBlank =
+		userListBallots(ctx, pollInfo, request)
+
+	allAlternatives(ctx, pollInfo, &answer.Alternatives)
+	response.SendJSON(ctx, &answer)
+}
@@ -0,0 +1,121 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestRankedBallotHandler(t *testing.T) {
+	precheck(t)
+
+	env := new(dbt.Env)
+	defer env.Close()
+
+	userId := env.CreateUser()
+	pollId := env.CreatePollWith("RankedBallotHandler", userId, db.ElectorateAll,
+		[]string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET Type = ? WHERE Id = ?`, db.PollTypeRanked, pollId)
+	mustt(t, env.Error)
+
+	request := *makePollRequest(t, pollId, &userId)
+
+	alternatives := []PollAlternative{
+		{Id: 0, Name: "A", Cost: 1.},
+		{Id: 1, Name: "B", Cost: 1.},
+		{Id: 2, Name: "C", Cost: 1.},
+	}
+
+	// vote adds a ballot with alternatives in the given order.
+	vote := func(round uint8, alts ...uint8) func(t *testing.T) {
+		return func(t *testing.T) {
+			const (
+				qParticipate = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, ?)`
+				qVote        = `INSERT INTO Ballots (User, Poll, Alternative, Round, Rank) VALUE (?, ?, ?, ?, ?)`
+			)
+			env.QuietExec(qParticipate, userId, pollId, round)
+			for rank, alt := range alts {
+				env.QuietExec(qVote, userId, pollId, alt, round, rank+1)
+			}
+			env.Must(t)
+		}
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "No Ballot",
+			Request: request,
+			Checker: srvt.CheckJSON{Body: &RankedBallotAnswer{Alternatives: alternatives}},
+		},
+		&srvt.T{
+			Name:    "Current ballot",
+			Update:  vote(0, 2, 0, 1),
+			Request: request,
+			Checker: srvt.CheckJSON{Body: &RankedBallotAnswer{
+				Current:      AlternativeList{2, 0, 1},
+				Alternatives: alternatives,
+			}},
+		},
+		&srvt.T{
+			Name: "Previous ballot",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: request,
+			Checker: srvt.CheckJSON{Body: &RankedBallotAnswer{
+				Previous:     AlternativeList{2, 0, 1},
+				Alternatives: alternatives,
+			}},
+		},
+		&srvt.T{
+			Name:    "Partial ballot",
+			Update:  vote(1, 1, 2),
+			Request: request,
+			Checker: srvt.CheckJSON{Body: &RankedBallotAnswer{
+				Previous:     AlternativeList{2, 0, 1},
+				Current:      AlternativeList{1, 2},
+				Alternatives: alternatives,
+			}},
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:       "Unlogged public",
+			Electorate: db.ElectorateAll,
+			Ranked:     true,
+			Vote:       []pollTestVote{{1, 0, 1}},
+			UserType:   pollTestUserTypeUnlogged,
+			Checker: srvt.CheckJSON{Body: &RankedBallotAnswer{
+				Current: AlternativeList{1},
+				Alternatives: []PollAlternative{
+					{Id: 0, Name: "No", Cost: 1.},
+					{Id: 1, Name: "Yes", Cost: 1.},
+				},
+			}},
+		},
+	}
+	srvt.RunFunc(t, tests, RankedBallotHandler)
+}
@@ -0,0 +1,78 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/JBoudou/Itero/main/services"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/pkg/events"
+)
+
+// RankedVoteQuery is the ballot of a ranked poll. Alternatives are listed from the preferred one to
+// the least preferred one. Some alternatives may be missing, in which case they are considered
+// ranked after all the listed ones. An empty list of alternatives is a blank vote.
+type RankedVoteQuery struct {
+	Alternatives AlternativeList
+	Round        uint8
+}
+
+type rankedVoteHandler struct {
+	evtManager events.Manager
+}
+
+// RankedVoteHandler votes for an ordering of the alternatives. Blank votes are also permitted.
+func RankedVoteHandler(evtManager events.Manager) rankedVoteHandler {
+	return rankedVoteHandler{evtManager: evtManager}
+}
+
+func (self rankedVoteHandler) Handle(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, sendUnloggedCookie := checkVoteRequest(ctx, request, BallotTypeRanked)
+
+	// Get query
+	var voteQuery RankedVoteQuery
+	if err := request.UnmarshalJSONBody(&voteQuery); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Wrong request", err))
+	}
+	checkAlternativeSet(pollInfo, voteQuery.Alternatives)
+	checkVoteRound(pollInfo, voteQuery.Round)
+
+	const qInsertBallot = `
+	  INSERT INTO Ballots (User, Poll, Alternative, Round, Rank) VALUE (?, ?, ?, ?, ?)`
+
+	recordBallot(ctx, pollInfo, request.User.Id, func(tx *sql.Tx) {
+		if len(voteQuery.Alternatives) == 0 {
+			return
+		}
+		stmt, err := tx.PrepareContext(ctx, qInsertBallot)
+		must(err)
+		defer stmt.Close()
+		for rank, alt := range voteQuery.Alternatives {
+			_, err = stmt.ExecContext(ctx, request.User.Id, pollInfo.Id, alt, pollInfo.CurrentRound, rank+1)
+			must(err)
+		}
+	})
+
+	if sendUnloggedCookie {
+		response.SendUnloggedId(ctx, *request.User, request)
+	}
+	response.SendJSON(ctx, "Ok")
+	self.evtManager.Send(services.VoteEvent{Poll: pollInfo.Id})
+}
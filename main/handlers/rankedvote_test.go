@@ -0,0 +1,171 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+type rankedVoteChecker struct {
+	poll  uint32
+	user  uint32
+	round uint8
+}
+
+func (self *rankedVoteChecker) Check(t *testing.T, response *http.Response, request *server.Request) {
+	srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+	var query RankedVoteQuery
+	mustt(t, request.UnmarshalJSONBody(&query))
+
+	const (
+		qParticipate = `SELECT 1 FROM Participants WHERE Poll = ? AND User = ? AND Round = ?`
+		qBallot      = `
+		  SELECT Alternative, Rank FROM Ballots
+		   WHERE Poll = ? AND User = ? AND Round = ?
+		   ORDER BY Rank ASC`
+	)
+
+	rows, err := db.DB.Query(qParticipate, self.poll, self.user, self.round)
+	mustt(t, err)
+	if !rows.Next() {
+		t.Errorf("User %d does not participate in poll %d.", self.user, self.poll)
+	}
+	rows.Close()
+
+	rows, err = db.DB.Query(qBallot, self.poll, self.user, self.round)
+	mustt(t, err)
+	defer rows.Close()
+	got := AlternativeList{}
+	for rows.Next() {
+		var alt, rank uint8
+		mustt(t, rows.Scan(&alt, &rank))
+		if int(rank) != len(got)+1 {
+			t.Errorf("Wrong rank for alternative %d. Got %d. Expect %d.", alt, rank, len(got)+1)
+		}
+		got = append(got, alt)
+	}
+
+	expect := append(AlternativeList{}, query.Alternatives...)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v. Expect %v.", got, expect)
+	}
+}
+
+func rankedVoteCheckerFactory(param PollTestCheckerFactoryParam) srvt.Checker {
+	return &rankedVoteChecker{poll: param.PollId, user: param.UserId, round: param.Round}
+}
+
+func TestRankedVoteHandler(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUser()
+	pollId := env.CreatePollWith("Test", userId, db.ElectorateLogged, []string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET Type = ? WHERE Id = ?`, db.PollTypeRanked, pollId)
+	env.Must(t)
+
+	fillRequest := func(vote RankedVoteQuery, req srvt.Request) srvt.Request {
+		b, err := json.Marshal(vote)
+		mustt(t, err)
+		req.Body = string(b)
+		req.Method = "POST"
+		return req
+	}
+
+	makeRequest := func(vote RankedVoteQuery) srvt.Request {
+		return fillRequest(vote, *makePollRequest(t, pollId, &userId))
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "Full ordering",
+			Request: makeRequest(RankedVoteQuery{Alternatives: AlternativeList{2, 0, 1}}),
+			Checker: &rankedVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Partial ordering",
+			Request: makeRequest(RankedVoteQuery{Alternatives: AlternativeList{1, 2}}),
+			Checker: &rankedVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Blank",
+			Request: makeRequest(RankedVoteQuery{}),
+			Checker: &rankedVoteChecker{poll: pollId, user: userId, round: 0},
+		},
+		&srvt.T{
+			Name:    "Duplicate",
+			Request: makeRequest(RankedVoteQuery{Alternatives: AlternativeList{1, 0, 1}}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong alternative"},
+		},
+		&srvt.T{
+			Name:    "Unknown alternative",
+			Request: makeRequest(RankedVoteQuery{Alternatives: AlternativeList{0, 3}}),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong alternative"},
+		},
+		&srvt.T{
+			Name: "Next round",
+			Update: func(t *testing.T) {
+				env.NextRound(pollId)
+				env.Must(t)
+			},
+			Request: makeRequest(RankedVoteQuery{Alternatives: AlternativeList{0, 1, 2}, Round: 1}),
+			Checker: &rankedVoteChecker{poll: pollId, user: userId, round: 1},
+		},
+		&srvt.T{
+			Name:    "Previous round",
+			Request: makeRequest(RankedVoteQuery{Round: 0}),
+			Checker: srvt.CheckError{Code: http.StatusLocked, Body: "Next round"},
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:           "Unlogged public",
+			Electorate:     db.ElectorateAll,
+			Ranked:         true,
+			UserType:       pollTestUserTypeUnlogged,
+			Request:        fillRequest(RankedVoteQuery{Alternatives: AlternativeList{1, 0}}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+			Checker:        rankedVoteCheckerFactory,
+		},
+		&pollTest{
+			Name:           "Uninominal poll",
+			Electorate:     db.ElectorateLogged,
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(RankedVoteQuery{Alternatives: AlternativeList{1, 0}}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     0,
+			Checker:        srvt.CheckError{Code: http.StatusBadRequest, Body: "Wrong poll"},
+		},
+	}
+
+	srvt.Run(t, tests, RankedVoteHandler)
+}
@@ -0,0 +1,61 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/JBoudou/Itero/mid/outcome"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+type ResultInfoEntry struct {
+	Alternative PollAlternative
+	Score       float64
+}
+
+// ResultInfoAnswer is the answer of ResultInfoHandler.
+// Result lists all the alternatives, from the best to the worst, according to the rule of the poll.
+// Selection lists the alternatives selected within the budget of the poll.
+type ResultInfoAnswer struct {
+	Result    []ResultInfoEntry
+	Winners   AlternativeList
+	Selection AlternativeList
+}
+
+// ResultInfoHandler sends the outcome of a previous round, computed with the rule of the poll.
+// The meaning of the scores depends on that rule.
+func ResultInfoHandler(ctx context.Context, response server.Response, request *server.Request) {
+	pollInfo, round := checkInformationRequest(ctx, request, InformationTypeCounts)
+
+	result, err := outcome.Compute(ctx, pollInfo.Id, round)
+	must(err)
+
+	var alternatives []PollAlternative
+	allAlternatives(ctx, pollInfo, &alternatives)
+
+	answer := ResultInfoAnswer{
+		Result:    make([]ResultInfoEntry, len(result.Ranking)),
+		Winners:   AlternativeList(result.Winners),
+		Selection: AlternativeList(result.Selection),
+	}
+	for i, alt := range result.Ranking {
+		answer.Result[i].Alternative = alternatives[alt]
+		answer.Result[i].Score = result.Scores[alt]
+	}
+	response.SendJSON(ctx, answer)
+}
@@ -0,0 +1,134 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestResultInfoHandler(t *testing.T) {
+	precheck(t)
+
+	const (
+		qRule   = `UPDATE Polls SET Rule = ? WHERE Id = ?`
+		qRanked = `UPDATE Polls SET Type = ? WHERE Id = ?`
+		qVote   = `INSERT INTO Ballots (User, Poll, Alternative, Round, Rank) VALUE (?, ?, ?, 0, ?)`
+		qPart   = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, 0)`
+	)
+
+	var env dbt.Env
+	defer env.Close()
+	var users [3]uint32
+	for i := range users {
+		users[i] = env.CreateUserWith(strconv.FormatInt(int64(i), 10))
+	}
+
+	alt := []string{"Ham", "Stram", "Gram"}
+	altAns := [3]PollAlternative{
+		{Id: 0, Name: "Ham", Cost: 1},
+		{Id: 1, Name: "Stram", Cost: 1},
+		{Id: 2, Name: "Gram", Cost: 1},
+	}
+
+	uniPoll := env.CreatePollWith("Uninominal", users[0], db.ElectorateAll, alt)
+	env.Vote(uniPoll, 0, users[0], 2)
+	env.Vote(uniPoll, 0, users[1], 2)
+	env.Vote(uniPoll, 0, users[2], 0)
+
+	rankedPoll := env.CreatePollWith("Ranked", users[0], db.ElectorateAll, alt)
+	env.QuietExec(qRanked, db.PollTypeRanked, rankedPoll)
+	env.QuietExec(qRule, db.PollRuleBorda, rankedPoll)
+	for i, ballot := range [3][]uint8{{0, 1, 2}, {1, 0, 2}, {1, 2, 0}} {
+		env.QuietExec(qPart, users[i], rankedPoll)
+		for rank, alt := range ballot {
+			env.QuietExec(qVote, users[i], rankedPoll, alt, rank+1)
+		}
+	}
+	env.NextRound(rankedPoll)
+	env.Must(t)
+
+	// Each pair of the first parameter consists of the alternative index and its score.
+	makeChecker := func(result [][2]float64, winners, selection AlternativeList) srvt.Checker {
+		entries := make([]ResultInfoEntry, len(result))
+		for i, val := range result {
+			entries[i].Alternative = altAns[int(val[0])]
+			entries[i].Score = val[1]
+		}
+		return srvt.CheckJSON{Body: ResultInfoAnswer{Result: entries, Winners: winners, Selection: selection}}
+	}
+
+	tests := []srvt.Test{
+
+		// Sequential tests first //
+
+		&srvt.T{
+			Name:    "Round Zero",
+			Request: *makePollRequest(t, uniPoll, &users[0]),
+			Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Protocol error"},
+		},
+		&srvt.T{
+			Name: "Plurality",
+			Update: func(t *testing.T) {
+				env.NextRound(uniPoll)
+				env.Must(t)
+			},
+			Request: *makePollRequest(t, uniPoll, &users[0]),
+			Checker: makeChecker([][2]float64{{2, 2}, {0, 1}, {1, 0}}, AlternativeList{2}, AlternativeList{2}),
+		},
+		&srvt.T{
+			Name:    "Borda",
+			Request: *makePollRequest(t, rankedPoll, &users[0]),
+			Checker: makeChecker([][2]float64{{1, 5}, {0, 3}, {2, 1}}, AlternativeList{1}, AlternativeList{1}),
+		},
+		&srvt.T{
+			Name: "Budget",
+			Update: func(t *testing.T) {
+				env.QuietExec(`UPDATE Polls SET MaxOutcomeCost = 2 WHERE Id = ?`, rankedPoll)
+				env.Must(t)
+			},
+			Request: *makePollRequest(t, rankedPoll, &users[0]),
+			Checker: makeChecker([][2]float64{{1, 5}, {0, 3}, {2, 1}}, AlternativeList{1}, AlternativeList{0, 1}),
+		},
+
+		// Independent tests //
+
+		&pollTest{
+			Name:         "Unlogged public",
+			Electorate:   db.ElectorateAll,
+			Alternatives: alt,
+			UserType:     pollTestUserTypeUnlogged,
+			Vote:         []pollTestVote{{2, 0, 0}, {3, 0, 0}, {4, 0, 2}},
+			Round:        1,
+			Checker:      makeChecker([][2]float64{{0, 2}, {2, 1}, {1, 0}}, AlternativeList{0}, AlternativeList{0}),
+		},
+		&pollTest{
+			Name:         "Unlogged registered",
+			Electorate:   db.ElectorateLogged,
+			Alternatives: alt,
+			UserType:     pollTestUserTypeUnlogged,
+			Round:        1,
+			Checker:      srvt.CheckError{Code: http.StatusForbidden, Body: "Unlogged"},
+		},
+	}
+	srvt.RunFunc(t, tests, ResultInfoHandler)
+}
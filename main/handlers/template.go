@@ -0,0 +1,132 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// TemplateEntry is a named template of CreateQuery.
+// The fields Start, Deadline and Template of the query are not stored in templates.
+type TemplateEntry struct {
+	Name  string
+	Query CreateQuery
+}
+
+// TemplateNameQuery designates a template of the user.
+type TemplateNameQuery struct {
+	Name string
+}
+
+// loadTemplate replaces values of query by the ones stored in the template. The Deadline of the
+// query is kept.
+// Errors are sent by panic.
+func loadTemplate(ctx context.Context, user uint32, name string, query *CreateQuery) {
+	const qTemplate = `SELECT Query FROM Templates WHERE User = ? AND Name = ?`
+
+	var stored []byte
+	err := db.DB.QueryRowContext(ctx, qTemplate, user, name).Scan(&stored)
+	if err == sql.ErrNoRows {
+		panic(server.NewHttpError(http.StatusNotFound, "No template", "No such template"))
+	}
+	must(err)
+
+	deadline := query.Deadline
+	must(json.Unmarshal(stored, query))
+	if query.Deadline.IsZero() {
+		query.Deadline = deadline
+	}
+}
+
+// TemplateListHandler sends the list of templates of the user, sorted by name.
+func TemplateListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	const qList = `SELECT Name, Query FROM Templates WHERE User = ? ORDER BY Name`
+
+	rows, err := db.DB.QueryContext(ctx, qList, request.User.Id)
+	must(err)
+	defer rows.Close()
+	answer := []TemplateEntry{}
+	for rows.Next() {
+		var entry TemplateEntry
+		var stored []byte
+		must(rows.Scan(&entry.Name, &stored))
+		must(json.Unmarshal(stored, &entry.Query))
+		answer = append(answer, entry)
+	}
+	must(rows.Err())
+
+	response.SendJSON(ctx, answer)
+}
+
+// TemplateSaveHandler stores a template for the user. An existing template with the same name is
+// replaced.
+func TemplateSaveHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	var entry TemplateEntry
+	if err := request.UnmarshalJSONBody(&entry); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if len(entry.Name) < 1 || len(entry.Name) > 128 {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Wrong template name"))
+	}
+	entry.Query.Start = time.Time{}
+	entry.Query.Deadline = time.Time{}
+	entry.Query.Template = ""
+	stored, err := json.Marshal(entry.Query)
+	must(err)
+
+	const qSave = `
+	  INSERT INTO Templates (User, Name, Query) VALUE (?, ?, ?)
+	      ON DUPLICATE KEY UPDATE Query = VALUES(Query)`
+	_, err = db.DB.ExecContext(ctx, qSave, request.User.Id, entry.Name, stored)
+	must(err)
+
+	response.SendJSON(ctx, "Ok")
+}
+
+// TemplateDeleteHandler removes a template of the user.
+func TemplateDeleteHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	var query TemplateNameQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	const qDelete = `DELETE FROM Templates WHERE User = ? AND Name = ?`
+	result, err := db.DB.ExecContext(ctx, qDelete, request.User.Id, query.Name)
+	must(err)
+	affected, err := result.RowsAffected()
+	must(err)
+	if affected == 0 {
+		panic(server.NewHttpError(http.StatusNotFound, "No template", "No such template"))
+	}
+
+	response.SendJSON(ctx, "Ok")
+}
@@ -0,0 +1,148 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestTemplateHandlers(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUserWith("Template")
+	env.Must(t)
+
+	makeRequest := func(body interface{}) srvt.Request {
+		encoded, err := json.Marshal(body)
+		mustt(t, err)
+		return srvt.Request{UserId: &userId, Method: "POST", Body: string(encoded)}
+	}
+
+	query := defaultCreateQuery()
+	query.Title = "Weekly"
+	query.MinNbRounds = 3
+	query.Alternatives = []SimpleAlternative{{Name: "Ham", Cost: 1}, {Name: "Stram", Cost: 1}}
+
+	// What is actually stored.
+	saved := query
+	saved.Deadline = time.Time{}
+
+	createChecker := srvt.CheckerFun(func(t *testing.T, response *http.Response,
+		request *server.Request) {
+
+		srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+		const (
+			qPoll    = `SELECT Title, MinNbRounds, NbChoices, Deadline > CURRENT_TIMESTAMP FROM Polls WHERE Id = ?`
+			qCleanUp = `DELETE FROM Polls WHERE Id = ?`
+		)
+		var answer string
+		mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+		segment, err := salted.Decode(answer)
+		mustt(t, err)
+		defer db.DB.Exec(qCleanUp, segment.Id)
+
+		var title string
+		var minNbRounds, nbChoices uint8
+		var future bool
+		row := db.DB.QueryRow(qPoll, segment.Id)
+		mustt(t, row.Scan(&title, &minNbRounds, &nbChoices, &future))
+		if title != "Week 2" {
+			t.Errorf("Wrong title. Got %s. Expect Week 2.", title)
+		}
+		if minNbRounds != 3 {
+			t.Errorf("Wrong MinNbRounds. Got %d. Expect 3.", minNbRounds)
+		}
+		if nbChoices != 2 {
+			t.Errorf("Wrong NbChoices. Got %d. Expect 2.", nbChoices)
+		}
+		if !future {
+			t.Errorf("Deadline is not in the future.")
+		}
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: srvt.Request{Method: "POST", Body: `{"Name":"Weekly"}`},
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			},
+			&srvt.T{
+				Name:    "No name",
+				Request: makeRequest(TemplateEntry{Query: query}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: makeRequest(TemplateEntry{Name: "Weekly", Query: query}),
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+		}, TemplateSaveHandler)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId},
+				Checker: srvt.CheckJSON{Body: []TemplateEntry{{Name: "Weekly", Query: saved}}},
+			},
+		}, TemplateListHandler)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		srvt.Run(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Unknown template",
+				Request: makeRequest(CreateQuery{Template: "Monthly", Title: "Week 2"}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No template"},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId, Method: "POST", Body: `{"Template":"Weekly","Title":"Week 2"}`},
+				Checker: createChecker,
+			},
+		}, CreateHandler)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: makeRequest(TemplateNameQuery{Name: "Weekly"}),
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+			&srvt.T{
+				Name:    "Already deleted",
+				Request: makeRequest(TemplateNameQuery{Name: "Weekly"}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No template"},
+			},
+		}, TemplateDeleteHandler)
+	})
+}
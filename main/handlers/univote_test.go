@@ -257,6 +257,40 @@ func TestUninominalVoteHandler(t *testing.T) {
 			Checker:        voteCheckerFactory,
 		},
 
+		&pollTest{
+			Name:           "One move first",
+			Electorate:     db.ElectorateAll,
+			OneMove:        true,
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(UninominalVoteQuery{Alternative: 0}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+			Checker:        voteCheckerFactory,
+		},
+		&pollTest{
+			Name:           "One move change",
+			Electorate:     db.ElectorateAll,
+			OneMove:        true,
+			Vote:           []pollTestVote{{User: 1, Alt: 1}},
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(UninominalVoteQuery{Alternative: 0}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     0,
+			Checker:        srvt.CheckError{Code: http.StatusConflict, Body: "Already voted"},
+		},
+		&pollTest{
+			Name:           "One move previous round",
+			Electorate:     db.ElectorateAll,
+			OneMove:        true,
+			Vote:           []pollTestVote{{User: 1, Alt: 1}},
+			Round:          1,
+			UserType:       pollTestUserTypeLogged,
+			Request:        fillRequest(UninominalVoteQuery{Alternative: 0, Round: 1}, srvt.Request{}),
+			EventPredicate: checkVoteEvent,
+			EventCount:     1,
+			Checker:        voteCheckerFactory,
+		},
+
 		&pollTest{
 			Name:           "No user registered",
 			Electorate:     db.ElectorateLogged,
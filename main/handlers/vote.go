@@ -0,0 +1,157 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/mid/unlogged"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// AlternativeList is a list of alternative ids.
+// Contrary to []uint8, it is encoded in JSON as an array of numbers.
+type AlternativeList []uint8
+
+// MarshalJSON implements json.Marshaler.
+func (self AlternativeList) MarshalJSON() ([]byte, error) {
+	if self == nil {
+		return []byte("null"), nil
+	}
+	converted := make([]uint16, len(self))
+	for i, alt := range self {
+		converted[i] = uint16(alt)
+	}
+	return json.Marshal(converted)
+}
+
+// costEpsilon is the tolerance used when comparing sums of costs.
+const costEpsilon = 1e-9
+
+// checkVoteRequest does all the verifications common to vote handlers and returns the information
+// on the poll. If the request has no user, request.User is set to the unlogged pseudo-user
+// corresponding to the remote address, and sendUnloggedCookie is true.
+// Errors are sent by panic.
+func checkVoteRequest(ctx context.Context, request *server.Request, ballotType BallotType) (
+	pollInfo PollInfo, sendUnloggedCookie bool) {
+
+	must(request.CheckPOST(ctx))
+	pollInfo, err := checkPollAccess(ctx, request)
+	must(err)
+	if !pollInfo.Active {
+		panic(server.NewHttpError(http.StatusLocked, "Inactive poll", "Poll is currently not active"))
+	}
+	if pollInfo.BallotType() != ballotType {
+		panic(server.NewHttpError(http.StatusBadRequest, "Wrong poll", "Wrong ballot type"))
+	}
+
+	// Unlogged
+	sendUnloggedCookie = request.User == nil
+	if sendUnloggedCookie {
+		var user server.User
+		user, err = unlogged.FromAddr(ctx, request.RemoteAddr())
+		must(err)
+		request.User = &user
+	}
+	return
+}
+
+// checkVoteRound ensures that the round of the vote query is the current round of the poll.
+// Errors are sent by panic.
+func checkVoteRound(pollInfo PollInfo, round uint8) {
+	// We should check after the DB operations, but it is more difficul and the difference is
+	// insignificant.
+	if round == pollInfo.CurrentRound {
+		return
+	}
+	if round+1 == pollInfo.CurrentRound {
+		panic(server.NewHttpError(http.StatusLocked, "Next round",
+			"Round may have changed while the user voted"))
+	}
+	panic(server.NewHttpError(http.StatusBadRequest, "Wrong round",
+		"Round is neither current nor previous"))
+}
+
+// checkAlternativeSet ensures that the list contains only alternatives of the poll, without
+// duplicates.
+// Errors are sent by panic.
+func checkAlternativeSet(pollInfo PollInfo, list AlternativeList) {
+	seen := make([]bool, pollInfo.NbChoices)
+	for _, alt := range list {
+		if alt >= pollInfo.NbChoices {
+			panic(server.NewHttpError(http.StatusBadRequest, "Wrong alternative", "No such alternative"))
+		}
+		if seen[alt] {
+			panic(server.NewHttpError(http.StatusBadRequest, "Wrong alternative", "Duplicated alternative"))
+		}
+		seen[alt] = true
+	}
+}
+
+// recordBallot replaces the ballot of user for the current round of the poll.
+// The previous ballot and the delegation of the user for the current round are deleted and the user
+// is added to the participants if needed, then insert is called, inside the same transaction, to add
+// the rows of the new ballot. Blank ballots are recorded by an insert function that does nothing.
+// For polls allowing only one move per round, an error is sent by panic if the user already voted
+// during the current round.
+func recordBallot(ctx context.Context, pollInfo PollInfo, user uint32, insert func(tx *sql.Tx)) {
+	const (
+		qDeleteBallot      = `DELETE FROM Ballots WHERE User = ? AND Poll = ? AND Round = ?`
+		qDeleteDelegation  = `DELETE FROM Delegations WHERE User = ? AND Poll = ? AND Round = ?`
+		qLastRound         = `SELECT 1 FROM Participants WHERE User = ? AND Poll = ? AND Round = ?`
+		qInsertParticipant = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, ?)`
+	)
+
+	db.RepeatDeadlocked(slog.CtxLoadLogger(ctx), ctx, nil, func(tx *sql.Tx) {
+		if pollInfo.OneMove() {
+			rows, err := tx.QueryContext(ctx, qLastRound+` FOR UPDATE`, user, pollInfo.Id,
+				pollInfo.CurrentRound)
+			must(err)
+			voted := rows.Next()
+			must(rows.Close())
+			if voted {
+				panic(server.NewHttpError(http.StatusConflict, "Already voted",
+					"Only one move per round is allowed"))
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, qDeleteDelegation, user, pollInfo.Id, pollInfo.CurrentRound)
+		must(err)
+
+		result, err := tx.ExecContext(ctx, qDeleteBallot, user, pollInfo.Id, pollInfo.CurrentRound)
+		must(err)
+
+		// Insert a row in Participants if needed
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			var rows *sql.Rows
+			rows, err = tx.QueryContext(ctx, qLastRound, user, pollInfo.Id, pollInfo.CurrentRound)
+			must(err)
+			if !rows.Next() {
+				_, err = tx.ExecContext(ctx, qInsertParticipant, user, pollInfo.Id, pollInfo.CurrentRound)
+				must(err)
+			}
+			must(rows.Close())
+		}
+
+		insert(tx)
+	})
+}
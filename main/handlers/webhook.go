@@ -0,0 +1,248 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// WebhookQuery registers a webhook. If Poll is empty, the webhook receives notifications for all
+// the polls administrated by the user.
+type WebhookQuery struct {
+	URL  string
+	Poll string `json:",omitempty"`
+}
+
+// WebhookAnswer is sent when a webhook has been registered. Secret is the key used to sign the
+// payloads. It is never sent again.
+type WebhookAnswer struct {
+	Id     uint32
+	Secret string
+}
+
+// WebhookIdQuery designates a webhook of the user.
+type WebhookIdQuery struct {
+	Id uint32
+}
+
+// WebhookEntry describes a webhook of the user, with the number of its deliveries in each status.
+type WebhookEntry struct {
+	Id        uint32
+	URL       string
+	Poll      string `json:",omitempty"`
+	Title     string `json:",omitempty"`
+	Created   time.Time
+	Pending   uint32
+	Delivered uint32
+	Failed    uint32
+}
+
+// WebhookDelivery describes a notification posted, or to be posted, to a webhook.
+type WebhookDelivery struct {
+	Id          uint32
+	Event       string
+	Status      string
+	Attempts    uint8
+	LastCode    uint16 `json:",omitempty"`
+	LastError   string `json:",omitempty"`
+	Created     time.Time
+	NextAttempt time.Time
+}
+
+const (
+	webhookMaxURL      = 512
+	webhookSecretBytes = 32
+	webhookDeliveries  = 50
+)
+
+func noWebhookError(reason string) server.HttpError {
+	return server.NewHttpError(http.StatusNotFound, "No webhook", reason)
+}
+
+// checkWebhookURL ensures that str is an absolute HTTP URL.
+// Errors are sent by panic.
+func checkWebhookURL(str string) {
+	if len(str) > webhookMaxURL {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "URL too long"))
+	}
+	parsed, err := url.Parse(str)
+	if err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "Wrong URL"))
+	}
+}
+
+// WebhookAddHandler registers a webhook for the user, either for one of its polls or for all of
+// them.
+func WebhookAddHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	var query WebhookQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	checkWebhookURL(query.URL)
+
+	var poll sql.NullInt64
+	if query.Poll != "" {
+		const qPoll = `SELECT 1 FROM Polls WHERE Id = ? AND Salt = ? AND Admin = ?`
+		segment, err := salted.Decode(query.Poll)
+		if err != nil {
+			panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+		}
+		var found bool
+		err = db.DB.QueryRowContext(ctx, qPoll, segment.Id, segment.Salt, request.User.Id).Scan(&found)
+		if err == sql.ErrNoRows {
+			panic(noPollError("Not the administrator"))
+		}
+		must(err)
+		poll = sql.NullInt64{Int64: int64(segment.Id), Valid: true}
+	}
+
+	buff := make([]byte, webhookSecretBytes)
+	_, err := rand.Read(buff)
+	must(err)
+	answer := WebhookAnswer{Secret: hex.EncodeToString(buff)}
+
+	const qInsert = `INSERT INTO Webhooks (User, Poll, URL, Secret) VALUE (?, ?, ?, ?)`
+	result, err := db.DB.ExecContext(ctx, qInsert, request.User.Id, poll, query.URL, answer.Secret)
+	must(err)
+	id, err := result.LastInsertId()
+	must(err)
+	answer.Id = uint32(id)
+
+	response.SendJSON(ctx, answer)
+}
+
+// WebhookListHandler sends the list of webhooks of the user.
+func WebhookListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	const qList = `
+	  SELECT w.Id, w.URL, w.Poll, p.Salt, IFNULL(p.Title, ''), w.Created,
+	         COUNT(IF(d.Status = 'Pending', 1, NULL)),
+	         COUNT(IF(d.Status = 'Delivered', 1, NULL)),
+	         COUNT(IF(d.Status = 'Failed', 1, NULL))
+	    FROM Webhooks AS w
+	    LEFT OUTER JOIN Polls AS p ON w.Poll = p.Id
+	    LEFT OUTER JOIN WebhookDeliveries AS d ON d.Webhook = w.Id
+	   WHERE w.User = ?
+	   GROUP BY w.Id
+	   ORDER BY w.Id`
+
+	rows, err := db.DB.QueryContext(ctx, qList, request.User.Id)
+	must(err)
+	defer rows.Close()
+	answer := []WebhookEntry{}
+	for rows.Next() {
+		var entry WebhookEntry
+		var poll, salt sql.NullInt64
+		must(rows.Scan(&entry.Id, &entry.URL, &poll, &salt, &entry.Title, &entry.Created,
+			&entry.Pending, &entry.Delivered, &entry.Failed))
+		if poll.Valid && salt.Valid {
+			entry.Poll, err = salted.Segment{Id: uint32(poll.Int64), Salt: uint32(salt.Int64)}.Encode()
+			must(err)
+		}
+		answer = append(answer, entry)
+	}
+	must(rows.Err())
+
+	response.SendJSON(ctx, answer)
+}
+
+// WebhookDeleteHandler removes a webhook of the user, with all its deliveries.
+func WebhookDeleteHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+	must(request.CheckPOST(ctx))
+
+	var query WebhookIdQuery
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	const qDelete = `DELETE FROM Webhooks WHERE Id = ? AND User = ?`
+	result, err := db.DB.ExecContext(ctx, qDelete, query.Id, request.User.Id)
+	must(err)
+	affected, err := result.RowsAffected()
+	must(err)
+	if affected == 0 {
+		panic(noWebhookError("No such webhook"))
+	}
+
+	response.SendJSON(ctx, "Ok")
+}
+
+// WebhookDeliveriesHandler sends the most recent deliveries of a webhook of the user, the most
+// recent first. The webhook is identified by the last element of the path.
+func WebhookDeliveriesHandler(ctx context.Context, response server.Response,
+	request *server.Request) {
+	checkLoggedUser(request)
+
+	if len(request.RemainingPath) == 0 {
+		panic(noWebhookError("No webhook id"))
+	}
+	id, err := strconv.ParseUint(request.RemainingPath[len(request.RemainingPath)-1], 10, 32)
+	if err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+
+	const (
+		qWebhook = `SELECT 1 FROM Webhooks WHERE Id = ? AND User = ?`
+		qList    = `
+		  SELECT Id, Event, Status, Attempts, IFNULL(LastCode, 0), IFNULL(LastError, ''), Created,
+		         NextAttempt
+		    FROM WebhookDeliveries
+		   WHERE Webhook = ?
+		   ORDER BY Id DESC
+		   LIMIT ?`
+	)
+
+	var found bool
+	err = db.DB.QueryRowContext(ctx, qWebhook, id, request.User.Id).Scan(&found)
+	if err == sql.ErrNoRows {
+		panic(noWebhookError("No such webhook"))
+	}
+	must(err)
+
+	rows, err := db.DB.QueryContext(ctx, qList, id, webhookDeliveries)
+	must(err)
+	defer rows.Close()
+	answer := []WebhookDelivery{}
+	for rows.Next() {
+		var entry WebhookDelivery
+		must(rows.Scan(&entry.Id, &entry.Event, &entry.Status, &entry.Attempts, &entry.LastCode,
+			&entry.LastError, &entry.Created, &entry.NextAttempt))
+		answer = append(answer, entry)
+	}
+	must(rows.Err())
+
+	response.SendJSON(ctx, answer)
+}
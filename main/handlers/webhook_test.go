@@ -0,0 +1,182 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func TestWebhookHandlers(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	userId := env.CreateUserWith("Webhook")
+	otherId := env.CreateUserWith("WebhookOther")
+	pollId := env.CreatePoll("Webhook", userId, db.ElectorateAll)
+	otherPollId := env.CreatePoll("WebhookOther", otherId, db.ElectorateAll)
+	env.Must(t)
+
+	encodePoll := func(id uint32) string {
+		const qSalt = `SELECT Salt FROM Polls WHERE Id = ?`
+		segment := salted.Segment{Id: id}
+		mustt(t, db.DB.QueryRow(qSalt, id).Scan(&segment.Salt))
+		encoded, err := segment.Encode()
+		mustt(t, err)
+		return encoded
+	}
+	pollSegment := encodePoll(pollId)
+	otherPollSegment := encodePoll(otherPollId)
+
+	makeRequest := func(body interface{}) srvt.Request {
+		encoded, err := json.Marshal(body)
+		mustt(t, err)
+		return srvt.Request{UserId: &userId, Method: "POST", Body: string(encoded)}
+	}
+
+	var ids []uint32
+	addChecker := srvt.CheckerFun(func(t *testing.T, response *http.Response,
+		request *server.Request) {
+
+		srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+		var answer WebhookAnswer
+		mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+		if len(answer.Secret) != 2*webhookSecretBytes {
+			t.Errorf("Wrong secret %s.", answer.Secret)
+		}
+		ids = append(ids, answer.Id)
+	})
+
+	t.Run("Add", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "No user",
+				Request: srvt.Request{Method: "POST", Body: `{"URL":"https://example.com/hook"}`},
+				Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+			},
+			&srvt.T{
+				Name:    "Wrong URL",
+				Request: makeRequest(WebhookQuery{URL: "ftp://example.com/hook"}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+			&srvt.T{
+				Name:    "Relative URL",
+				Request: makeRequest(WebhookQuery{URL: "/hook"}),
+				Checker: srvt.CheckError{Code: http.StatusBadRequest, Body: "Bad request"},
+			},
+			&srvt.T{
+				Name:    "Other poll",
+				Request: makeRequest(WebhookQuery{URL: "https://example.com/hook", Poll: otherPollSegment}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No poll"},
+			},
+			&srvt.T{
+				Name:    "Account",
+				Request: makeRequest(WebhookQuery{URL: "https://example.com/all"}),
+				Checker: addChecker,
+			},
+			&srvt.T{
+				Name:    "Poll",
+				Request: makeRequest(WebhookQuery{URL: "https://example.com/poll", Poll: pollSegment}),
+				Checker: addChecker,
+			},
+		}, WebhookAddHandler)
+	})
+	if len(ids) != 2 {
+		t.Fatalf("Wrong number of webhooks. Got %d. Expect 2.", len(ids))
+	}
+
+	const qDelivery = `
+	  INSERT INTO WebhookDeliveries (Webhook, Event, Payload, Status, Attempts, LastCode)
+	  VALUE (?, 'start', '{}', 'Delivered', 1, 200)`
+	_, err := db.DB.Exec(qDelivery, ids[1])
+	mustt(t, err)
+
+	t.Run("List", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId},
+				Checker: srvt.CheckerFun(func(t *testing.T, response *http.Response,
+					request *server.Request) {
+
+					srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+					var answer []WebhookEntry
+					mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+					if len(answer) != 2 {
+						t.Fatalf("Wrong number of webhooks. Got %d. Expect 2.", len(answer))
+					}
+					if answer[0].URL != "https://example.com/all" || answer[0].Poll != "" {
+						t.Errorf("Wrong account webhook %v.", answer[0])
+					}
+					if answer[1].Poll != pollSegment || answer[1].Title != "Webhook" ||
+						answer[1].Delivered != 1 || answer[1].Pending != 0 {
+						t.Errorf("Wrong poll webhook %v.", answer[1])
+					}
+				}),
+			},
+		}, WebhookListHandler)
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		target := fmt.Sprintf("/a/test/%d", ids[1])
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Other user",
+				Request: srvt.Request{UserId: &otherId, Target: &target},
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No webhook"},
+			},
+			&srvt.T{
+				Name:    "Success",
+				Request: srvt.Request{UserId: &userId, Target: &target},
+				Checker: srvt.CheckerFun(func(t *testing.T, response *http.Response,
+					request *server.Request) {
+
+					srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+					var answer []WebhookDelivery
+					mustt(t, json.NewDecoder(response.Body).Decode(&answer))
+					if len(answer) != 1 || answer[0].Status != "Delivered" || answer[0].LastCode != 200 {
+						t.Errorf("Wrong deliveries %v.", answer)
+					}
+				}),
+			},
+		}, WebhookDeliveriesHandler)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		srvt.RunFunc(t, []srvt.Test{
+			&srvt.T{
+				Name:    "Success",
+				Request: makeRequest(WebhookIdQuery{Id: ids[0]}),
+				Checker: srvt.CheckStatus{Code: http.StatusOK},
+			},
+			&srvt.T{
+				Name:    "Already deleted",
+				Request: makeRequest(WebhookIdQuery{Id: ids[0]}),
+				Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No webhook"},
+			},
+		}, WebhookDeleteHandler)
+	})
+}
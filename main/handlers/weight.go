@@ -0,0 +1,141 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+)
+
+// WeightEntry is the weight of a participant of a poll. The participant is identified either by
+// its Name or by the Email address it has been invited with. Participants without any explicit
+// weight have a weight of one.
+type WeightEntry struct {
+	Name   string `json:",omitempty"`
+	Email  string `json:",omitempty"`
+	Weight uint32
+}
+
+// WeightList is both the body of weight requests and the answer to weight list requests.
+type WeightList struct {
+	Weights []WeightEntry
+}
+
+// WeightHandler sets the weights of some participants of a poll. Only the administrator of the
+// poll can set weights, and only before the poll is terminated.
+func WeightHandler(ctx context.Context, response server.Response, request *server.Request) {
+	const (
+		qEmail = `SELECT User FROM Invitations WHERE Poll = ? AND Email = ?`
+		qName  = `
+		  SELECT u.Id
+		    FROM Users AS u
+		   WHERE u.Name = ?
+		     AND (   EXISTS (SELECT 1 FROM Participants AS p WHERE (p.Poll, p.User) = (?, u.Id))
+		          OR EXISTS (SELECT 1 FROM Invitations  AS i WHERE (i.Poll, i.User) = (?, u.Id)))
+		   LIMIT 1`
+		qUpsert = `
+		  INSERT INTO Weights (Poll, User, Weight) VALUE (?, ?, ?)
+		      ON DUPLICATE KEY UPDATE Weight = VALUES(Weight)`
+	)
+
+	var query WeightList
+	if err := request.UnmarshalJSONBody(&query); err != nil {
+		panic(server.WrapError(http.StatusBadRequest, "Bad request", err))
+	}
+	if len(query.Weights) == 0 {
+		panic(server.NewHttpError(http.StatusBadRequest, "Bad request", "No weight"))
+	}
+
+	states := []db.State{db.StateWaiting, db.StateActive, db.StatePaused}
+	controlPoll(ctx, request, states, func(tx *sql.Tx, poll controlledPoll) {
+		for _, entry := range query.Weights {
+			var rows *sql.Rows
+			var err error
+			if email := strings.TrimSpace(entry.Email); email != "" {
+				rows, err = tx.QueryContext(ctx, qEmail, poll.Id, email)
+			} else {
+				rows, err = tx.QueryContext(ctx, qName, entry.Name, poll.Id, poll.Id)
+			}
+			must(err)
+			if !rows.Next() {
+				rows.Close()
+				panic(server.NewHttpError(http.StatusNotFound, "No participant",
+					"No participant named "+entry.Name+entry.Email))
+			}
+			var user uint32
+			err = rows.Scan(&user)
+			rows.Close()
+			must(err)
+
+			_, err = tx.ExecContext(ctx, qUpsert, poll.Id, user, entry.Weight)
+			must(err)
+		}
+	})
+
+	response.SendJSON(ctx, "Ok")
+}
+
+// WeightListHandler sends the weights of all participants and invitees of a poll to its
+// administrator. Anonymous participants, having neither name nor invitation, are not listed.
+func WeightListHandler(ctx context.Context, response server.Response, request *server.Request) {
+	checkLoggedUser(request)
+
+	segment, err := salted.FromRequest(request)
+	must(err)
+
+	const (
+		qPoll    = `SELECT Salt FROM Polls WHERE Id = ? AND Admin = ?`
+		qWeights = `
+		  SELECT IFNULL(u.Name, ''), IFNULL(i.Email, ''), IFNULL(w.Weight, 1)
+		    FROM (
+		           SELECT User FROM Participants WHERE Poll = ?
+		            UNION
+		           SELECT User FROM Invitations  WHERE Poll = ?
+		         ) AS x
+		    JOIN Users AS u ON x.User = u.Id
+		    LEFT OUTER JOIN Invitations AS i ON (i.Poll, i.User) = (?, x.User)
+		    LEFT OUTER JOIN Weights     AS w ON (w.Poll, w.User) = (?, x.User)
+		   WHERE u.Name IS NOT NULL OR i.Email IS NOT NULL
+		   ORDER BY u.Name, i.Email`
+	)
+
+	var salt uint32
+	err = db.DB.QueryRowContext(ctx, qPoll, segment.Id, request.User.Id).Scan(&salt)
+	if err == sql.ErrNoRows || (err == nil && salt != segment.Salt) {
+		panic(noPollError("Not the administrator of the poll"))
+	}
+	must(err)
+
+	rows, err := db.DB.QueryContext(ctx, qWeights, segment.Id, segment.Id, segment.Id, segment.Id)
+	must(err)
+	defer rows.Close()
+	answer := WeightList{Weights: []WeightEntry{}}
+	for rows.Next() {
+		var entry WeightEntry
+		must(rows.Scan(&entry.Name, &entry.Email, &entry.Weight))
+		answer.Weights = append(answer.Weights, entry)
+	}
+	must(rows.Err())
+
+	response.SendJSON(ctx, answer)
+}
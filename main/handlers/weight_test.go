@@ -0,0 +1,135 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/server"
+	srvt "github.com/JBoudou/Itero/mid/server/servertest"
+)
+
+func weightTestRequest(t *testing.T, entry WeightEntry) srvt.Request {
+	body, err := json.Marshal(WeightList{Weights: []WeightEntry{entry}})
+	mustt(t, err)
+	return srvt.Request{Method: "POST", Body: string(body)}
+}
+
+// weightTestChecker checks that the participant named name has the given weight.
+func weightTestChecker(name string, weight uint32) pollTestCheckerFactory {
+	return func(param PollTestCheckerFactoryParam) srvt.Checker {
+		return srvt.CheckerFun(func(t *testing.T, response *http.Response, request *server.Request) {
+			srvt.CheckStatus{Code: http.StatusOK}.Check(t, response, request)
+
+			const qCheck = `
+			  SELECT w.Weight
+			    FROM Weights AS w JOIN Users AS u ON w.User = u.Id
+			   WHERE w.Poll = ? AND u.Name = ?`
+			var got uint32
+			mustt(t, db.DB.QueryRow(qCheck, param.PollId, name).Scan(&got))
+			if got != weight {
+				t.Errorf("Got weight %d. Expect %d.", got, weight)
+			}
+		})
+	}
+}
+
+func TestWeightHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:        "Not admin",
+			Electorate:  db.ElectorateAll,
+			Participate: []pollTestParticipate{{User: 2}},
+			UserType:    pollTestUserTypeLogged,
+			Request: weightTestRequest(t, WeightEntry{
+				Name:   dbt.UserNameWith("TestWeightHandler/Not_admin2"),
+				Weight: 2,
+			}),
+			Checker: srvt.CheckError{Code: http.StatusForbidden, Body: server.UnauthorizedHttpErrorMsg},
+		},
+		&pollTest{
+			Name:       "No participant",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeAdmin,
+			Request: weightTestRequest(t, WeightEntry{
+				Name:   dbt.UserNameWith("TestWeightHandler/No_participant"),
+				Weight: 2,
+			}),
+			Checker: srvt.CheckError{Code: http.StatusNotFound, Body: "No participant"},
+		},
+		&pollTest{
+			Name:        "Name",
+			Electorate:  db.ElectorateAll,
+			Participate: []pollTestParticipate{{User: 2}},
+			UserType:    pollTestUserTypeAdmin,
+			Request: weightTestRequest(t, WeightEntry{
+				Name:   dbt.UserNameWith("TestWeightHandler/Name2"),
+				Weight: 2,
+			}),
+			Checker: weightTestChecker(dbt.UserNameWith("TestWeightHandler/Name2"), 2),
+		},
+		&pollTest{
+			Name:       "Email",
+			Electorate: db.ElectorateInvited,
+			UserType:   pollTestUserTypeAdmin,
+			Invited:    true,
+			Request: weightTestRequest(t, WeightEntry{
+				Email:  "TestWeightHandler/Email@example.com",
+				Weight: 3,
+			}),
+			Checker: weightTestChecker(dbt.UserNameWith("TestWeightHandler/Email"), 3),
+		},
+	}
+	srvt.RunFunc(t, tests, WeightHandler)
+}
+
+func TestWeightListHandler(t *testing.T) {
+	precheck(t)
+	t.Parallel()
+
+	tests := []srvt.Test{
+		&pollTest{
+			Name:       "Not admin",
+			Electorate: db.ElectorateAll,
+			UserType:   pollTestUserTypeLogged,
+			Checker:    srvt.CheckError{Code: http.StatusNotFound, Body: "No poll"},
+		},
+		&pollTest{
+			Name:        "Success",
+			Electorate:  db.ElectorateInvited,
+			Participate: []pollTestParticipate{{User: 2}},
+			UserType:    pollTestUserTypeAdmin,
+			Invited:     true,
+			Checker: srvt.CheckJSON{Body: WeightList{Weights: []WeightEntry{
+				{
+					Name:   dbt.UserNameWith("TestWeightListHandler/Success"),
+					Email:  "TestWeightListHandler/Success@example.com",
+					Weight: 1,
+				},
+				{Name: dbt.UserNameWith("TestWeightListHandler/Success2"), Weight: 1},
+			}}},
+		},
+	}
+	srvt.RunFunc(t, tests, WeightListHandler)
+}
@@ -56,25 +56,74 @@ func main() {
 	StartService(NextRoundService)
 	StartService(ClosePollService)
 	StartService(EmailService)
+	StartService(EmailNotifService)
+	StartService(ReminderService)
+	StartService(WebhookService)
+	StartService(PollNotifInboxService)
 
 	// Handlers
 	StartHandler("/a/login", LoginHandler)
 	StartHandler("/a/signup", SignupHandler)
 	StartHandler("/a/refresh", RefreshHandler)
 	StartHandler("/a/list", ListHandler, server.Compress)
+	StartHandler("/a/list/query", ListQueryHandler, server.Compress)
 	StartHandler("/a/poll/", PollHandler)
 	StartHandler("/a/ballot/uninominal/", UninominalBallotHandler, server.Compress)
 	StartHandler("/a/vote/uninominal/", UninominalVoteHandler)
+	StartHandler("/a/ballot/approval/", ApprovalBallotHandler, server.Compress)
+	StartHandler("/a/vote/approval/", ApprovalVoteHandler)
+	StartHandler("/a/ballot/ranked/", RankedBallotHandler, server.Compress)
+	StartHandler("/a/vote/ranked/", RankedVoteHandler)
+	StartHandler("/a/delegate/", DelegateHandler)
+	StartHandler("/a/revoke/", RevokeHandler)
 	StartHandler("/a/info/count/", CountInfoHandler, server.Compress)
+	StartHandler("/a/info/result/", ResultInfoHandler, server.Compress)
+	StartHandler("/a/info/winner/", WinnerInfoHandler, server.Compress)
+	StartHandler("/a/info/ranking/", RankingInfoHandler, server.Compress)
+	StartHandler("/a/info/matrix/", MatrixInfoHandler, server.Compress)
+	StartHandler("/a/info/trends/", TrendsInfoHandler, server.Compress)
+	StartHandler("/a/info/history/", HistoryInfoHandler, server.Compress)
+	StartHandler("/a/export/", ExportHandler, server.Compress)
 	StartHandler("/a/create", CreateHandler)
+	StartHandler("/a/clone/", CloneHandler)
+	StartHandler("/a/template/list", TemplateListHandler)
+	StartHandler("/a/template/save", TemplateSaveHandler)
+	StartHandler("/a/template/delete", TemplateDeleteHandler)
+	StartHandler("/a/webhook/list", WebhookListHandler)
+	StartHandler("/a/webhook/add", WebhookAddHandler)
+	StartHandler("/a/webhook/delete", WebhookDeleteHandler)
+	StartHandler("/a/webhook/deliveries/", WebhookDeliveriesHandler)
+	StartHandler("/a/emailprefs", EmailPrefsHandler)
+	StartHandler("/a/emailprefs/save", EmailPrefsSaveHandler)
+	StartHandler("/a/icaltoken", CalendarTokenHandler)
+	StartHandler("/a/icaltoken/reset", CalendarTokenResetHandler)
+	StartHandler("/a/ical/", CalendarHandler, server.Compress)
 	StartHandler("/a/delete/", DeleteHandler)
 	StartHandler("/a/pollnotif", PollNotifHandler, server.Compress)
+	StartHandler("/a/pollnotif/list", PollNotifListHandler, server.Compress)
+	StartHandler("/a/pollnotif/read", PollNotifReadHandler)
+	StartHandler("/a/pollnotif/delete", PollNotifDeleteHandler)
+	StartHandler("/a/pollstream", PollNotifStreamHandler)
+	StartHandler("/a/live/", LiveHandler)
 	StartHandler("/a/config", ConfigHandler)
 	StartHandler("/a/confirm/", ConfirmHandler)
 	StartHandler("/a/reverify", ReverifyHandler)
 	StartHandler("/a/forgot", ForgotHandler)
 	StartHandler("/a/passwd/", PasswdHandler)
 	StartHandler("/a/launch/", LaunchHandler)
+	StartHandler("/a/edit/", EditHandler)
+	StartHandler("/a/pause/", PauseHandler)
+	StartHandler("/a/resume/", ResumeHandler)
+	StartHandler("/a/extend/", ExtendHandler)
+	StartHandler("/a/advance/", AdvanceHandler)
+	StartHandler("/a/close/", CloseHandler)
+	StartHandler("/a/invite/", InviteHandler)
+	StartHandler("/a/weight/", WeightHandler)
+	StartHandler("/a/weights/", WeightListHandler)
+	StartHandler("/a/comments/", CommentListHandler, server.Compress)
+	StartHandler("/a/comment/post/", CommentPostHandler)
+	StartHandler("/a/comment/edit/", CommentEditHandler)
+	StartHandler("/a/comment/delete/", CommentDeleteHandler)
 	StartHandler("/p/", ShortURLHandler)
 
 	var logger slog.Leveled
@@ -17,9 +17,11 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/outcome"
 	"github.com/JBoudou/Itero/mid/service"
 	"github.com/JBoudou/Itero/pkg/events"
 	"github.com/JBoudou/Itero/pkg/slog"
@@ -49,7 +51,28 @@ func (self *closePollService) ProcessOne(id uint32) error {
 	if err := service.SQLProcessOne(qUpdate, id); err != nil {
 		return err
 	}
-	return self.evtManager.Send(ClosePollEvent{id})
+	return self.evtManager.Send(ClosePollEvent{Poll: id, Winners: self.winners(id)})
+}
+
+// winners computes the winners of the last round of a terminated poll.
+// Errors are logged and nil is returned.
+func (self *closePollService) winners(id uint32) []uint8 {
+	const qRound = `SELECT CurrentRound FROM Polls WHERE Id = ?`
+
+	var round uint8
+	if err := db.DB.QueryRow(qRound, id).Scan(&round); err != nil {
+		self.Logger().Errorf("Error retrieving round of poll %d: %v", id, err)
+		return nil
+	}
+	if round == 0 {
+		return nil
+	}
+	result, err := outcome.Compute(context.Background(), id, round-1)
+	if err != nil {
+		self.Logger().Errorf("Error computing outcome of poll %d: %v", id, err)
+		return nil
+	}
+	return result.Winners
 }
 
 func (self *closePollService) CheckAll() service.Iterator {
@@ -91,7 +114,7 @@ func (self *closePollService) Logger() slog.Leveled {
 
 func (self *closePollService) FilterEvent(evt events.Event) bool {
 	switch evt.(type) {
-	case NextRoundEvent:
+	case NextRoundEvent, ResumePollEvent:
 		return true
 	}
 	return false
@@ -101,5 +124,7 @@ func (self *closePollService) ReceiveEvent(evt events.Event, ctrl service.Runner
 	switch e := evt.(type) {
 	case NextRoundEvent:
 		ctrl.Schedule(e.Poll)
+	case ResumePollEvent:
+		ctrl.Schedule(e.Poll)
 	}
 }
@@ -215,9 +215,14 @@ func TestClosePollService_Events(t *testing.T) {
 			event:    NextRoundEvent{Poll: 1, Round: 2},
 			schedule: []uint32{1},
 		},
+		{
+			name:     "ResumePollEvent",
+			event:    ResumePollEvent{Poll: 3},
+			schedule: []uint32{3},
+		},
 		{
 			name:  "ClosePollEvent",
-			event: ClosePollEvent{42},
+			event: ClosePollEvent{Poll: 42},
 		},
 	}
 	checkEventSchedule(t, tests, ClosePollService)
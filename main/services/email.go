@@ -24,6 +24,7 @@ import (
 
 	"github.com/JBoudou/Itero/mid/db"
 	"github.com/JBoudou/Itero/mid/root"
+	"github.com/JBoudou/Itero/mid/salted"
 	"github.com/JBoudou/Itero/mid/server"
 	"github.com/JBoudou/Itero/mid/service"
 	"github.com/JBoudou/Itero/pkg/config"
@@ -50,6 +51,12 @@ func EmailService(sender emailsender.Sender, log slog.StackedLeveled) emailServi
 
 var emailConfig struct {
 	Sender string
+
+	// DigestDelay is the time notifications wait to be grouped in a single email.
+	DigestDelay string
+
+	// ReminderLead is the time before the end of a round at which reminders are sent.
+	ReminderLead string
 }
 
 func init() {
@@ -111,7 +118,7 @@ func (self emailService) Logger() slog.Leveled {
 
 func (self emailService) FilterEvent(evt events.Event) bool {
 	switch evt.(type) {
-	case CreateUserEvent, ReverifyEvent, ForgotEvent:
+	case CreateUserEvent, ReverifyEvent, ForgotEvent, InviteEvent:
 		return true
 	}
 	return false
@@ -125,6 +132,8 @@ func (self emailService) ReceiveEvent(evt events.Event, ctrl service.RunnerContr
 		self.confirmationEmail(converted.User, ctrl, "reverify.txt", db.ConfirmationTypeVerify, 48*time.Hour)
 	case ForgotEvent:
 		self.confirmationEmail(converted.User, ctrl, "forgot.txt", db.ConfirmationTypePasswd, 3*time.Hour)
+	case InviteEvent:
+		self.invitationEmail(converted.Poll, converted.User, ctrl)
 	}
 }
 
@@ -140,14 +149,6 @@ func (self emailService) confirmationEmail(userId uint32, ctrl service.RunnerCon
 	data.Sender = emailConfig.Sender
 	data.BaseURL = server.BaseURL()
 
-	// Find the template
-	var tmpl *template.Template
-	tmpl, err := template.ParseFiles(filepath.Join(root.BaseDir, TmplBaseDir, "en", tmplFile))
-	if err != nil {
-		self.log.Errorf("Error retrieving template: %v", err)
-		return
-	}
-
 	// Retrieve user data
 	const qSelect = `
 	  SELECT Name, Email FROM Users WHERE Id = ? AND Name IS NOT NULL AND Email IS NOT NULL`
@@ -181,9 +182,76 @@ func (self emailService) confirmationEmail(userId uint32, ctrl service.RunnerCon
 		return
 	}
 
-	// Send the email
+	self.send(tmplFile, data.Address, data)
+}
+
+// inviteDuration is the validity of the links sent to invitees without account.
+const inviteDuration = 90 * 24 * time.Hour
+
+func (self emailService) invitationEmail(pollId, userId uint32, ctrl service.RunnerControler) {
+	var data struct {
+		Sender  string
+		Name    string
+		Address string
+		BaseURL string
+		Title   string
+		Admin   string
+		Link    string
+	}
+	data.Sender = emailConfig.Sender
+	data.BaseURL = server.BaseURL()
+
+	// Retrieve invitation data
+	const qSelect = `
+	  SELECT i.Email, IFNULL(u.Name, ''), p.Title, a.Name, p.Salt
+	    FROM Invitations AS i
+	    JOIN Users AS u ON i.User = u.Id
+	    JOIN Polls AS p ON i.Poll = p.Id
+	    JOIN Users AS a ON p.Admin = a.Id
+	   WHERE i.Poll = ? AND i.User = ?`
+	poll := salted.Segment{Id: pollId}
+	err := db.DB.QueryRow(qSelect, pollId, userId).
+		Scan(&data.Address, &data.Name, &data.Title, &data.Admin, &poll.Salt)
+	if err != nil {
+		self.log.Errorf("Error retrieving invitation of user %d to poll %d: %v", userId, pollId, err)
+		return
+	}
+
+	// Registered users are sent to the poll, other invitees receive a personal link.
+	var segment salted.Segment
+	var prefix string
+	if data.Name != "" {
+		segment = poll
+		prefix = "r/poll/"
+	} else {
+		segment, err = db.CreateConfirmation(context.Background(), userId, db.ConfirmationTypeInvite,
+			inviteDuration)
+		if err != nil {
+			self.log.Errorf("Error creating confirmation %v.", err)
+			return
+		}
+		ctrl.Schedule(segment.Id)
+		prefix = "r/confirm/"
+	}
+	encoded, err := segment.Encode()
+	if err != nil {
+		self.log.Errorf("Error encoding segment %v.", err)
+		return
+	}
+	data.Link = prefix + encoded
+
+	self.send("invite.txt", data.Address, data)
+}
+
+func (self emailService) send(tmplFile string, address string, data interface{}) {
+	tmpl, err := template.ParseFiles(filepath.Join(root.BaseDir, TmplBaseDir, "en", tmplFile))
+	if err != nil {
+		self.log.Errorf("Error retrieving template: %v", err)
+		return
+	}
+
 	err = self.sender.Send(emailsender.Email{
-		To:   []string{data.Address},
+		To:   []string{address},
 		Tmpl: tmpl,
 		Data: data,
 	})
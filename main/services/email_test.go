@@ -130,6 +130,87 @@ func TestEmailService_Events(t *testing.T) {
 	}
 }
 
+func TestEmailService_Invite(t *testing.T) {
+	t.Parallel()
+
+	const (
+		qPseudo = `INSERT INTO Users (Email) VALUE (NULL)`
+		qInvite = `INSERT INTO Invitations (Poll, Email, User) VALUE (?, ?, ?)`
+	)
+
+	var rcv events.Receiver
+	emailSent := false
+	emailChan := make(chan bool)
+
+	dbenv := dbtest.Env{}
+	defer dbenv.Close()
+	admin := dbenv.CreateUserWith(t.Name())
+	poll := dbenv.CreatePoll(t.Name(), admin, db.ElectorateInvited)
+	dbenv.Must(t)
+	result, err := db.DB.Exec(qPseudo)
+	mustt(t, err)
+	uid, err := db.IdFromResult(result)
+	mustt(t, err)
+	dbenv.Defer(func() { db.DB.Exec(`DELETE FROM Users WHERE Id = ?`, uid) })
+	_, err = db.DB.Exec(qInvite, poll, "invitee@example.test", uid)
+	mustt(t, err)
+
+	locator := root.IoC.Sub()
+
+	err = locator.Bind(func() events.Manager {
+		return &evtest.ManagerMock{
+			T: t,
+			AddReceiver_: func(r events.Receiver) error {
+				rcv = r
+				rcv.Receive(InviteEvent{Poll: poll, User: uid})
+				return nil
+			},
+		}
+	})
+	mustt(t, err)
+
+	err = locator.Bind(func() emailsender.Sender {
+		return estest.SenderMock{
+			T: t,
+			Send_: func(emailsender.Email) error {
+				emailChan <- true
+				return nil
+			},
+		}
+	})
+	mustt(t, err)
+
+	var stop service.StopFunction
+	mustt(t, locator.Inject(EmailService, service.Run, &stop))
+	defer stop()
+
+testLoop:
+	for i := 0; i < 20; i++ {
+		select {
+		case emailSent = <-emailChan:
+			break testLoop
+
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if rcv == nil {
+		t.Errorf("Receiver not registered")
+	}
+	if !emailSent {
+		t.Errorf("No email sent")
+	}
+
+	const qSelect = `SELECT 1 FROM Confirmations WHERE User = ? AND Type = ?`
+	rows, err := db.DB.Query(qSelect, uid, db.ConfirmationTypeInvite)
+	mustt(t, err)
+	defer rows.Close()
+	if !rows.Next() {
+		t.Errorf("No confirmation created.")
+	}
+}
+
 type emailTestInstance struct {
 	name     string
 	type_    db.ConfirmationType
@@ -0,0 +1,282 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/emailsender"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// Values for EmailNotifEntry.Event.
+const (
+	EmailNotifStart     = "Start"
+	EmailNotifNextRound = "Next"
+	EmailNotifClose     = "Close"
+	EmailNotifDelete    = "Delete"
+)
+
+// EmailNotifEntry is a notification about a poll, as given to the email templates.
+type EmailNotifEntry struct {
+	Event string
+	Title string
+	Round uint8  // Starting from one.
+	Link  string // Empty for deleted polls.
+}
+
+// DefaultDigestDelay is the time notifications wait to be grouped, when not configured.
+const DefaultDigestDelay = 10 * time.Minute
+
+// EmailNotifService is the factory for the service that notifies users by email of the events
+// about the polls they participate in, according to their preferences. All the notifications
+// received by a user during the digest delay are grouped in a single email.
+func EmailNotifService(sender emailsender.Sender, log slog.StackedLeveled) *emailNotifService {
+	delay := DefaultDigestDelay
+	if emailConfig.DigestDelay != "" {
+		parsed, err := time.ParseDuration(emailConfig.DigestDelay)
+		if err == nil {
+			delay = parsed
+		} else {
+			log.Errorf("Wrong DigestDelay: %v", err)
+		}
+	}
+	return &emailNotifService{
+		mailer: emailService{sender: sender, log: log.With("EmailNotif")},
+		delay:  delay,
+	}
+}
+
+//
+// Implementation
+//
+
+type emailNotifService struct {
+	mailer emailService
+	delay  time.Duration
+}
+
+func (self *emailNotifService) ProcessOne(id uint32) error {
+	const (
+		qDue = `
+		  SELECT u.Name, u.Email, MAX(n.Id)
+		    FROM EmailNotifications AS n JOIN Users AS u ON n.User = u.Id
+		   WHERE n.User = ? AND u.Email IS NOT NULL
+		   GROUP BY u.Id
+		  HAVING MIN(n.Due) <= CURRENT_TIMESTAMP`
+		qList = `
+		  SELECT Event, Title, Round, Segment FROM EmailNotifications
+		   WHERE User = ? AND Id <= ?
+		   ORDER BY Id ASC`
+		qDelete = `DELETE FROM EmailNotifications WHERE User = ? AND Id <= ?`
+	)
+
+	var data struct {
+		Sender  string
+		Name    string
+		Address string
+		BaseURL string
+		Entries []EmailNotifEntry
+	}
+	data.Sender = emailConfig.Sender
+	data.BaseURL = server.BaseURL()
+
+	var last uint32
+	err := db.DB.QueryRow(qDue, id).Scan(&data.Name, &data.Address, &last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.NothingToDoYet
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(qList, id, last)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry EmailNotifEntry
+		var segment string
+		if err := rows.Scan(&entry.Event, &entry.Title, &entry.Round, &segment); err != nil {
+			return err
+		}
+		if segment != "" {
+			entry.Link = "r/poll/" + segment
+		}
+		data.Entries = append(data.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := db.DB.Exec(qDelete, id, last); err != nil {
+		return err
+	}
+
+	tmplFile := "notification.txt"
+	if len(data.Entries) > 1 {
+		tmplFile = "digest.txt"
+	}
+	self.mailer.send(tmplFile, data.Address, data)
+	return nil
+}
+
+func (self *emailNotifService) CheckAll() service.Iterator {
+	const qList = `
+	  SELECT User, MIN(Due) AS First FROM EmailNotifications
+	   GROUP BY User
+	   ORDER BY First ASC`
+	return service.SQLCheckAll(qList)
+}
+
+func (self *emailNotifService) CheckOne(id uint32) (ret time.Time) {
+	const qCheck = `SELECT MIN(Due) FROM EmailNotifications WHERE User = ?`
+	var due sql.NullTime
+	if err := db.DB.QueryRow(qCheck, id).Scan(&due); err != nil {
+		self.Logger().Errorf("Error in CheckOne: %v", err)
+	}
+	if due.Valid {
+		ret = due.Time
+	}
+	return
+}
+
+func (self *emailNotifService) Interval() time.Duration {
+	return 12 * time.Hour
+}
+
+func (self *emailNotifService) Logger() slog.Leveled {
+	return self.mailer.log
+}
+
+func (self *emailNotifService) FilterEvent(evt events.Event) bool {
+	switch evt.(type) {
+	case StartPollEvent, NextRoundEvent, ClosePollEvent, DeletePollEvent:
+		return true
+	}
+	return false
+}
+
+func (self *emailNotifService) ReceiveEvent(evt events.Event, ctrl service.RunnerControler) {
+	const (
+		qPoll       = `SELECT Title, Salt, CurrentRound FROM Polls WHERE Id = ?`
+		qRecipients = `
+		  SELECT u.Id
+		    FROM Users AS u JOIN EmailPreferences AS e ON e.User = u.Id
+		   WHERE u.Email IS NOT NULL AND u.Verified
+		     AND CASE ? WHEN 'Start' THEN e.OnStart
+		                WHEN 'Next'  THEN e.OnNextRound
+		                WHEN 'Close' THEN e.OnClose
+		                ELSE FALSE END
+		     AND (   EXISTS (SELECT 1 FROM Participants AS p WHERE p.Poll = ? AND p.User = u.Id)
+		          OR EXISTS (SELECT 1 FROM Invitations  AS i WHERE i.Poll = ? AND i.User = u.Id)
+		          OR EXISTS (SELECT 1 FROM Polls        AS a WHERE a.Id   = ? AND a.Admin = u.Id))`
+		qDeleteRecipient = `
+		  SELECT 1
+		    FROM Users AS u JOIN EmailPreferences AS e ON e.User = u.Id
+		   WHERE u.Id = ? AND u.Email IS NOT NULL AND u.Verified AND e.OnDelete`
+	)
+
+	var entry EmailNotifEntry
+	var poll uint32
+	var encoded string
+	var recipients []uint32
+	var err error
+
+	switch e := evt.(type) {
+	case StartPollEvent:
+		poll, entry.Event = e.Poll, EmailNotifStart
+	case NextRoundEvent:
+		poll, entry.Event = e.Poll, EmailNotifNextRound
+	case ClosePollEvent:
+		poll, entry.Event = e.Poll, EmailNotifClose
+	case DeletePollEvent:
+		poll, entry.Event, entry.Title = e.Poll, EmailNotifDelete, e.Title
+		for user := range e.Participants {
+			var found bool
+			err = db.DB.QueryRow(qDeleteRecipient, user).Scan(&found)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			recipients = append(recipients, user)
+		}
+	default:
+		return
+	}
+
+	if entry.Event != EmailNotifDelete {
+		segment := salted.Segment{Id: poll}
+		err = db.DB.QueryRow(qPoll, poll).Scan(&entry.Title, &segment.Salt, &entry.Round)
+		if err == nil {
+			encoded, err = segment.Encode()
+		}
+		if e, ok := evt.(NextRoundEvent); ok {
+			entry.Round = e.Round
+		}
+		entry.Round += 1
+		if err == nil {
+			recipients, err = self.recipients(qRecipients, entry.Event, poll)
+		}
+	}
+	if err != nil {
+		self.Logger().Errorf("Error preparing notifications for poll %d: %v", poll, err)
+		return
+	}
+
+	const qInsert = `
+	  INSERT INTO EmailNotifications (User, Event, Poll, Segment, Title, Round, Due)
+	  VALUE (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP + INTERVAL ? SECOND)`
+	for _, user := range recipients {
+		_, err := db.DB.Exec(qInsert, user, entry.Event, poll, encoded, entry.Title, entry.Round,
+			int64(self.delay/time.Second))
+		if err != nil {
+			self.Logger().Errorf("Error queuing notification for user %d: %v", user, err)
+			continue
+		}
+		ctrl.Schedule(user)
+	}
+}
+
+func (self *emailNotifService) recipients(query, event string, poll uint32) (
+	ret []uint32, err error) {
+	rows, err := db.DB.Query(query, event, poll, poll, poll)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint32
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ret = append(ret, id)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,185 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/emailsender"
+	estest "github.com/JBoudou/Itero/pkg/emailsender/emailsendertest"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func TestEmailNotifTemplates(t *testing.T) {
+	entries := []EmailNotifEntry{
+		{Event: EmailNotifStart, Title: "Started", Round: 1, Link: "r/poll/start"},
+		{Event: EmailNotifNextRound, Title: "Next", Round: 2, Link: "r/poll/next"},
+		{Event: EmailNotifClose, Title: "Closed", Round: 3, Link: "r/poll/close"},
+		{Event: EmailNotifDelete, Title: "Deleted"},
+	}
+	data := struct {
+		Sender  string
+		Name    string
+		Address string
+		BaseURL string
+		Entries []EmailNotifEntry
+	}{Sender: "itero@example.com", Name: "Name", Address: "name@example.com",
+		BaseURL: "https://example.com/"}
+
+	// Templates are read relatively to the package directory, such that no configuration is needed.
+	render := func(t *testing.T, file string) string {
+		tmpl, err := template.ParseFiles(filepath.Join("..", "..", TmplBaseDir, "en", file))
+		mustt(t, err)
+		var builder strings.Builder
+		mustt(t, tmpl.Execute(&builder, data))
+		return builder.String()
+	}
+
+	for _, entry := range entries {
+		entry := entry
+		t.Run("Single "+entry.Event, func(t *testing.T) {
+			data.Entries = []EmailNotifEntry{entry}
+			got := render(t, "notification.txt")
+			if !strings.Contains(got, `"`+entry.Title+`"`) {
+				t.Errorf("Title missing in %s", got)
+			}
+			if entry.Link != "" && !strings.Contains(got, data.BaseURL+entry.Link) {
+				t.Errorf("Link missing in %s", got)
+			}
+		})
+	}
+
+	t.Run("Digest", func(t *testing.T) {
+		data.Entries = entries
+		got := render(t, "digest.txt")
+		for _, entry := range entries {
+			if !strings.Contains(got, `"`+entry.Title+`"`) {
+				t.Errorf("Title %s missing in %s", entry.Title, got)
+			}
+		}
+	})
+}
+
+func newTestEmailNotifService(t *testing.T, delay time.Duration,
+	send func(emailsender.Email) error) *emailNotifService {
+	return &emailNotifService{
+		mailer: emailService{
+			sender: estest.SenderMock{T: t, Send_: send},
+			log:    &slog.WithStack{Target: t},
+		},
+		delay: delay,
+	}
+}
+
+func TestEmailNotifService(t *testing.T) {
+	t.Parallel()
+
+	const (
+		qVerify = `UPDATE Users SET Verified = TRUE WHERE Id = ?`
+		qPrefs  = `
+		  INSERT INTO EmailPreferences (User, OnStart, OnNextRound, OnClose, OnDelete)
+		  VALUE (?, TRUE, TRUE, FALSE, FALSE)`
+		qCount = `SELECT COUNT(*) FROM EmailNotifications WHERE User = ?`
+	)
+
+	env := new(dbt.Env)
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name() + "Admin")
+	notified := env.CreateUserWith(t.Name() + "Notified")
+	silent := env.CreateUserWith(t.Name() + "Silent")
+	poll := env.CreatePoll("Notified", admin, db.ElectorateAll)
+	env.Vote(poll, 0, notified, 0)
+	env.Vote(poll, 0, silent, 0)
+	env.QuietExec(qVerify, notified)
+	env.QuietExec(qVerify, silent)
+	env.QuietExec(qPrefs, notified)
+	env.Must(t)
+
+	var sent []emailsender.Email
+	svc := newTestEmailNotifService(t, time.Hour, func(email emailsender.Email) error {
+		sent = append(sent, email)
+		return nil
+	})
+
+	// Receive
+	for _, evt := range []events.Event{
+		StartPollEvent{Poll: poll},
+		NextRoundEvent{Poll: poll, Round: 1},
+		ClosePollEvent{Poll: poll},
+	} {
+		if !svc.FilterEvent(evt) {
+			t.Fatalf("Event %v filtered out.", evt)
+		}
+		controler := &mockRunnerController{}
+		svc.ReceiveEvent(evt, controler)
+		expect := 1
+		if _, ok := evt.(ClosePollEvent); ok {
+			expect = 0
+		}
+		if len(controler.schedule) != expect {
+			t.Errorf("Wrong schedule for %v. Got %v. Expect %d entries.", evt, controler.schedule,
+				expect)
+		}
+		for _, id := range controler.schedule {
+			if id != notified {
+				t.Errorf("Wrong user scheduled. Got %d. Expect %d.", id, notified)
+			}
+		}
+	}
+
+	// Not due yet
+	if err := svc.ProcessOne(notified); !errors.Is(err, service.NothingToDoYet) {
+		t.Errorf("Wrong error. Got %v. Expect NothingToDoYet.", err)
+	}
+	if due := svc.CheckOne(notified); due.Before(time.Now().Add(50 * time.Minute)) {
+		t.Errorf("Wrong due date %v.", due)
+	}
+
+	// Digest
+	_, err := db.DB.Exec(`UPDATE EmailNotifications SET Due = CURRENT_TIMESTAMP WHERE User = ?`,
+		notified)
+	mustt(t, err)
+	mustt(t, svc.ProcessOne(notified))
+	if len(sent) != 1 {
+		t.Fatalf("Wrong number of emails. Got %d. Expect 1.", len(sent))
+	}
+	if name := sent[0].Tmpl.Name(); name != "digest.txt" {
+		t.Errorf("Wrong template. Got %s. Expect digest.txt.", name)
+	}
+	if err := sent[0].Tmpl.Execute(ioutil.Discard, sent[0].Data); err != nil {
+		t.Errorf("Error executing template: %v", err)
+	}
+
+	var count int
+	mustt(t, db.DB.QueryRow(qCount, notified).Scan(&count))
+	if count != 0 {
+		t.Errorf("Notifications not removed. %d remain.", count)
+	}
+	if due := svc.CheckOne(notified); !due.IsZero() {
+		t.Errorf("Unexpected due date %v.", due)
+	}
+}
@@ -46,12 +46,19 @@ type CreatePollEvent struct {
 	Poll uint32
 }
 
+// UpdatePollEvent is sent when the parameters of a poll that has not started yet have been
+// modified.
+type UpdatePollEvent struct {
+	Poll uint32
+}
+
 // StartPollEvent is sent when a poll has started.
 type StartPollEvent struct {
 	Poll uint32
 }
 
-// VoteEvent is sent when a new ballot has been accepted for a poll.
+// VoteEvent is sent when a new ballot has been accepted for a poll, or when a participant
+// delegates its ballot or revokes its delegation.
 type VoteEvent struct {
 	Poll uint32
 }
@@ -62,14 +69,59 @@ type NextRoundEvent struct {
 	Round uint8
 }
 
+// PausePollEvent is sent when the administrator of a poll has paused it.
+type PausePollEvent struct {
+	Poll uint32
+}
+
+// ResumePollEvent is sent when the administrator of a paused poll has resumed it.
+type ResumePollEvent struct {
+	Poll uint32
+}
+
+// ExtendPollEvent is sent when the administrator of a poll has postponed its deadline or increased
+// its maximal number of rounds.
+type ExtendPollEvent struct {
+	Poll uint32
+}
+
 // ClosePollEvent is sent when a poll has been marked as terminated.
+// Winners is nil if the outcome of the poll could not be computed.
 type ClosePollEvent struct {
-	Poll uint32
+	Poll    uint32
+	Winners []uint8
 }
 
 // DeletePollEvent is sent when a poll has been deleted.
 type DeletePollEvent struct {
 	Poll         uint32
+	Admin        uint32
 	Title        string
 	Participants map[uint32]bool
 }
+
+// CommentAction is the kind of modification of a comment.
+type CommentAction uint8
+
+const (
+	CommentPosted CommentAction = iota
+	CommentEdited
+	CommentDeleted
+)
+
+// CommentEvent is sent when a comment on a poll has been posted, edited or deleted. User is the
+// author of the action, which may differ from the author of the comment for deletions by the
+// administrator of the poll.
+type CommentEvent struct {
+	Poll    uint32
+	Comment uint32
+	User    uint32
+	Action  CommentAction
+}
+
+// InviteEvent is sent when a user has been invited to participate in a poll. The user may be a
+// pseudo-user bound to the invitation.
+type InviteEvent struct {
+	Poll uint32
+	User uint32
+}
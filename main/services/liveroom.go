@@ -0,0 +1,310 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/outcome"
+	"github.com/JBoudou/Itero/mid/root"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// LiveRoomUpdate is the state of a poll, sent to the members of its live room.
+// RoundDeadline is zero if the current round has no deadline. Participants is the number of
+// participants of the current round, or zero if the poll is not freely asynchronous. Result is nil
+// unless a round just ended. Comment is nil unless a comment just changed.
+type LiveRoomUpdate struct {
+	State         db.State
+	CurrentRound  uint8
+	RoundDeadline time.Time
+	Participants  uint32
+	Result        *LiveRoomResult
+	Comment       *LiveRoomComment
+}
+
+// LiveRoomResult is the outcome of a round that just ended.
+type LiveRoomResult struct {
+	Round   uint8
+	Winners []uint8
+}
+
+// LiveRoomComment is a comment that has just been posted, edited or deleted.
+type LiveRoomComment struct {
+	Id     uint32
+	Action CommentAction
+}
+
+// LiveRooms sends updates to the members of the live room of each poll, as soon as the
+// corresponding events are received. The database is queried only for polls whose room has
+// members.
+//
+// A factory is binded to this type in root.IoC. The factory calls RunLiveRooms.
+type LiveRooms interface {
+	// Join registers a new member in the live room of a poll. The current state of the poll is sent
+	// first. The returned channel is closed when leave is called, when the member does not read
+	// updates fast enough, when the poll is deleted, or when the service stops. Calling leave more
+	// than once has no effect.
+	Join(poll uint32) (updates <-chan LiveRoomUpdate, leave func())
+}
+
+// liveRoomBuffer is the number of updates a member may be late of.
+const liveRoomBuffer = 16
+
+func init() {
+	root.IoC.Bind(func(evtManager events.Manager, logger slog.Leveled) (LiveRooms, error) {
+		return RunLiveRooms(evtManager, logger)
+	})
+}
+
+// RunLiveRooms launches the service that sends updates to the members of live rooms.
+func RunLiveRooms(evtManager events.Manager, logger slog.Leveled) (LiveRooms, error) {
+	runner := newLiveRoomsRunner(logger)
+	if err := runner.start(evtManager); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+type liveRoomJoin struct {
+	poll  uint32
+	reply chan chan LiveRoomUpdate
+}
+
+type liveRoomLeave struct {
+	poll    uint32
+	updates chan LiveRoomUpdate
+}
+
+type liveRoomsRunner struct {
+	state   func(poll uint32) (LiveRoomUpdate, error)
+	winners func(poll uint32, round uint8) ([]uint8, error)
+	logger  slog.Leveled
+
+	join  chan liveRoomJoin
+	leave chan liveRoomLeave
+	done  chan struct{}
+}
+
+func newLiveRoomsRunner(logger slog.Leveled) *liveRoomsRunner {
+	return &liveRoomsRunner{
+		state:   liveRoomState,
+		winners: liveRoomWinners,
+		logger:  logger,
+		join:    make(chan liveRoomJoin),
+		leave:   make(chan liveRoomLeave),
+		done:    make(chan struct{}),
+	}
+}
+
+func (self *liveRoomsRunner) start(evtManager events.Manager) error {
+	eventChan := make(chan events.Event, 64)
+	err := evtManager.AddReceiver(events.AsyncForwarder{
+		Filter: self.filter,
+		Chan:   eventChan,
+	})
+	if err != nil {
+		return err
+	}
+	go self.run(eventChan)
+	return nil
+}
+
+func (self *liveRoomsRunner) Join(poll uint32) (<-chan LiveRoomUpdate, func()) {
+	join := liveRoomJoin{poll: poll, reply: make(chan chan LiveRoomUpdate, 1)}
+	select {
+	case self.join <- join:
+	case <-self.done:
+		closed := make(chan LiveRoomUpdate)
+		close(closed)
+		return closed, func() {}
+	}
+	updates := <-join.reply
+
+	var once sync.Once
+	leave := func() {
+		once.Do(func() {
+			select {
+			case self.leave <- liveRoomLeave{poll: poll, updates: updates}:
+			case <-self.done:
+			}
+		})
+	}
+	return updates, leave
+}
+
+func (self *liveRoomsRunner) filter(evt events.Event) bool {
+	switch evt.(type) {
+	case StartPollEvent, VoteEvent, NextRoundEvent, PausePollEvent, ResumePollEvent,
+		ExtendPollEvent, ClosePollEvent, DeletePollEvent, CommentEvent:
+		return true
+	}
+	return false
+}
+
+func (self *liveRoomsRunner) run(eventChan <-chan events.Event) {
+	rooms := make(map[uint32]map[chan LiveRoomUpdate]bool)
+	closeRoom := func(poll uint32) {
+		for updates := range rooms[poll] {
+			close(updates)
+		}
+		delete(rooms, poll)
+	}
+	defer func() {
+		close(self.done)
+		for poll := range rooms {
+			closeRoom(poll)
+		}
+	}()
+
+	for {
+		select {
+		case join := <-self.join:
+			updates := make(chan LiveRoomUpdate, liveRoomBuffer)
+			if state, err := self.state(join.poll); err == nil {
+				updates <- state
+			} else {
+				self.logger.Errorf("Error retrieving state of poll %d: %v.", join.poll, err)
+			}
+			room, ok := rooms[join.poll]
+			if !ok {
+				room = make(map[chan LiveRoomUpdate]bool)
+				rooms[join.poll] = room
+			}
+			room[updates] = true
+			join.reply <- updates
+
+		case leave := <-self.leave:
+			room := rooms[leave.poll]
+			if room[leave.updates] {
+				delete(room, leave.updates)
+				close(leave.updates)
+				if len(room) == 0 {
+					delete(rooms, leave.poll)
+				}
+			}
+
+		case evt, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			poll, update, send := self.update(evt, rooms)
+			if poll == 0 {
+				continue
+			}
+			if !send {
+				closeRoom(poll)
+				continue
+			}
+			for updates := range rooms[poll] {
+				select {
+				case updates <- update:
+				default:
+					delete(rooms[poll], updates)
+					close(updates)
+				}
+			}
+		}
+	}
+}
+
+// update computes the update corresponding to an event. The returned poll is zero if there is
+// nothing to do. The returned boolean is false if the room must be closed.
+func (self *liveRoomsRunner) update(evt events.Event, rooms map[uint32]map[chan LiveRoomUpdate]bool) (
+	poll uint32, update LiveRoomUpdate, send bool) {
+
+	var winners []uint8
+	var withResult bool
+	var comment *LiveRoomComment
+	switch e := evt.(type) {
+	case StartPollEvent:
+		poll = e.Poll
+	case VoteEvent:
+		poll = e.Poll
+	case PausePollEvent:
+		poll = e.Poll
+	case ResumePollEvent:
+		poll = e.Poll
+	case ExtendPollEvent:
+		poll = e.Poll
+	case NextRoundEvent:
+		poll = e.Poll
+		withResult = true
+	case ClosePollEvent:
+		poll = e.Poll
+		winners = e.Winners
+		withResult = true
+	case CommentEvent:
+		poll = e.Poll
+		comment = &LiveRoomComment{Id: e.Comment, Action: e.Action}
+	case DeletePollEvent:
+		return e.Poll, update, false
+	}
+	if len(rooms[poll]) == 0 {
+		return 0, update, false
+	}
+
+	update, err := self.state(poll)
+	if err != nil {
+		self.logger.Errorf("Error retrieving state of poll %d: %v.", poll, err)
+		return 0, update, false
+	}
+
+	if withResult && update.CurrentRound > 0 {
+		result := &LiveRoomResult{Round: update.CurrentRound - 1, Winners: winners}
+		if winners == nil {
+			result.Winners, err = self.winners(poll, result.Round)
+			if err != nil {
+				self.logger.Errorf("Error computing outcome of poll %d: %v.", poll, err)
+			}
+		}
+		update.Result = result
+	}
+	update.Comment = comment
+	return poll, update, true
+}
+
+// liveRoomState retrieves the current state of a poll.
+func liveRoomState(poll uint32) (ret LiveRoomUpdate, err error) {
+	const qState = `
+	  SELECT p.State, p.CurrentRound,
+	         RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+	                       p.MinNbRounds),
+	         IFNULL(r.Count, 0)
+	    FROM Polls AS p
+	    LEFT OUTER JOIN Participants_Round_Count AS r
+	                 ON (p.Id, p.CurrentRound) = (r.Poll, r.Round) AND p.RoundType = ?
+	   WHERE p.Id = ?`
+
+	var deadline sql.NullTime
+	err = db.DB.QueryRow(qState, db.RoundTypeFreelyAsynchronous, poll).
+		Scan(&ret.State, &ret.CurrentRound, &deadline, &ret.Participants)
+	if deadline.Valid {
+		ret.RoundDeadline = deadline.Time
+	}
+	return
+}
+
+func liveRoomWinners(poll uint32, round uint8) ([]uint8, error) {
+	result, err := outcome.Compute(context.Background(), poll, round)
+	return result.Winners, err
+}
@@ -0,0 +1,123 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func liveRoomRead(t *testing.T, updates <-chan LiveRoomUpdate) (ret LiveRoomUpdate, ok bool) {
+	select {
+	case ret, ok = <-updates:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Timeout.")
+	}
+	return
+}
+
+func TestLiveRooms(t *testing.T) {
+	t.Parallel()
+
+	evtManager := events.NewAsyncManager(0)
+	defer evtManager.Close()
+	runner := newLiveRoomsRunner(&slog.WithStack{Target: t})
+	participants := map[uint32]uint32{}
+	runner.state = func(poll uint32) (LiveRoomUpdate, error) {
+		participants[poll] += 1
+		return LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: participants[poll]},
+			nil
+	}
+	runner.winners = func(poll uint32, round uint8) ([]uint8, error) {
+		return []uint8{2}, nil
+	}
+	mustt(t, runner.start(evtManager))
+
+	first, leaveFirst := runner.Join(1)
+	other, leaveOther := runner.Join(2)
+	defer leaveOther()
+
+	steps := []struct {
+		name   string
+		event  events.Event
+		expect LiveRoomUpdate
+	}{
+		{
+			name:   "Join",
+			expect: LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: 1},
+		},
+		{
+			name:   "Vote",
+			event:  VoteEvent{Poll: 1},
+			expect: LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: 2},
+		},
+		{
+			name:  "Next",
+			event: NextRoundEvent{Poll: 1, Round: 1},
+			expect: LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: 3,
+				Result: &LiveRoomResult{Round: 0, Winners: []uint8{2}}},
+		},
+		{
+			name:  "Comment",
+			event: CommentEvent{Poll: 1, Comment: 5, User: 3, Action: CommentEdited},
+			expect: LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: 4,
+				Comment: &LiveRoomComment{Id: 5, Action: CommentEdited}},
+		},
+		{
+			name:  "Close",
+			event: ClosePollEvent{Poll: 1, Winners: []uint8{1}},
+			expect: LiveRoomUpdate{State: db.StateActive, CurrentRound: 1, Participants: 5,
+				Result: &LiveRoomResult{Round: 0, Winners: []uint8{1}}},
+		},
+	}
+	for _, step := range steps {
+		if step.event != nil {
+			mustt(t, evtManager.Send(step.event))
+		}
+		got, ok := liveRoomRead(t, first)
+		if !ok {
+			t.Fatalf("%s. Channel closed.", step.name)
+		}
+		if !reflect.DeepEqual(got, step.expect) {
+			t.Errorf("%s. Got %v. Expect %v.", step.name, got, step.expect)
+		}
+	}
+
+	// Other rooms only receive their initial state.
+	liveRoomRead(t, other)
+	select {
+	case got := <-other:
+		t.Errorf("Unexpected update %v.", got)
+	default:
+	}
+
+	leaveFirst()
+	leaveFirst()
+	if _, ok := liveRoomRead(t, first); ok {
+		t.Errorf("Channel not closed after leave.")
+	}
+
+	mustt(t, evtManager.Send(DeletePollEvent{Poll: 2}))
+	if _, ok := liveRoomRead(t, other); ok {
+		t.Errorf("Channel not closed after deletion.")
+	}
+}
@@ -48,14 +48,17 @@ func (self *nextRoundService) ProcessOne(id uint32) error {
 	      FROM Polls AS p
 	      LEFT OUTER JOIN Participants_Round_Count AS r ON (p.Id, p.CurrentRound) = (r.Poll, r.Round)
 	      LEFT OUTER JOIN Participants_Poll_Count  AS a ON p.Id = a.Poll
+	      LEFT OUTER JOIN Delegations_Round_Count  AS g ON (p.Id, p.CurrentRound) = (g.Poll, g.Round)
+	      LEFT OUTER JOIN Delegations_Poll_Count   AS h ON p.Id = h.Poll
 	     WHERE p.Id = ? AND p.State = 'Active' AND p.CurrentRound < p.MaxNbRounds
 	       AND (   ( RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline,
 	                               p.CurrentRound, p.MinNbRounds) <= CURRENT_TIMESTAMP()
 	                 AND ( p.CurrentRound > 0 OR r.Count > 2 ))
 	            OR (    p.CurrentRound > 0
-	                AND (   (p.RoundThreshold = 0 AND r.Count > 0)
+	                AND (   (p.RoundThreshold = 0 AND IFNULL(r.Count, 0) + IFNULL(g.Count, 0) > 0)
 	                     OR ( p.RoundThreshold > 0
-	                          AND r.Count / a.Count >= p.RoundThreshold ) )
+	                          AND (IFNULL(r.Weight, 0) + IFNULL(g.Weight, 0)) /
+	                              (IFNULL(a.Weight, 0) + IFNULL(h.Weight, 0)) >= p.RoundThreshold ) )
 	                AND (   (p.CurrentRound + 1 < MinNbRounds)
 	                     OR p.Deadline IS NULL
 	                     OR (ADDTIME(CURRENT_TIMESTAMP(), p.MaxRoundDuration) < p.Deadline)
@@ -109,9 +112,10 @@ func (self *nextRoundService) CheckOne(id uint32) (ret time.Time) {
 			                     p.MinNbRounds) <= CURRENT_TIMESTAMP,
 	           COALESCE(p.CurrentRound > 0 OR r.Count > 2, FALSE),
 	           COALESCE(    p.CurrentRound > 0
-	                    AND (   (p.RoundThreshold = 0 AND r.Count > 0)
+	                    AND (   (p.RoundThreshold = 0 AND IFNULL(r.Count, 0) + IFNULL(g.Count, 0) > 0)
 	                         OR ( p.RoundThreshold > 0
-	                              AND r.Count / a.Count >= p.RoundThreshold ) )
+	                              AND (IFNULL(r.Weight, 0) + IFNULL(g.Weight, 0)) /
+	                                  (IFNULL(a.Weight, 0) + IFNULL(h.Weight, 0)) >= p.RoundThreshold ) )
 	                    AND (   (p.CurrentRound + 1 < MinNbRounds)
 	                         OR p.Deadline IS NULL
 	                         OR (ADDTIME(CURRENT_TIMESTAMP(), p.MaxRoundDuration) < p.Deadline)
@@ -119,6 +123,8 @@ func (self *nextRoundService) CheckOne(id uint32) (ret time.Time) {
 	      FROM Polls AS p
 	      LEFT OUTER JOIN Participants_Round_Count AS r ON (p.Id, p.CurrentRound) = (r.Poll, r.Round)
 	      LEFT OUTER JOIN Participants_Poll_Count  AS a ON p.Id = a.Poll
+	      LEFT OUTER JOIN Delegations_Round_Count  AS g ON (p.Id, p.CurrentRound) = (g.Poll, g.Round)
+	      LEFT OUTER JOIN Delegations_Poll_Count   AS h ON p.Id = h.Poll
 	     WHERE p.Id = ? AND p.State = 'Active' AND p.CurrentRound < p.MaxNbRounds`
 
 	rows, err := db.DB.Query(qCheck, id)
@@ -156,7 +162,8 @@ func (self *nextRoundService) Logger() slog.Leveled {
 
 func (self *nextRoundService) FilterEvent(evt events.Event) bool {
 	switch evt.(type) {
-	case VoteEvent, CreatePollEvent, StartPollEvent:
+	case VoteEvent, CreatePollEvent, UpdatePollEvent, StartPollEvent, ResumePollEvent,
+		ExtendPollEvent:
 		return true
 	}
 	return false
@@ -168,7 +175,13 @@ func (self *nextRoundService) ReceiveEvent(evt events.Event, ctrl service.Runner
 		ctrl.Schedule(e.Poll)
 	case CreatePollEvent:
 		ctrl.Schedule(e.Poll)
+	case UpdatePollEvent:
+		ctrl.Schedule(e.Poll)
 	case StartPollEvent:
 		ctrl.Schedule(e.Poll)
+	case ResumePollEvent:
+		ctrl.Schedule(e.Poll)
+	case ExtendPollEvent:
+		ctrl.Schedule(e.Poll)
 	}
 }
@@ -33,12 +33,13 @@ import (
 
 type nextRoundTestInstance struct {
 	name         string
-	round        uint8   // CurrentRound (MaxNbRounds = 3)
-	minNbRounds  uint8   // applied only if >2
-	nowFact      float32 // if  >0 set Now      = CurrentRoundStart + nowFact      * MaxRoundDuration
-	deadlineFact float32 // if !=0 set Deadline = CurrentRoundStart + deadlineFact * MaxRoundDuration
-	threshold    float64 // RoundThreshold
-	nbVoter      int     // number of Participant with LastRound = Poll.CurrentRound
+	round        uint8    // CurrentRound (MaxNbRounds = 3)
+	minNbRounds  uint8    // applied only if >2
+	nowFact      float32  // if  >0 set Now      = CurrentRoundStart + nowFact      * MaxRoundDuration
+	deadlineFact float32  // if !=0 set Deadline = CurrentRoundStart + deadlineFact * MaxRoundDuration
+	threshold    float64  // RoundThreshold
+	nbVoter      int      // number of Participant with LastRound = Poll.CurrentRound
+	weights      []uint32 // weights of the first participants
 	expectNext   bool
 	expectList   bool               // whether it must be listed by CheckAll
 	expectCheck  testCheckOneResult // kind of response from CheckOne (see testCheckOneResult*)
@@ -61,6 +62,7 @@ func metaTestNextRound(t *testing.T, checker func(*testing.T, *nextRoundTestInst
 		qParticipate = `INSERT INTO Participants(Poll, User, Round) VALUE (?,?,?)`
 		qUpdatePoll  = `UPDATE Polls SET CurrentRound = ?, RoundThreshold = ? WHERE Id = ?`
 		qSetMin      = `UPDATE Polls SET MinNbRounds = ? WHERE Id = ?`
+		qSetWeight   = `INSERT INTO Weights(Poll, User, Weight) VALUE (?,?,?)`
 		qSetNow      = `
 		  UPDATE Polls
 		     SET CurrentRoundStart = SUBTIME(CURRENT_TIMESTAMP(), ? * MaxRoundDuration)
@@ -120,6 +122,26 @@ func metaTestNextRound(t *testing.T, checker func(*testing.T, *nextRoundTestInst
 			expectList:  true,
 			expectCheck: testCheckOneResultPast,
 		},
+		{
+			name:        "Threshold weighted",
+			round:       1,
+			threshold:   0.5,
+			nbVoter:     1,
+			weights:     []uint32{3},
+			expectNext:  true,
+			expectList:  true,
+			expectCheck: testCheckOneResultPast,
+		},
+		{
+			name:        "Threshold weighted insufficient",
+			round:       1,
+			threshold:   0.5,
+			nbVoter:     1,
+			weights:     []uint32{1, 3},
+			expectNext:  false,
+			expectList:  true,
+			expectCheck: testCheckOneResultFuture,
+		},
 		{
 			name:         "Last round time",
 			round:        1,
@@ -207,6 +229,11 @@ func metaTestNextRound(t *testing.T, checker func(*testing.T, *nextRoundTestInst
 			if err == nil && tt.deadlineFact != 0 {
 				_, err = db.DB.Exec(qSetDeadline, tt.deadlineFact, pollId)
 			}
+			for i, weight := range tt.weights {
+				if err == nil {
+					_, err = db.DB.Exec(qSetWeight, pollId, user[i], weight)
+				}
+			}
 			if err == nil && tt.nbVoter > 0 {
 				stmt, err = db.DB.Prepare(qParticipate)
 				mustt(t, err)
@@ -378,14 +405,33 @@ func TestNextRoundService_Events(t *testing.T) {
 			event:    CreatePollEvent{2},
 			schedule: []uint32{2},
 		},
+		{
+			name:     "UpdatePollEvent",
+			event:    UpdatePollEvent{4},
+			schedule: []uint32{4},
+		},
 		{
 			name:     "StartPollEvent",
 			event:    StartPollEvent{3},
 			schedule: []uint32{3},
 		},
+		{
+			name:     "ResumePollEvent",
+			event:    ResumePollEvent{5},
+			schedule: []uint32{5},
+		},
+		{
+			name:     "ExtendPollEvent",
+			event:    ExtendPollEvent{6},
+			schedule: []uint32{6},
+		},
+		{
+			name:  "PausePollEvent",
+			event: PausePollEvent{7},
+		},
 		{
 			name:  "ClosePollEvent",
-			event: ClosePollEvent{42},
+			event: ClosePollEvent{Poll: 42},
 		},
 	}
 	checkEventSchedule(t, tests, NextRoundService)
@@ -0,0 +1,138 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// PollNotifRetention is the duration notifications are kept in the inbox of users.
+const PollNotifRetention = 30 * 24 * time.Hour
+
+// PollNotifInboxService is the factory for the service that stores the notifications about polls
+// in the inbox of the administrator and of the participants of each poll. Notifications older
+// than PollNotifRetention are removed.
+func PollNotifInboxService(log slog.StackedLeveled) *pollNotifInboxService {
+	return &pollNotifInboxService{log: log.With("PollNotifInbox")}
+}
+
+//
+// Implementation
+//
+
+type pollNotifInboxService struct {
+	log slog.Leveled
+}
+
+func (self *pollNotifInboxService) ProcessOne(id uint32) error {
+	const qDelete = `
+	  DELETE FROM PollNotifications
+	   WHERE User = ? AND Created < CURRENT_TIMESTAMP - INTERVAL ? SECOND`
+	result, err := db.DB.Exec(qDelete, id, int64(PollNotifRetention/time.Second))
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return service.NothingToDoYet
+	}
+	return nil
+}
+
+func (self *pollNotifInboxService) CheckAll() service.Iterator {
+	const qList = `
+	  SELECT User, MIN(Created) + INTERVAL ? SECOND AS First FROM PollNotifications
+	   GROUP BY User
+	   ORDER BY First ASC`
+	return service.SQLCheckAll(qList, int64(PollNotifRetention/time.Second))
+}
+
+func (self *pollNotifInboxService) CheckOne(id uint32) (ret time.Time) {
+	const qCheck = `SELECT MIN(Created) + INTERVAL ? SECOND FROM PollNotifications WHERE User = ?`
+	var expire sql.NullTime
+	err := db.DB.QueryRow(qCheck, int64(PollNotifRetention/time.Second), id).Scan(&expire)
+	if err != nil {
+		self.log.Errorf("Error in CheckOne: %v", err)
+	}
+	if expire.Valid {
+		ret = expire.Time
+	}
+	return
+}
+
+func (self *pollNotifInboxService) Interval() time.Duration {
+	return 24 * time.Hour
+}
+
+func (self *pollNotifInboxService) Logger() slog.Leveled {
+	return self.log
+}
+
+func (self *pollNotifInboxService) FilterEvent(evt events.Event) bool {
+	switch evt.(type) {
+	case StartPollEvent, NextRoundEvent, ClosePollEvent, DeletePollEvent, PausePollEvent,
+		ResumePollEvent, ExtendPollEvent:
+		return true
+	}
+	return false
+}
+
+// ReceiveEvent stores the notification. The runner is not used, since new notifications never
+// expire before the ones already stored.
+func (self *pollNotifInboxService) ReceiveEvent(evt events.Event, ctrl service.RunnerControler) {
+	const (
+		qInsert = `
+		  INSERT INTO PollNotifications (User, Poll, Action, Round, Title, Winners)
+		  SELECT u.User, p.Id, ?, ?, p.Title, ?
+		    FROM Polls AS p, (
+		             SELECT Admin AS User FROM Polls WHERE Id = ?
+		              UNION
+		             SELECT User FROM Participants WHERE Poll = ?
+		         ) AS u
+		   WHERE p.Id = ?`
+		qInsertDeleted = `
+		  INSERT INTO PollNotifications (User, Poll, Action, Round, Title, Winners)
+		  VALUE (?, ?, ?, ?, ?, ?)`
+	)
+
+	notif := NewPollNotification(evt)
+	winners := []byte(notif.Winners)
+
+	if notif.Participants == nil {
+		_, err := db.DB.Exec(qInsert, notif.Action, notif.Round, winners, notif.Id, notif.Id, notif.Id)
+		if err != nil {
+			self.log.Errorf("Error storing notifications for poll %d: %v", notif.Id, err)
+		}
+		return
+	}
+
+	for user, member := range notif.Participants {
+		if !member {
+			continue
+		}
+		_, err := db.DB.Exec(qInsertDeleted, user, notif.Id, notif.Action, notif.Round, notif.Title,
+			winners)
+		if err != nil {
+			self.log.Errorf("Error storing notification for user %d: %v", user, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func TestPollNotifInboxService(t *testing.T) {
+	t.Parallel()
+
+	const (
+		qCount = `SELECT COUNT(*) FROM PollNotifications WHERE User = ?`
+		qLast  = `
+		  SELECT Poll, Action, Round, Title, Winners FROM PollNotifications
+		   WHERE User = ? ORDER BY Id DESC LIMIT 1`
+		qAge = `UPDATE PollNotifications SET Created = Created - INTERVAL 31 DAY WHERE User = ?`
+	)
+
+	env := new(dbt.Env)
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name() + "Admin")
+	participant := env.CreateUserWith(t.Name() + "Part")
+	alien := env.CreateUserWith(t.Name() + "Alien")
+	poll := env.CreatePoll("Inbox", admin, db.ElectorateAll)
+	env.Vote(poll, 0, participant, 0)
+	env.Must(t)
+
+	svc := &pollNotifInboxService{log: &slog.WithStack{Target: t}}
+
+	count := func(user uint32) (ret int) {
+		mustt(t, db.DB.QueryRow(qCount, user).Scan(&ret))
+		return
+	}
+
+	// Receive
+	for _, evt := range []events.Event{
+		StartPollEvent{Poll: poll},
+		NextRoundEvent{Poll: poll, Round: 1},
+		ClosePollEvent{Poll: poll, Winners: []uint8{1}},
+	} {
+		if !svc.FilterEvent(evt) {
+			t.Fatalf("Event %v filtered out.", evt)
+		}
+		svc.ReceiveEvent(evt, &mockRunnerController{})
+	}
+	if svc.FilterEvent(VoteEvent{Poll: poll}) {
+		t.Errorf("VoteEvent not filtered out.")
+	}
+
+	for _, user := range []uint32{admin, participant} {
+		if got := count(user); got != 3 {
+			t.Errorf("Wrong number of notifications for %d. Got %d. Expect 3.", user, got)
+		}
+	}
+	if got := count(alien); got != 0 {
+		t.Errorf("Wrong number of notifications for alien. Got %d. Expect 0.", got)
+	}
+
+	var (
+		gotPoll   uint32
+		gotAction PollNotifAction
+		gotRound  uint8
+		gotTitle  string
+		gotWin    []byte
+	)
+	mustt(t, db.DB.QueryRow(qLast, participant).Scan(&gotPoll, &gotAction, &gotRound, &gotTitle,
+		&gotWin))
+	if gotPoll != poll || gotAction != PollNotifTerm || gotTitle != "Inbox" ||
+		!bytes.Equal(gotWin, []byte{1}) {
+		t.Errorf("Wrong notification. Got %d %d %d %s %v.", gotPoll, gotAction, gotRound, gotTitle,
+			gotWin)
+	}
+
+	// Deleted poll
+	svc.ReceiveEvent(DeletePollEvent{Poll: poll + 1000, Title: "Deleted",
+		Participants: map[uint32]bool{alien: true}}, &mockRunnerController{})
+	if got := count(alien); got != 1 {
+		t.Errorf("Wrong number of notifications for alien. Got %d. Expect 1.", got)
+	}
+
+	// Retention
+	if err := svc.ProcessOne(admin); !errors.Is(err, service.NothingToDoYet) {
+		t.Errorf("Wrong error. Got %v. Expect NothingToDoYet.", err)
+	}
+	if expire := svc.CheckOne(admin); expire.Before(time.Now().Add(PollNotifRetention - time.Hour)) {
+		t.Errorf("Wrong expiration date %v.", expire)
+	}
+	_, err := db.DB.Exec(qAge, admin)
+	mustt(t, err)
+	mustt(t, svc.ProcessOne(admin))
+	if got := count(admin); got != 0 {
+		t.Errorf("Notifications not removed. %d remain.", got)
+	}
+	if expire := svc.CheckOne(admin); !expire.IsZero() {
+		t.Errorf("Unexpected expiration date %v.", expire)
+	}
+}
@@ -18,101 +18,11 @@ package services
 
 import (
 	"testing"
-	"time"
 
 	"github.com/JBoudou/Itero/pkg/events"
 )
 
-// TestPollNotifList_Global tests all pollNotifList's methods but in only one scenario.
-func TestPollNotifList_Global(t *testing.T) {
-	const delay = 210 * time.Millisecond
-
-	tests := []struct {
-		read  [2]uint32 // {min, max+1}
-		write [2]uint32 // {min, max+1}
-		sleep int       // milliseconds
-	}{
-		{
-			read:  [2]uint32{0, 0},
-			write: [2]uint32{1, 4},
-			sleep: 180,
-		},
-		{
-			read:  [2]uint32{1, 4},
-			write: [2]uint32{4, 6},
-			sleep: 60,
-		},
-		{
-			read:  [2]uint32{4, 6},
-			write: [2]uint32{6, 20},
-			sleep: 30,
-		},
-		{
-			read:  [2]uint32{4, 20},
-			write: [2]uint32{0, 0},
-			sleep: 210,
-		},
-		{
-			read:  [2]uint32{0, 0},
-			write: [2]uint32{20, 21},
-			sleep: 1,
-		},
-		{
-			read:  [2]uint32{20, 21},
-			write: [2]uint32{21, 22},
-			sleep: 1,
-		},
-	}
-
-	list := newPollNotifList(delay)
-	for step, tt := range tests {
-		ts := time.Now()
-
-		// Read
-		sl := list.Slice()
-		sllen := len(sl)
-		if sllen != int(tt.read[1]-tt.read[0]) {
-			t.Errorf("Step %d. Read. Got len %d. Expect %d.", step, sllen, tt.read[1]-tt.read[0])
-		}
-		for i, got := range sl {
-			if expect := tt.read[0] + uint32(i); got.Id != expect {
-				t.Errorf("Step %d. Read. Got slice[%d] = %d. Expect %d.", step, i, got.Id, expect)
-			}
-		}
-
-		// Copy
-		slcopy := list.Copy().Slice()
-		cplen := len(slcopy)
-		if sllen != cplen {
-			t.Errorf("Step %d. Copy. Got len %d. Expect %d.", step, cplen, sllen)
-			if cplen > sllen {
-				cplen = sllen
-			}
-		}
-		for i := 0; i < cplen; i++ {
-			if slcopy[i].Id != sl[i].Id {
-				t.Errorf("Step %d. Copy. Got copy[%d] = %d. Expect %d.", step, i, slcopy[i].Id, sl[i].Id)
-			}
-		}
-
-		// Write
-		for id := tt.write[0]; id < tt.write[1]; id++ {
-			list.Add(&PollNotification{Timestamp: ts, Id: id})
-		}
-
-		// Sleep
-		time.Sleep(time.Duration(tt.sleep) * time.Millisecond)
-	}
-}
-
-func TestPollNotif(t *testing.T) {
-	t.Parallel()
-
-	evtManager := events.NewAsyncManager(0)
-	defer evtManager.Close()
-	notifChannel, err := RunPollNotif(10*time.Millisecond, evtManager)
-	mustt(t, err)
-
+func TestNewPollNotification(t *testing.T) {
 	elements := []struct {
 		event  events.Event
 		id     uint32
@@ -135,29 +45,40 @@ func TestPollNotif(t *testing.T) {
 			id:     3,
 			action: PollNotifTerm,
 		},
+		{
+			event:  PausePollEvent{Poll: 4},
+			id:     4,
+			action: PollNotifPause,
+		},
+		{
+			event:  ResumePollEvent{Poll: 5},
+			id:     5,
+			action: PollNotifResume,
+		},
+		{
+			event:  ExtendPollEvent{Poll: 6},
+			id:     6,
+			action: PollNotifExtend,
+		},
+		{
+			event:  DeletePollEvent{Poll: 7},
+			id:     7,
+			action: PollNotifDelete,
+		},
 	}
-	for _, elt := range elements {
-		evtManager.Send(elt.event)
-	}
-	time.Sleep(5 * time.Millisecond)
-
-	sl := <-notifChannel
-	sllen := len(sl)
-	if sllen != len(elements) {
-		t.Errorf("Wrong slice len. Got %d. Expect %d.", sllen, len(elements))
-		if sllen > len(elements) {
-			sllen = len(elements)
+	for i, elt := range elements {
+		notif := NewPollNotification(elt.event)
+		if notif.Timestamp.IsZero() {
+			t.Errorf("Zero timestamp at index %d.", i)
 		}
-	}
-	for i := 0; i < sllen; i++ {
-		if sl[i].Id != elements[i].id {
-			t.Errorf("Wrong notif id at index %d. Got %d. Expect %d.", i, sl[i].Id, elements[i].id)
+		if notif.Id != elt.id {
+			t.Errorf("Wrong notif id at index %d. Got %d. Expect %d.", i, notif.Id, elt.id)
 		}
-		if sl[i].Round != elements[i].round {
-			t.Errorf("Wrong notif round at index %d. Got %d. Expect %d.", i, sl[i].Round, elements[i].round)
+		if notif.Round != elt.round {
+			t.Errorf("Wrong notif round at index %d. Got %d. Expect %d.", i, notif.Round, elt.round)
 		}
-		if sl[i].Action != elements[i].action {
-			t.Errorf("Wrong notif action at index %d. Got %d. Expect %d.", i, sl[i].Action, elements[i].action)
+		if notif.Action != elt.action {
+			t.Errorf("Wrong notif action at index %d. Got %d. Expect %d.", i, notif.Action, elt.action)
 		}
 	}
 }
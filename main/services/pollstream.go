@@ -0,0 +1,296 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/root"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// PollNotifStreamEntry is a notification sent by a PollNotifStream.
+// Identifiers are strictly increasing.
+type PollNotifStreamEntry struct {
+	Id           uint64
+	Notification *PollNotification
+}
+
+// PollNotifStream dispatches poll notifications to its subscribers as soon as the corresponding
+// events are received. Contrary to PollNotifInboxService, it also sends a PollNotifVote
+// notification each time a ballot is accepted. The Round and Voters fields of these notifications
+// are the current round of the poll and its number of participants. Voters is zero unless the
+// poll is freely asynchronous, since the participants of sealed rounds must not be revealed.
+//
+// The Participants field of all notifications is set by the stream. It contains the administrator
+// and the participants of the poll, who are the only users the notification must be sent to. The
+// Title and Segment fields are also set, except for deleted polls whose Segment is empty.
+//
+// A factory is binded to this type in root.IoC. The factory calls RunPollNotifStream with
+// PollNotifStreamDelay as delay.
+type PollNotifStream interface {
+	// Subscribe registers a new subscriber. If lastId is not zero, the recent notifications whose
+	// identifier is strictly greater than lastId are sent first. The returned channel is closed when
+	// cancel is called, when the subscriber does not read notifications fast enough, or when the
+	// stream stops. Calling cancel more than once has no effect.
+	Subscribe(lastId uint64) (notifs <-chan PollNotifStreamEntry, cancel func())
+}
+
+// PollNotifStreamDelay is the default duration during which notifications are kept to be sent to
+// reconnecting subscribers.
+const PollNotifStreamDelay = 5 * time.Minute
+
+// pollNotifStreamBuffer is the number of notifications a subscriber may be late of.
+const pollNotifStreamBuffer = 64
+
+func init() {
+	root.IoC.Bind(func(evtManager events.Manager, logger slog.Leveled) (PollNotifStream, error) {
+		return RunPollNotifStream(PollNotifStreamDelay, evtManager, logger)
+	})
+}
+
+// RunPollNotifStream launches the service that dispatches notifications to subscribers.
+//
+// Notifications correspond to events received from the given event Manager. They are kept for the
+// given duration, to be sent to reconnecting subscribers.
+func RunPollNotifStream(delay time.Duration, evtManager events.Manager, logger slog.Leveled) (
+	PollNotifStream, error) {
+
+	runner := newPollNotifStreamRunner(delay, logger)
+	if err := runner.start(evtManager); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+func newPollNotifStreamRunner(delay time.Duration, logger slog.Leveled) *pollNotifStreamRunner {
+	return &pollNotifStreamRunner{
+		delay:      delay,
+		voters:     pollVoters,
+		recipients: pollRecipients,
+		logger:     logger,
+		// Identifiers are initialised from the current time, such that subscribers reconnecting
+		// after a restart of the server receive all the new notifications.
+		lastId:      uint64(time.Now().UnixNano()),
+		subscribe:   make(chan pollNotifSubscription),
+		unsubscribe: make(chan chan PollNotifStreamEntry),
+		done:        make(chan struct{}),
+	}
+}
+
+type pollNotifSubscription struct {
+	lastId uint64
+	reply  chan chan PollNotifStreamEntry
+}
+
+type pollNotifStreamRunner struct {
+	delay      time.Duration
+	voters     func(poll uint32) (round uint8, count uint32, err error)
+	recipients func(notif *PollNotification) error
+	logger     slog.Leveled
+	lastId     uint64
+	history    []PollNotifStreamEntry
+
+	subscribe   chan pollNotifSubscription
+	unsubscribe chan chan PollNotifStreamEntry
+	done        chan struct{}
+}
+
+func (self *pollNotifStreamRunner) start(evtManager events.Manager) error {
+	eventChan := make(chan events.Event, 64)
+	err := evtManager.AddReceiver(events.AsyncForwarder{
+		Filter: self.filter,
+		Chan:   eventChan,
+	})
+	if err != nil {
+		return err
+	}
+	go self.run(eventChan)
+	return nil
+}
+
+func (self *pollNotifStreamRunner) Subscribe(lastId uint64) (<-chan PollNotifStreamEntry, func()) {
+	subscription := pollNotifSubscription{lastId: lastId, reply: make(chan chan PollNotifStreamEntry, 1)}
+	select {
+	case self.subscribe <- subscription:
+	case <-self.done:
+		closed := make(chan PollNotifStreamEntry)
+		close(closed)
+		return closed, func() {}
+	}
+	notifs := <-subscription.reply
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			select {
+			case self.unsubscribe <- notifs:
+			case <-self.done:
+			}
+		})
+	}
+	return notifs, cancel
+}
+
+func (self *pollNotifStreamRunner) filter(evt events.Event) bool {
+	switch evt.(type) {
+	case StartPollEvent, NextRoundEvent, ClosePollEvent, DeletePollEvent, PausePollEvent,
+		ResumePollEvent, ExtendPollEvent, VoteEvent:
+		return true
+	}
+	return false
+}
+
+func (self *pollNotifStreamRunner) run(eventChan <-chan events.Event) {
+	subscribers := make(map[chan PollNotifStreamEntry]bool)
+	defer func() {
+		close(self.done)
+		for notifs := range subscribers {
+			close(notifs)
+		}
+	}()
+
+	for {
+		select {
+		case subscription := <-self.subscribe:
+			self.tidy()
+			var replay []PollNotifStreamEntry
+			if subscription.lastId > 0 {
+				for i, entry := range self.history {
+					if entry.Id > subscription.lastId {
+						replay = self.history[i:]
+						break
+					}
+				}
+			}
+			notifs := make(chan PollNotifStreamEntry, len(replay)+pollNotifStreamBuffer)
+			for _, entry := range replay {
+				notifs <- entry
+			}
+			subscribers[notifs] = true
+			subscription.reply <- notifs
+
+		case notifs := <-self.unsubscribe:
+			if subscribers[notifs] {
+				delete(subscribers, notifs)
+				close(notifs)
+			}
+
+		case evt, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			notif := NewPollNotification(evt)
+			if notif.Action == PollNotifVote {
+				var err error
+				notif.Round, notif.Voters, err = self.voters(notif.Id)
+				if err != nil {
+					self.logger.Errorf("Error counting voters of poll %d: %v.", notif.Id, err)
+					continue
+				}
+			}
+			if notif.Participants == nil {
+				if err := self.recipients(notif); err != nil {
+					self.logger.Errorf("Error retrieving recipients of poll %d: %v.", notif.Id, err)
+					continue
+				}
+			}
+
+			self.lastId++
+			entry := PollNotifStreamEntry{Id: self.lastId, Notification: notif}
+			self.tidy()
+			self.history = append(self.history, entry)
+
+			for notifs := range subscribers {
+				select {
+				case notifs <- entry:
+				default:
+					delete(subscribers, notifs)
+					close(notifs)
+				}
+			}
+		}
+	}
+}
+
+// tidy removes too old notifications from the history.
+func (self *pollNotifStreamRunner) tidy() {
+	limit := time.Now().Add(-1 * self.delay)
+	first := 0
+	for first < len(self.history) && self.history[first].Notification.Timestamp.Before(limit) {
+		first++
+	}
+	if first > 0 {
+		self.history = append(self.history[:0], self.history[first:]...)
+	}
+}
+
+// pollVoters returns the current round of a poll and the number of its participants.
+// The number of participants is zero if the poll is not freely asynchronous.
+func pollVoters(poll uint32) (round uint8, count uint32, err error) {
+	const qVoters = `
+	  SELECT p.CurrentRound, COUNT(r.User)
+	    FROM Polls AS p
+	    LEFT OUTER JOIN Participants AS r
+	                 ON (p.Id, p.CurrentRound) = (r.Poll, r.Round) AND p.RoundType = ?
+	   WHERE p.Id = ?
+	   GROUP BY p.Id, p.CurrentRound`
+	err = db.DB.QueryRow(qVoters, db.RoundTypeFreelyAsynchronous, poll).Scan(&round, &count)
+	return
+}
+
+// pollRecipients sets the Title, Segment and Participants fields of a notification about an
+// existing poll. Participants contains the administrator and the participants of the poll.
+func pollRecipients(notif *PollNotification) (err error) {
+	const qRecipients = `
+	  SELECT DISTINCT p.Title, p.Salt, p.Admin, r.User
+	    FROM Polls AS p
+	    LEFT OUTER JOIN Participants AS r ON p.Id = r.Poll
+	   WHERE p.Id = ?`
+
+	rows, err := db.DB.Query(qRecipients, notif.Id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	notif.Participants = make(map[uint32]bool)
+	segment := salted.Segment{Id: notif.Id}
+	for rows.Next() {
+		var admin uint32
+		var user sql.NullInt64
+		if err = rows.Scan(&notif.Title, &segment.Salt, &admin, &user); err != nil {
+			return
+		}
+		notif.Participants[admin] = true
+		if user.Valid {
+			notif.Participants[uint32(user.Int64)] = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if len(notif.Participants) > 0 {
+		notif.Segment, err = segment.Encode()
+	}
+	return
+}
@@ -0,0 +1,122 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func pollNotifStreamRead(t *testing.T, notifs <-chan PollNotifStreamEntry, nb int) (
+	ret []PollNotifStreamEntry) {
+
+	for len(ret) < nb {
+		select {
+		case entry, ok := <-notifs:
+			if !ok {
+				t.Fatalf("Channel closed after %d notifications. Expect %d.", len(ret), nb)
+			}
+			ret = append(ret, entry)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("Timeout after %d notifications. Expect %d.", len(ret), nb)
+		}
+	}
+	return
+}
+
+func TestPollNotifStream(t *testing.T) {
+	t.Parallel()
+
+	evtManager := events.NewAsyncManager(0)
+	defer evtManager.Close()
+	runner := newPollNotifStreamRunner(time.Minute, &slog.WithStack{Target: t})
+	runner.voters = func(poll uint32) (uint8, uint32, error) {
+		return 2, 7, nil
+	}
+	runner.recipients = func(notif *PollNotification) error {
+		notif.Participants = map[uint32]bool{1: true}
+		return nil
+	}
+	mustt(t, runner.start(evtManager))
+
+	elements := []struct {
+		event  events.Event
+		id     uint32
+		round  uint8
+		voters uint32
+		action PollNotifAction
+	}{
+		{
+			event:  StartPollEvent{Poll: 1},
+			id:     1,
+			action: PollNotifStart,
+		},
+		{
+			event:  VoteEvent{Poll: 2},
+			id:     2,
+			round:  2,
+			voters: 7,
+			action: PollNotifVote,
+		},
+		{
+			event:  NextRoundEvent{Poll: 3, Round: 4},
+			id:     3,
+			round:  4,
+			action: PollNotifNext,
+		},
+	}
+
+	notifs, cancel := runner.Subscribe(0)
+	for _, elt := range elements {
+		evtManager.Send(elt.event)
+	}
+	got := pollNotifStreamRead(t, notifs, len(elements))
+	for i, elt := range elements {
+		notif := got[i].Notification
+		if notif.Id != elt.id || notif.Round != elt.round || notif.Voters != elt.voters ||
+			notif.Action != elt.action {
+			t.Errorf("Wrong notif at index %d. Got %v. Expect %v.", i, *notif, elt)
+		}
+		if i > 0 && got[i].Id <= got[i-1].Id {
+			t.Errorf("Identifiers not increasing at index %d.", i)
+		}
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-notifs; ok {
+		t.Errorf("Channel not closed after cancel.")
+	}
+
+	// Reconnection
+	replayed, cancel := runner.Subscribe(got[0].Id)
+	defer cancel()
+	again := pollNotifStreamRead(t, replayed, len(got)-1)
+	for i, entry := range again {
+		if entry.Id != got[i+1].Id {
+			t.Errorf("Wrong replayed notif at index %d. Got %d. Expect %d.", i, entry.Id, got[i+1].Id)
+		}
+	}
+	select {
+	case entry := <-replayed:
+		t.Errorf("Unexpected notification %d.", entry.Id)
+	default:
+	}
+}
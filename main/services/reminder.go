@@ -0,0 +1,234 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/server"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/emailsender"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// DefaultReminderLead is the time before the end of a round at which reminders are sent, when not
+// configured.
+const DefaultReminderLead = 12 * time.Hour
+
+// ReminderService is the factory for the service that reminds participants by email that the
+// current round of a poll is about to end while they have not voted yet. Each user receives at
+// most one reminder per round.
+func ReminderService(sender emailsender.Sender, log slog.StackedLeveled) *reminderService {
+	lead := DefaultReminderLead
+	if emailConfig.ReminderLead != "" {
+		parsed, err := time.ParseDuration(emailConfig.ReminderLead)
+		if err == nil {
+			lead = parsed
+		} else {
+			log.Errorf("Wrong ReminderLead: %v", err)
+		}
+	}
+	return &reminderService{
+		mailer: emailService{sender: sender, log: log.With("Reminder")},
+		lead:   lead,
+	}
+}
+
+//
+// Implementation
+//
+
+type reminderService struct {
+	mailer emailService
+	lead   time.Duration
+}
+
+// reminderRecipients is the condition for user u to be reminded about poll p.
+// The user must be able to vote in the poll, and must neither have voted in the current round,
+// nor delegated its ballot, nor already been reminded. As in outcome.LoadDelegations, only the
+// delegations recorded during the current round are effective, unless the poll reports votes.
+const reminderRecipients = `
+	    u.Email IS NOT NULL AND u.Verified
+	AND IFNULL((SELECT e.OnReminder FROM EmailPreferences AS e WHERE e.User = u.Id), TRUE)
+	AND (   EXISTS (SELECT 1 FROM Participants AS a WHERE (a.Poll, a.User) = (p.Id, u.Id))
+	     OR EXISTS (SELECT 1 FROM Invitations  AS i WHERE (i.Poll, i.User) = (p.Id, u.Id)))
+	AND NOT EXISTS (SELECT 1 FROM Participants AS c
+	                 WHERE (c.Poll, c.User, c.Round) = (p.Id, u.Id, p.CurrentRound))
+	AND NOT EXISTS (SELECT 1 FROM Reminders AS r
+	                 WHERE (r.Poll, r.User, r.Round) = (p.Id, u.Id, p.CurrentRound))
+	AND NOT EXISTS (SELECT 1 FROM Delegations AS d
+	                 WHERE (d.Poll, d.User) = (p.Id, u.Id) AND d.Delegate IS NOT NULL
+	                   AND (   d.Round = p.CurrentRound
+	                        OR (    p.ReportVote AND d.Round < p.CurrentRound
+	                            AND NOT EXISTS (SELECT 1 FROM Delegations AS n
+	                                             WHERE (n.Poll, n.User) = (d.Poll, d.User)
+	                                               AND n.Round > d.Round AND n.Round <= p.CurrentRound)
+	                            AND NOT EXISTS (SELECT 1 FROM Participants AS v
+	                                             WHERE (v.Poll, v.User) = (d.Poll, d.User)
+	                                               AND v.Round > d.Round AND v.Round <= p.CurrentRound))))`
+
+// reminderPolls is the condition for poll p to have a round deadline in the future.
+const reminderPolls = `
+	    p.State = 'Active' AND p.CurrentRound < p.MaxNbRounds
+	AND RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+	                  p.MinNbRounds) > CURRENT_TIMESTAMP`
+
+func (self *reminderService) ProcessOne(id uint32) error {
+	const (
+		qPoll = `
+		  SELECT p.Title, p.Salt, p.CurrentRound,
+		         RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+		                       p.MinNbRounds)
+		    FROM Polls AS p
+		   WHERE p.Id = ? AND ` + reminderPolls + `
+		     AND RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+		                       p.MinNbRounds) <= CURRENT_TIMESTAMP + INTERVAL ? SECOND`
+		qUsers = `
+		  SELECT u.Id, u.Name, u.Email
+		    FROM Users AS u, Polls AS p
+		   WHERE p.Id = ? AND ` + reminderRecipients
+		qSent = `INSERT IGNORE INTO Reminders (Poll, User, Round) VALUE (?, ?, ?)`
+	)
+
+	var data struct {
+		Sender   string
+		Name     string
+		Address  string
+		BaseURL  string
+		Title    string
+		Round    uint8
+		Deadline time.Time
+		Link     string
+	}
+	data.Sender = emailConfig.Sender
+	data.BaseURL = server.BaseURL()
+
+	segment := salted.Segment{Id: id}
+	var round uint8
+	err := db.DB.QueryRow(qPoll, id, int64(self.lead/time.Second)).
+		Scan(&data.Title, &segment.Salt, &round, &data.Deadline)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.NothingToDoYet
+	}
+	if err != nil {
+		return err
+	}
+	encoded, err := segment.Encode()
+	if err != nil {
+		return err
+	}
+	data.Link = "r/poll/" + encoded
+	data.Round = round + 1
+
+	type recipient struct {
+		id      uint32
+		name    string
+		address string
+	}
+	var recipients []recipient
+	rows, err := db.DB.Query(qUsers, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user recipient
+		if err := rows.Scan(&user.id, &user.name, &user.address); err != nil {
+			return err
+		}
+		recipients = append(recipients, user)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, user := range recipients {
+		result, err := db.DB.Exec(qSent, id, user.id, round)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			continue
+		}
+		data.Name, data.Address = user.name, user.address
+		self.mailer.send("reminder.txt", data.Address, data)
+	}
+	return nil
+}
+
+func (self *reminderService) CheckAll() service.Iterator {
+	const qList = `
+	  SELECT p.Id,
+	         RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+	                       p.MinNbRounds) - INTERVAL ? SECOND AS Next
+	    FROM Polls AS p
+	   WHERE ` + reminderPolls + `
+	   ORDER BY Next ASC`
+	return service.SQLCheckAll(qList, int64(self.lead/time.Second))
+}
+
+func (self *reminderService) CheckOne(id uint32) (ret time.Time) {
+	const qCheck = `
+	  SELECT RoundDeadline(p.CurrentRoundStart, p.MaxRoundDuration, p.Deadline, p.CurrentRound,
+	                       p.MinNbRounds) - INTERVAL ? SECOND
+	    FROM Polls AS p
+	   WHERE p.Id = ? AND ` + reminderPolls + `
+	     AND EXISTS (SELECT 1 FROM Users AS u WHERE ` + reminderRecipients + `)`
+
+	err := db.DB.QueryRow(qCheck, int64(self.lead/time.Second), id).Scan(&ret)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		self.Logger().Errorf("CheckOne query error: %v.", err)
+	}
+	return
+}
+
+func (self *reminderService) Interval() time.Duration {
+	return 6 * time.Hour
+}
+
+func (self *reminderService) Logger() slog.Leveled {
+	return self.mailer.log
+}
+
+func (self *reminderService) FilterEvent(evt events.Event) bool {
+	switch evt.(type) {
+	case VoteEvent, NextRoundEvent, StartPollEvent, ResumePollEvent, ExtendPollEvent:
+		return true
+	}
+	return false
+}
+
+func (self *reminderService) ReceiveEvent(evt events.Event, ctrl service.RunnerControler) {
+	switch e := evt.(type) {
+	case VoteEvent:
+		ctrl.Schedule(e.Poll)
+	case NextRoundEvent:
+		ctrl.Schedule(e.Poll)
+	case StartPollEvent:
+		ctrl.Schedule(e.Poll)
+	case ResumePollEvent:
+		ctrl.Schedule(e.Poll)
+	case ExtendPollEvent:
+		ctrl.Schedule(e.Poll)
+	}
+}
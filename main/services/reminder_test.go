@@ -0,0 +1,136 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/emailsender"
+	estest "github.com/JBoudou/Itero/pkg/emailsender/emailsendertest"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func newTestReminderService(t *testing.T, lead time.Duration,
+	send func(emailsender.Email) error) *reminderService {
+	return &reminderService{
+		mailer: emailService{
+			sender: estest.SenderMock{T: t, Send_: send},
+			log:    &slog.WithStack{Target: t},
+		},
+		lead: lead,
+	}
+}
+
+func TestReminderService(t *testing.T) {
+	t.Parallel()
+
+	const (
+		qVerify = `UPDATE Users SET Verified = TRUE WHERE Id = ?`
+		qOptOut = `INSERT INTO EmailPreferences (User, OnReminder) VALUE (?, FALSE)`
+		qStart  = `
+		  UPDATE Polls SET CurrentRoundStart = CURRENT_TIMESTAMP, MaxRoundDuration = '24:00:00'
+		   WHERE Id = ?`
+		qReminded = `SELECT User FROM Reminders WHERE Poll = ? AND Round = 1 ORDER BY User`
+		qDelegate = `INSERT INTO Delegations (User, Poll, Round, Delegate) VALUE (?, ?, ?, ?)`
+	)
+
+	env := new(dbt.Env)
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name() + "Admin")
+	late := env.CreateUserWith(t.Name() + "Late")
+	voted := env.CreateUserWith(t.Name() + "Voted")
+	optOut := env.CreateUserWith(t.Name() + "OptOut")
+	unverified := env.CreateUserWith(t.Name() + "Unverified")
+	previous := env.CreateUserWith(t.Name() + "Previous")
+	current := env.CreateUserWith(t.Name() + "Current")
+	poll := env.CreatePoll("Reminder", admin, db.ElectorateAll)
+	for _, user := range []uint32{late, voted, optOut, unverified, previous, current} {
+		env.Vote(poll, 0, user, 0)
+	}
+	for _, user := range []uint32{late, voted, optOut, previous, current} {
+		env.QuietExec(qVerify, user)
+	}
+	env.QuietExec(qOptOut, optOut)
+	// The poll does not report votes, hence the delegation of previous is not effective anymore.
+	env.QuietExec(qDelegate, previous, poll, 0, voted)
+	env.NextRound(poll)
+	env.QuietExec(qStart, poll)
+	env.Vote(poll, 1, voted, 0)
+	env.QuietExec(qDelegate, current, poll, 1, voted)
+	env.Must(t)
+
+	send := func(email emailsender.Email) error {
+		t.Errorf("Unexpected email to %v.", email.To)
+		return nil
+	}
+
+	// Too early
+	svc := newTestReminderService(t, time.Hour, send)
+	if err := svc.ProcessOne(poll); !errors.Is(err, service.NothingToDoYet) {
+		t.Errorf("Wrong error. Got %v. Expect NothingToDoYet.", err)
+	}
+	if due := svc.CheckOne(poll); due.Before(time.Now().Add(22 * time.Hour)) {
+		t.Errorf("Wrong due date %v.", due)
+	}
+
+	// Reminder
+	var sent []emailsender.Email
+	svc = newTestReminderService(t, 48*time.Hour, func(email emailsender.Email) error {
+		sent = append(sent, email)
+		return nil
+	})
+	mustt(t, svc.ProcessOne(poll))
+	if len(sent) != 2 {
+		t.Fatalf("Wrong number of emails. Got %d. Expect 2.", len(sent))
+	}
+	recipients := map[string]bool{sent[0].To[0]: true, sent[1].To[0]: true}
+	for _, name := range []string{"Late", "Previous"} {
+		if expect := dbt.UserEmailWith(t.Name() + name); !recipients[expect] {
+			t.Errorf("Missing recipient %s. Got %v.", expect, recipients)
+		}
+	}
+	if err := sent[0].Tmpl.Execute(ioutil.Discard, sent[0].Data); err != nil {
+		t.Errorf("Error executing template: %v", err)
+	}
+
+	rows, err := db.DB.Query(qReminded, poll)
+	mustt(t, err)
+	var reminded []uint32
+	for rows.Next() {
+		var user uint32
+		mustt(t, rows.Scan(&user))
+		reminded = append(reminded, user)
+	}
+	mustt(t, rows.Err())
+	if expect := []uint32{late, previous}; !reflect.DeepEqual(reminded, expect) {
+		t.Errorf("Wrong reminded users. Got %v. Expect %v.", reminded, expect)
+	}
+
+	// Only once
+	svc = newTestReminderService(t, 48*time.Hour, send)
+	mustt(t, svc.ProcessOne(poll))
+	if due := svc.CheckOne(poll); !due.IsZero() {
+		t.Errorf("Unexpected due date %v.", due)
+	}
+}
@@ -95,7 +95,7 @@ func (self *startPollService) Logger() slog.Leveled {
 
 func (self *startPollService) FilterEvent(evt events.Event) bool {
 	switch evt.(type) {
-	case CreatePollEvent:
+	case CreatePollEvent, UpdatePollEvent:
 		return true
 	}
 	return false
@@ -105,5 +105,7 @@ func (self *startPollService) ReceiveEvent(evt events.Event, ctrl service.Runner
 	switch e := evt.(type) {
 	case CreatePollEvent:
 		ctrl.Schedule(e.Poll)
+	case UpdatePollEvent:
+		ctrl.Schedule(e.Poll)
 	}
 }
@@ -0,0 +1,391 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/root"
+	"github.com/JBoudou/Itero/mid/salted"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/config"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+// Values for WebhookPayload.Event.
+const (
+	WebhookEventStart     = "start"
+	WebhookEventNextRound = "next"
+	WebhookEventClose     = "close"
+	WebhookEventDelete    = "delete"
+)
+
+// WebhookSignatureHeader is the HTTP header containing the signature of the payloads posted to
+// webhooks. Its value is "sha256=" followed by the hexadecimal HMAC-SHA256 of the body, keyed with
+// the secret of the webhook.
+const WebhookSignatureHeader = "X-Itero-Signature"
+
+// WebhookPayload is the JSON object posted to webhooks.
+type WebhookPayload struct {
+	Event string
+
+	// Poll is the salted segment of the poll. It is empty for deleted polls.
+	Poll  string `json:",omitempty"`
+	Title string
+
+	// Round is the current round of the poll when the event occurred.
+	Round   uint8
+	Winners []uint8 `json:",omitempty"`
+	Time    time.Time
+}
+
+// WebhookSignature computes the value of WebhookSignatureHeader for the given body.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookClient is the HTTP client used to post notifications to webhooks.
+//
+// A factory is binded to this type in root.IoC. Unless allowed by the configuration, the client
+// created by the factory refuses to connect to loopback and private addresses. It never uses a
+// proxy, since the check would then apply to the address of the proxy instead of the webhook.
+type WebhookClient struct {
+	*http.Client
+}
+
+// WebhookService is the factory for the service that posts notifications to the webhooks
+// registered by administrators of polls. Failed deliveries are retried with exponential backoff.
+func WebhookService(client WebhookClient, log slog.StackedLeveled) *webhookService {
+	return &webhookService{
+		client: client,
+		log:    log.With("Webhook"),
+	}
+}
+
+//
+// Implementation
+//
+
+const (
+	webhookMaxAttempts = 8
+	webhookRetryDelay  = time.Minute
+	webhookTimeout     = 10 * time.Second
+	webhookMaxError    = 256
+)
+
+var webhookConfig struct {
+	// AllowPrivate allows webhooks to target loopback and private addresses.
+	AllowPrivate bool
+}
+
+func init() {
+	// Config
+	config.Value("webhooks", &webhookConfig)
+
+	// IoC
+	root.IoC.Bind(func() WebhookClient {
+		return newWebhookClient(webhookConfig.AllowPrivate)
+	})
+}
+
+var errWebhookAddress = errors.New("Forbidden webhook address")
+
+var webhookPrivateNets = func() (ret []*net.IPNet) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10",
+		"fc00::/7"} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ret = append(ret, ipNet)
+	}
+	return
+}()
+
+// checkWebhookAddress ensures that connections are made only to public addresses.
+// The check is done on resolved addresses, to prevent DNS rebinding.
+func checkWebhookAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errWebhookAddress
+	}
+	for _, ipNet := range webhookPrivateNets {
+		if ipNet.Contains(ip) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+func newWebhookClient(allowPrivate bool) WebhookClient {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = checkWebhookAddress
+	}
+	return WebhookClient{&http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+type webhookService struct {
+	client WebhookClient
+	log    slog.Leveled
+}
+
+func (self *webhookService) ProcessOne(id uint32) error {
+	const (
+		qSelect = `
+		  SELECT w.URL, w.Secret, d.Event, d.Payload, d.Attempts, d.NextAttempt <= CURRENT_TIMESTAMP
+		    FROM WebhookDeliveries AS d JOIN Webhooks AS w ON d.Webhook = w.Id
+		   WHERE d.Id = ? AND d.Status = 'Pending'`
+		qDelivered = `
+		  UPDATE WebhookDeliveries
+		     SET Status = 'Delivered', Attempts = Attempts + 1, LastCode = ?, LastError = NULL
+		   WHERE Id = ?`
+		qRetry = `
+		  UPDATE WebhookDeliveries
+		     SET Attempts = Attempts + 1, LastCode = ?, LastError = ?,
+		         NextAttempt = CURRENT_TIMESTAMP + INTERVAL ? SECOND
+		   WHERE Id = ?`
+		qFailed = `
+		  UPDATE WebhookDeliveries
+		     SET Status = 'Failed', Attempts = Attempts + 1, LastCode = ?, LastError = ?
+		   WHERE Id = ?`
+	)
+
+	var url, secret, event string
+	var payload []byte
+	var attempts uint8
+	var due bool
+	err := db.DB.QueryRow(qSelect, id).Scan(&url, &secret, &event, &payload, &attempts, &due)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !due) {
+		return service.NothingToDoYet
+	}
+	if err != nil {
+		return err
+	}
+
+	code, err := self.post(id, url, secret, event, payload)
+	var lastCode sql.NullInt32
+	if code != 0 {
+		lastCode = sql.NullInt32{Int32: int32(code), Valid: true}
+	}
+	if err == nil {
+		_, err = db.DB.Exec(qDelivered, lastCode, id)
+		if err == nil {
+			err = self.removeOrphan(id)
+		}
+		return err
+	}
+
+	message := err.Error()
+	if len(message) > webhookMaxError {
+		message = message[:webhookMaxError]
+	}
+	self.log.Logf("Delivery %d to %s failed: %s", id, url, message)
+	if attempts+1 >= webhookMaxAttempts {
+		_, err = db.DB.Exec(qFailed, lastCode, message, id)
+		if err == nil {
+			err = self.removeOrphan(id)
+		}
+		return err
+	}
+	delay := webhookRetryDelay << attempts
+	_, err = db.DB.Exec(qRetry, lastCode, message, int64(delay/time.Second), id)
+	return err
+}
+
+// post sends the payload to the webhook. It returns the HTTP status of the response, if any,
+// and an error if the delivery failed.
+func (self *webhookService) post(id uint32, url, secret, event string, payload []byte) (
+	code int, err error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url,
+		bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Itero-Webhook")
+	req.Header.Set("X-Itero-Event", event)
+	req.Header.Set("X-Itero-Delivery", strconv.FormatUint(uint64(id), 10))
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(secret, payload))
+
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	code = resp.StatusCode
+	if code < 200 || code >= 300 {
+		err = errors.New(resp.Status)
+	}
+	return
+}
+
+// removeOrphan deletes the webhook of the given delivery if its poll has been deleted and it has
+// no more pending deliveries.
+func (self *webhookService) removeOrphan(delivery uint32) error {
+	const qDelete = `
+	  DELETE w FROM Webhooks AS w JOIN WebhookDeliveries AS d ON w.Id = d.Webhook
+	   WHERE d.Id = ? AND w.Poll IS NOT NULL
+	     AND NOT EXISTS (SELECT 1 FROM Polls AS p WHERE p.Id = w.Poll)
+	     AND NOT EXISTS (SELECT 1 FROM WebhookDeliveries AS o
+	                      WHERE o.Webhook = w.Id AND o.Status = 'Pending')`
+	_, err := db.DB.Exec(qDelete, delivery)
+	return err
+}
+
+func (self *webhookService) CheckAll() service.Iterator {
+	const qList = `
+	  SELECT Id, NextAttempt FROM WebhookDeliveries
+	   WHERE Status = 'Pending'
+	   ORDER BY NextAttempt ASC`
+	return service.SQLCheckAll(qList)
+}
+
+func (self *webhookService) CheckOne(id uint32) (ret time.Time) {
+	const qCheck = `SELECT NextAttempt FROM WebhookDeliveries WHERE Id = ? AND Status = 'Pending'`
+	err := db.DB.QueryRow(qCheck, id).Scan(&ret)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		self.log.Errorf("Error in CheckOne: %v", err)
+	}
+	return
+}
+
+func (self *webhookService) Interval() time.Duration {
+	return 6 * time.Hour
+}
+
+func (self *webhookService) Logger() slog.Leveled {
+	return self.log
+}
+
+func (self *webhookService) FilterEvent(evt events.Event) bool {
+	switch evt.(type) {
+	case StartPollEvent, NextRoundEvent, ClosePollEvent, DeletePollEvent:
+		return true
+	}
+	return false
+}
+
+func (self *webhookService) ReceiveEvent(evt events.Event, ctrl service.RunnerControler) {
+	var payload WebhookPayload
+	var poll, admin uint32
+	switch e := evt.(type) {
+	case StartPollEvent:
+		poll, payload.Event = e.Poll, WebhookEventStart
+	case NextRoundEvent:
+		poll, payload.Event = e.Poll, WebhookEventNextRound
+	case ClosePollEvent:
+		poll, payload.Event, payload.Winners = e.Poll, WebhookEventClose, e.Winners
+	case DeletePollEvent:
+		poll, payload.Event, payload.Title, admin = e.Poll, WebhookEventDelete, e.Title, e.Admin
+	default:
+		return
+	}
+
+	if payload.Event != WebhookEventDelete {
+		const qPoll = `SELECT Admin, Title, Salt, CurrentRound FROM Polls WHERE Id = ?`
+		segment := salted.Segment{Id: poll}
+		err := db.DB.QueryRow(qPoll, poll).Scan(&admin, &payload.Title, &segment.Salt, &payload.Round)
+		if err == nil {
+			payload.Poll, err = segment.Encode()
+		}
+		if err != nil {
+			self.log.Errorf("Error retrieving poll %d: %v", poll, err)
+			return
+		}
+	}
+	if e, ok := evt.(NextRoundEvent); ok {
+		payload.Round = e.Round
+	}
+	payload.Time = time.Now()
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		self.log.Errorf("Error encoding payload: %v", err)
+		return
+	}
+
+	for _, hook := range self.webhooks(poll, admin) {
+		const qInsert = `INSERT INTO WebhookDeliveries (Webhook, Event, Payload) VALUE (?, ?, ?)`
+		result, err := db.DB.Exec(qInsert, hook, payload.Event, encoded)
+		var id int64
+		if err == nil {
+			id, err = result.LastInsertId()
+		}
+		if err != nil {
+			self.log.Errorf("Error creating delivery for webhook %d: %v", hook, err)
+			continue
+		}
+		ctrl.Schedule(uint32(id))
+	}
+}
+
+// webhooks returns the ids of the webhooks for the given poll.
+// Errors are logged and nil is returned.
+func (self *webhookService) webhooks(poll, admin uint32) (ret []uint32) {
+	const qList = `SELECT Id FROM Webhooks WHERE Poll = ? OR (Poll IS NULL AND User = ?)`
+	rows, err := db.DB.Query(qList, poll, admin)
+	if err != nil {
+		self.log.Errorf("Error listing webhooks of poll %d: %v", poll, err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			self.log.Errorf("Error listing webhooks of poll %d: %v", poll, err)
+			return nil
+		}
+		ret = append(ret, id)
+	}
+	if err := rows.Err(); err != nil {
+		self.log.Errorf("Error listing webhooks of poll %d: %v", poll, err)
+		return nil
+	}
+	return
+}
@@ -0,0 +1,317 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/mid/service"
+	"github.com/JBoudou/Itero/pkg/events"
+	"github.com/JBoudou/Itero/pkg/slog"
+)
+
+func TestCheckWebhookAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{address: "93.184.216.34:443", ok: true},
+		{address: "[2606:2800:220:1::1]:443", ok: true},
+		{address: "127.0.0.1:80", ok: false},
+		{address: "[::1]:80", ok: false},
+		{address: "10.1.2.3:80", ok: false},
+		{address: "172.20.0.1:80", ok: false},
+		{address: "192.168.1.1:80", ok: false},
+		{address: "169.254.169.254:80", ok: false},
+		{address: "0.0.0.0:80", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkWebhookAddress("tcp", tt.address, nil)
+			if tt.ok && err != nil {
+				t.Errorf("Unexpected error %v.", err)
+			}
+			if !tt.ok && !errors.Is(err, errWebhookAddress) {
+				t.Errorf("Wrong error. Got %v. Expect %v.", err, errWebhookAddress)
+			}
+		})
+	}
+}
+
+func TestNewWebhookClient_Private(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newWebhookClient(false).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, errWebhookAddress) {
+		t.Errorf("Wrong error. Got %v. Expect %v.", err, errWebhookAddress)
+	}
+
+	resp, err := newWebhookClient(true).Post(server.URL, "application/json", nil)
+	mustt(t, err)
+	resp.Body.Close()
+}
+
+// webhookStandIn is a local HTTP server recording the requests posted to it.
+type webhookStandIn struct {
+	*httptest.Server
+	status    int
+	body      []byte
+	signature string
+	event     string
+}
+
+func newWebhookStandIn(status int) *webhookStandIn {
+	ret := &webhookStandIn{status: status}
+	ret.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ret.body, _ = ioutil.ReadAll(r.Body)
+		ret.signature = r.Header.Get(WebhookSignatureHeader)
+		ret.event = r.Header.Get("X-Itero-Event")
+		w.WriteHeader(ret.status)
+	}))
+	return ret
+}
+
+func newTestWebhookService(t *testing.T, client *http.Client) *webhookService {
+	return &webhookService{
+		client: WebhookClient{client},
+		log:    &slog.WithStack{Target: t},
+	}
+}
+
+func TestWebhookService_ProcessOne(t *testing.T) {
+	t.Parallel()
+
+	const (
+		secret   = "secret"
+		payload  = `{"Event":"start"}`
+		qWebhook = `INSERT INTO Webhooks (User, Poll, URL, Secret) VALUE (?, ?, ?, ?)`
+		qDeliver = `
+		  INSERT INTO WebhookDeliveries (Webhook, Event, Payload, Attempts, NextAttempt)
+		  VALUE (?, 'start', ?, ?, CURRENT_TIMESTAMP + INTERVAL ? SECOND)`
+		qCheck = `SELECT Status, Attempts, IFNULL(LastCode, 0) FROM WebhookDeliveries WHERE Id = ?`
+	)
+
+	tests := []struct {
+		name           string
+		status         int
+		attempts       uint8
+		delay          int // seconds before NextAttempt
+		expectNothing  bool
+		expectStatus   string
+		expectAttempts uint8
+		expectPosted   bool
+	}{
+		{
+			name:           "Delivered",
+			status:         http.StatusOK,
+			expectStatus:   "Delivered",
+			expectAttempts: 1,
+			expectPosted:   true,
+		},
+		{
+			name:           "Retry",
+			status:         http.StatusInternalServerError,
+			attempts:       2,
+			expectStatus:   "Pending",
+			expectAttempts: 3,
+			expectPosted:   true,
+		},
+		{
+			name:           "Failed",
+			status:         http.StatusNotFound,
+			attempts:       webhookMaxAttempts - 1,
+			expectStatus:   "Failed",
+			expectAttempts: webhookMaxAttempts,
+			expectPosted:   true,
+		},
+		{
+			name:           "Not yet",
+			status:         http.StatusOK,
+			delay:          60,
+			expectNothing:  true,
+			expectStatus:   "Pending",
+			expectAttempts: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			standIn := newWebhookStandIn(tt.status)
+			defer standIn.Close()
+
+			env := new(dbt.Env)
+			defer env.Close()
+			user := env.CreateUserWith(t.Name())
+			poll := env.CreatePoll("Webhook", user, db.ElectorateAll)
+			env.Must(t)
+
+			result, err := db.DB.Exec(qWebhook, user, poll, standIn.URL, secret)
+			mustt(t, err)
+			hook, err := result.LastInsertId()
+			mustt(t, err)
+			result, err = db.DB.Exec(qDeliver, hook, payload, tt.attempts, tt.delay)
+			mustt(t, err)
+			delivery, err := result.LastInsertId()
+			mustt(t, err)
+
+			err = newTestWebhookService(t, standIn.Client()).ProcessOne(uint32(delivery))
+			if tt.expectNothing {
+				if !errors.Is(err, service.NothingToDoYet) {
+					t.Errorf("Wrong error. Got %v. Expect NothingToDoYet.", err)
+				}
+			} else {
+				mustt(t, err)
+			}
+
+			var status string
+			var attempts uint8
+			var code int
+			mustt(t, db.DB.QueryRow(qCheck, delivery).Scan(&status, &attempts, &code))
+			if status != tt.expectStatus {
+				t.Errorf("Wrong status. Got %s. Expect %s.", status, tt.expectStatus)
+			}
+			if attempts != tt.expectAttempts {
+				t.Errorf("Wrong attempts. Got %d. Expect %d.", attempts, tt.expectAttempts)
+			}
+
+			if !tt.expectPosted {
+				if standIn.body != nil {
+					t.Errorf("Unexpected post.")
+				}
+				return
+			}
+			if code != tt.status {
+				t.Errorf("Wrong last code. Got %d. Expect %d.", code, tt.status)
+			}
+			if string(standIn.body) != payload {
+				t.Errorf("Wrong body. Got %s. Expect %s.", standIn.body, payload)
+			}
+			if expect := WebhookSignature(secret, []byte(payload)); standIn.signature != expect {
+				t.Errorf("Wrong signature. Got %s. Expect %s.", standIn.signature, expect)
+			}
+			if standIn.event != WebhookEventStart {
+				t.Errorf("Wrong event. Got %s. Expect %s.", standIn.event, WebhookEventStart)
+			}
+		})
+	}
+}
+
+func TestWebhookService_ReceiveEvent(t *testing.T) {
+	t.Parallel()
+
+	const (
+		qWebhook  = `INSERT INTO Webhooks (User, Poll, URL, Secret) VALUE (?, ?, 'http://localhost/', '')`
+		qPayloads = `
+		  SELECT d.Payload FROM WebhookDeliveries AS d JOIN Webhooks AS w ON d.Webhook = w.Id
+		   WHERE w.User = ?`
+	)
+
+	tests := []struct {
+		name   string
+		event  func(poll, admin uint32) events.Event
+		expect WebhookPayload
+	}{
+		{
+			name:   "Start",
+			event:  func(poll, admin uint32) events.Event { return StartPollEvent{Poll: poll} },
+			expect: WebhookPayload{Event: WebhookEventStart, Title: "Webhook"},
+		},
+		{
+			name:   "Next",
+			event:  func(poll, admin uint32) events.Event { return NextRoundEvent{Poll: poll, Round: 2} },
+			expect: WebhookPayload{Event: WebhookEventNextRound, Title: "Webhook", Round: 2},
+		},
+		{
+			name: "Close",
+			event: func(poll, admin uint32) events.Event {
+				return ClosePollEvent{Poll: poll, Winners: []uint8{1}}
+			},
+			expect: WebhookPayload{Event: WebhookEventClose, Title: "Webhook", Winners: []uint8{1}},
+		},
+		{
+			name: "Delete",
+			event: func(poll, admin uint32) events.Event {
+				return DeletePollEvent{Poll: poll, Admin: admin, Title: "Deleted"}
+			},
+			expect: WebhookPayload{Event: WebhookEventDelete, Title: "Deleted"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := new(dbt.Env)
+			defer env.Close()
+			admin := env.CreateUserWith(t.Name())
+			other := env.CreateUserWith(t.Name() + "Other")
+			poll := env.CreatePoll("Webhook", admin, db.ElectorateAll)
+			otherPoll := env.CreatePoll("Other", admin, db.ElectorateAll)
+			env.QuietExec(qWebhook, admin, poll)
+			env.QuietExec(qWebhook, admin, nil)
+			env.QuietExec(qWebhook, admin, otherPoll)
+			env.QuietExec(qWebhook, other, nil)
+			env.Must(t)
+
+			svc := newTestWebhookService(t, http.DefaultClient)
+			evt := tt.event(poll, admin)
+			if !svc.FilterEvent(evt) {
+				t.Fatalf("Event filtered out.")
+			}
+			controler := &mockRunnerController{}
+			svc.ReceiveEvent(evt, controler)
+			if len(controler.schedule) != 2 {
+				t.Errorf("Wrong number of schedules. Got %d. Expect 2.", len(controler.schedule))
+			}
+
+			rows, err := db.DB.Query(qPayloads, admin)
+			mustt(t, err)
+			defer rows.Close()
+			count := 0
+			for rows.Next() {
+				var stored []byte
+				var got WebhookPayload
+				mustt(t, rows.Scan(&stored))
+				mustt(t, json.Unmarshal(stored, &got))
+				count++
+				if got.Event != tt.expect.Event || got.Title != tt.expect.Title ||
+					got.Round != tt.expect.Round || len(got.Winners) != len(tt.expect.Winners) {
+					t.Errorf("Wrong payload. Got %v. Expect %v.", got, tt.expect)
+				}
+				if (got.Poll == "") != (tt.expect.Event == WebhookEventDelete) {
+					t.Errorf("Wrong poll segment %s.", got.Poll)
+				}
+			}
+			mustt(t, rows.Err())
+			if count != 2 {
+				t.Errorf("Wrong number of deliveries. Got %d. Expect 2.", count)
+			}
+		})
+	}
+}
@@ -30,6 +30,7 @@ type ConfirmationType string
 const (
 	ConfirmationTypeVerify ConfirmationType = "verify"
 	ConfirmationTypePasswd ConfirmationType = "passwd"
+	ConfirmationTypeInvite ConfirmationType = "invite"
 )
 
 // CreateConfirmation creates a new confirmation.
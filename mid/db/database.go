@@ -44,10 +44,19 @@ var Ok bool
 
 var (
 	PollTypeAcceptanceSet uint8
+	PollTypeRanked        uint8
 
-	PollRulePlurality uint8
+	PollRulePlurality     uint8
+	PollRuleBorda         uint8
+	PollRuleCopeland      uint8
+	PollRuleSchulze       uint8
+	PollRuleInstantRunoff uint8
+	PollRuleApproval      uint8
+	PollRuleEqualShares   uint8
 
 	RoundTypeFreelyAsynchronous uint8
+	RoundTypeSynchronous        uint8
+	RoundTypeOneMove            uint8
 )
 
 // State is the enum type for the field State of table Polls.
@@ -56,6 +65,7 @@ type State string
 const (
 	StateWaiting    State = "Waiting"
 	StateActive     State = "Active"
+	StatePaused     State = "Paused"
 	StateTerminated State = "Terminated"
 )
 
@@ -66,6 +76,19 @@ const (
 	ElectorateAll      Electorate = "All"
 	ElectorateLogged   Electorate = "Logged"
 	ElectorateVerified Electorate = "Verified"
+	ElectorateInvited  Electorate = "Invited"
+)
+
+// Information is the enum type for the field Information of table Polls.
+type Information string
+
+const (
+	InformationNone    Information = "None"
+	InformationWinner  Information = "Winner"
+	InformationRanking Information = "Ranking"
+	InformationCounts  Information = "Counts"
+	InformationMatrix  Information = "Matrix"
+	InformationTrends  Information = "Trends"
 )
 
 var (
@@ -123,9 +146,24 @@ func init() {
 	DB.SetMaxOpenConns(cfg.MaxOpenConns)
 
 	// Fill variables
-	fillVars(logger, "PollType", map[string]*uint8{"Acceptance Set": &PollTypeAcceptanceSet})
-	fillVars(logger, "PollRule", map[string]*uint8{"Plurality": &PollRulePlurality})
-	fillVars(logger, "RoundType", map[string]*uint8{"Freely Asynchronous": &RoundTypeFreelyAsynchronous})
+	fillVars(logger, "PollType", map[string]*uint8{
+		"Acceptance Set": &PollTypeAcceptanceSet,
+		"Ranked":         &PollTypeRanked,
+	})
+	fillVars(logger, "PollRule", map[string]*uint8{
+		"Plurality":      &PollRulePlurality,
+		"Borda":          &PollRuleBorda,
+		"Copeland":       &PollRuleCopeland,
+		"Schulze":        &PollRuleSchulze,
+		"Instant-Runoff": &PollRuleInstantRunoff,
+		"Approval":       &PollRuleApproval,
+		"Equal Shares":   &PollRuleEqualShares,
+	})
+	fillVars(logger, "RoundType", map[string]*uint8{
+		"Freely Asynchronous": &RoundTypeFreelyAsynchronous,
+		"Synchronous":         &RoundTypeSynchronous,
+		"One Move":            &RoundTypeOneMove,
+	})
 }
 
 // AddURLQuery adds a query string to an url string.
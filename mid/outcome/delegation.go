@@ -0,0 +1,132 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package outcome
+
+import (
+	"context"
+
+	"github.com/JBoudou/Itero/mid/db"
+)
+
+// Delegations maps participants delegating their ballot to their delegate.
+type Delegations map[uint32]uint32
+
+// LoadDelegations retrieves the delegations effective at a round of a poll.
+//
+// If the poll does not report votes, only the delegations recorded for the round are effective.
+// Otherwise, the last delegation recorded up to the round is effective, unless the participant
+// voted in a later round.
+func LoadDelegations(ctx context.Context, poll uint32, round uint8) (Delegations, error) {
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	return loadDelegations(ctx, poll, round, params)
+}
+
+func loadDelegations(ctx context.Context, poll uint32, round uint8, params pollParams) (
+	ret Delegations, err error) {
+
+	const (
+		qAbstain = `
+		  SELECT User, Delegate
+		    FROM Delegations
+		   WHERE Poll = ? AND Round = ? AND Delegate IS NOT NULL`
+		qReport = `
+		  SELECT d.User, d.Delegate
+		    FROM Delegations AS d
+		    JOIN (
+		           SELECT User, Poll, MAX(Round) AS Round
+		             FROM Delegations
+		            WHERE Poll = ? AND Round <= ?
+		            GROUP BY User, Poll
+		         ) AS l ON (d.User, d.Poll, d.Round) = (l.User, l.Poll, l.Round)
+		   WHERE d.Delegate IS NOT NULL
+		     AND NOT EXISTS (
+		           SELECT 1
+		             FROM Participants AS p
+		            WHERE (p.User, p.Poll) = (d.User, d.Poll) AND p.Round > d.Round AND p.Round <= ?
+		         )`
+	)
+
+	var args []interface{}
+	query := qAbstain
+	args = append(args, poll, round)
+	if params.ReportVote {
+		query = qReport
+		args = append(args, round)
+	}
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ret = make(Delegations)
+	for rows.Next() {
+		var user, delegate uint32
+		if err = rows.Scan(&user, &delegate); err != nil {
+			return
+		}
+		ret[user] = delegate
+	}
+	err = rows.Err()
+	return
+}
+
+// Resolve follows the delegations transitively, and returns the weight of each voter's ballot.
+//
+// The weight of each user is given by weights, users absent from that map having a weight of one.
+// A delegation is resolved when following the chain of delegations leads to a voter that does not
+// delegate. The resolved delegator then adds its weight to the weight of that voter, and its own
+// ballot, if any, is not counted. Delegations leading to a cycle or to a user that did not vote are
+// not resolved, and the delegator counts its own ballot, if any. Voters whose ballot is not counted
+// are absent from the returned map.
+func (self Delegations) Resolve(voters map[uint32]bool, weights map[uint32]float64) map[uint32]float64 {
+	weightOf := func(user uint32) float64 {
+		if weight, ok := weights[user]; ok {
+			return weight
+		}
+		return 1
+	}
+
+	ret := make(map[uint32]float64, len(voters))
+	for voter := range voters {
+		ret[voter] = weightOf(voter)
+	}
+
+	for delegator, delegate := range self {
+		visited := map[uint32]bool{delegator: true}
+		for !visited[delegate] {
+			next, ok := self[delegate]
+			if !ok {
+				break
+			}
+			visited[delegate] = true
+			delegate = next
+		}
+		if visited[delegate] || !voters[delegate] {
+			continue
+		}
+
+		if voters[delegator] {
+			delete(ret, delegator)
+		}
+		ret[delegate] += weightOf(delegator)
+	}
+	return ret
+}
@@ -0,0 +1,183 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package outcome
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/pkg/rules"
+)
+
+func TestDelegations_Resolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		delegations Delegations
+		voters      []uint32
+		weights     map[uint32]float64
+		expect      map[uint32]float64
+	}{
+		{
+			name:        "None",
+			delegations: Delegations{},
+			voters:      []uint32{1, 2},
+			expect:      map[uint32]float64{1: 1, 2: 1},
+		},
+		{
+			name:        "Direct",
+			delegations: Delegations{1: 2},
+			voters:      []uint32{1, 2},
+			expect:      map[uint32]float64{2: 2},
+		},
+		{
+			name:        "Not voting delegator",
+			delegations: Delegations{1: 2},
+			voters:      []uint32{2},
+			expect:      map[uint32]float64{2: 2},
+		},
+		{
+			name:        "Transitive",
+			delegations: Delegations{1: 2, 2: 3, 4: 2},
+			voters:      []uint32{1, 2, 3, 4},
+			expect:      map[uint32]float64{3: 4},
+		},
+		{
+			name:        "Cycle",
+			delegations: Delegations{1: 2, 2: 3, 3: 2},
+			voters:      []uint32{1, 2, 3},
+			expect:      map[uint32]float64{1: 1, 2: 1, 3: 1},
+		},
+		{
+			name:        "Self",
+			delegations: Delegations{1: 1},
+			voters:      []uint32{1},
+			expect:      map[uint32]float64{1: 1},
+		},
+		{
+			name:        "Delegate not voting",
+			delegations: Delegations{1: 2, 3: 1},
+			voters:      []uint32{1, 3},
+			expect:      map[uint32]float64{1: 1, 3: 1},
+		},
+		{
+			name:        "Weighted",
+			delegations: Delegations{},
+			voters:      []uint32{1, 2},
+			weights:     map[uint32]float64{1: 3},
+			expect:      map[uint32]float64{1: 3, 2: 1},
+		},
+		{
+			name:        "Weighted delegation",
+			delegations: Delegations{1: 2, 3: 2},
+			voters:      []uint32{1, 2, 3},
+			weights:     map[uint32]float64{1: 3, 2: 2, 3: 0},
+			expect:      map[uint32]float64{2: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voters := make(map[uint32]bool, len(tt.voters))
+			for _, voter := range tt.voters {
+				voters[voter] = true
+			}
+			got := tt.delegations.Resolve(voters, tt.weights)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestLoadProfile_Delegation(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	other := env.CreateUserWith(t.Name() + "Other")
+	third := env.CreateUserWith(t.Name() + "Third")
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+
+	const (
+		qDelegate   = `INSERT INTO Delegations (User, Poll, Round, Delegate) VALUE (?, ?, ?, ?)`
+		qReportVote = `UPDATE Polls SET ReportVote = ? WHERE Id = ?`
+	)
+	env.Vote(poll, 0, admin, 0)
+	env.Vote(poll, 0, other, 1)
+	env.QuietExec(qDelegate, third, poll, 0, admin)
+	env.NextRound(poll)
+	env.Vote(poll, 1, admin, 2)
+	env.QuietExec(qDelegate, other, poll, 1, admin)
+	env.NextRound(poll)
+	env.Vote(poll, 2, third, 1)
+	env.Must(t)
+
+	weighted := func(weight float64, alternatives ...uint8) rules.Ballot {
+		ret := rules.NewRankedBallot(alternatives...)
+		ret.Weight = weight
+		return ret
+	}
+
+	tests := []struct {
+		name       string
+		reportVote bool
+		round      uint8
+		expect     []rules.Ballot
+	}{
+		{
+			name:   "First round",
+			round:  0,
+			expect: []rules.Ballot{weighted(2, 0), rules.NewRankedBallot(1)},
+		},
+		{
+			name:   "Abstain",
+			round:  1,
+			expect: []rules.Ballot{weighted(2, 2)},
+		},
+		{
+			name:       "Report",
+			reportVote: true,
+			round:      1,
+			expect:     []rules.Ballot{weighted(3, 2)},
+		},
+		{
+			name:       "Report voted later",
+			reportVote: true,
+			round:      2,
+			expect:     []rules.Ballot{weighted(2, 2), rules.NewRankedBallot(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env.QuietExec(qReportVote, tt.reportVote, poll)
+			env.Must(t)
+
+			got, err := LoadProfile(context.Background(), poll, tt.round)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Ballots, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got.Ballots, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package outcome computes the outcome of polls, using the voting rules of package rules.
+package outcome
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/pkg/rules"
+)
+
+var (
+	UnknownRule = errors.New("Unknown rule")
+)
+
+var registry = make(map[uint8]rules.Rule)
+
+func init() {
+	Register(db.PollRulePlurality, rules.Plurality{})
+	Register(db.PollRuleBorda, rules.Borda{})
+	Register(db.PollRuleCopeland, rules.Copeland{})
+	Register(db.PollRuleSchulze, rules.Schulze{})
+	Register(db.PollRuleInstantRunoff, rules.InstantRunoff{})
+	Register(db.PollRuleApproval, rules.Approval{})
+	Register(db.PollRuleEqualShares, rules.EqualShares{})
+}
+
+// Register associates a rule with an Id of table PollRule.
+// This function is not safe for concurrent use. It should only be called from init functions.
+func Register(id uint8, rule rules.Rule) {
+	registry[id] = rule
+}
+
+// RuleOf returns the rule associated with an Id of table PollRule.
+func RuleOf(id uint8) (rules.Rule, error) {
+	rule, ok := registry[id]
+	if !ok {
+		return nil, UnknownRule
+	}
+	return rule, nil
+}
+
+type pollParams struct {
+	NbChoices      uint8
+	ReportVote     bool
+	Rule           uint8
+	MaxOutcomeCost float64
+}
+
+func loadPollParams(ctx context.Context, poll uint32) (ret pollParams, err error) {
+	const qPoll = `SELECT NbChoices, ReportVote, Rule, MaxOutcomeCost FROM Polls WHERE Id = ?`
+	err = db.DB.QueryRowContext(ctx, qPoll, poll).
+		Scan(&ret.NbChoices, &ret.ReportVote, &ret.Rule, &ret.MaxOutcomeCost)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = db.NotFound
+	}
+	return
+}
+
+// LoadRule retrieves the rule of a poll.
+func LoadRule(ctx context.Context, poll uint32) (rules.Rule, error) {
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	return RuleOf(params.Rule)
+}
+
+// LoadBudget retrieves the costs of the alternatives of a poll and its MaxOutcomeCost.
+func LoadBudget(ctx context.Context, poll uint32) (rules.Budget, error) {
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return rules.Budget{}, err
+	}
+	return loadBudget(ctx, poll, params)
+}
+
+func loadBudget(ctx context.Context, poll uint32, params pollParams) (
+	budget rules.Budget, err error) {
+
+	const qCost = `SELECT Id, Cost FROM Alternatives WHERE Poll = ?`
+
+	rows, err := db.DB.QueryContext(ctx, qCost, poll)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	budget.Limit = params.MaxOutcomeCost
+	budget.Costs = make([]float64, params.NbChoices)
+	for rows.Next() {
+		var id uint8
+		var cost float64
+		if err = rows.Scan(&id, &cost); err != nil {
+			return
+		}
+		if int(id) < len(budget.Costs) {
+			budget.Costs[id] = cost
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// LoadProfile retrieves the ballots of a round of a poll.
+//
+// Each participant of the round contributes one ballot, possibly blank. If the poll reports votes,
+// participants who did not vote during the round but voted previously contribute their last ballot.
+// Ballots are weighted by the weights of the participants, and delegations are resolved as
+// explained in Delegations.Resolve. Ballots with a null weight are not in the profile.
+func LoadProfile(ctx context.Context, poll uint32, round uint8) (*rules.Profile, error) {
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	return loadProfile(ctx, poll, round, params)
+}
+
+func loadProfile(ctx context.Context, poll uint32, round uint8, params pollParams) (
+	profile *rules.Profile, err error) {
+
+	const (
+		qAbstain = `
+		  SELECT p.User, b.Alternative, b.Rank
+		    FROM Participants AS p
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   WHERE p.Poll = ? AND p.Round = ?
+		   ORDER BY p.User`
+		qReport = `
+		  SELECT p.User, b.Alternative, b.Rank
+		    FROM (
+		           SELECT User, Poll, MAX(Round) AS Round
+		             FROM Participants
+		            WHERE Poll = ? AND Round <= ?
+		            GROUP BY User, Poll
+		         ) AS p
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   ORDER BY p.User`
+	)
+
+	query := qAbstain
+	if params.ReportVote {
+		query = qReport
+	}
+	rows, err := db.DB.QueryContext(ctx, query, poll, round)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var users []uint32
+	ballots := make(map[uint32]rules.Ballot)
+	for rows.Next() {
+		var user uint32
+		var alternative, rank sql.NullInt32
+		if err = rows.Scan(&user, &alternative, &rank); err != nil {
+			return
+		}
+		current, ok := ballots[user]
+		if !ok {
+			current = rules.Ballot{Ranks: make(map[uint8]uint8)}
+			ballots[user] = current
+			users = append(users, user)
+		}
+		if alternative.Valid {
+			current.Ranks[uint8(alternative.Int32)] = uint8(rank.Int32)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+
+	delegations, err := loadDelegations(ctx, poll, round, params)
+	if err != nil {
+		return
+	}
+	userWeights, err := loadWeights(ctx, poll)
+	if err != nil {
+		return
+	}
+	profile = makeProfile(params.NbChoices, users, ballots, delegations, userWeights)
+	return
+}
+
+// makeProfile weights the ballots of users and adds them to a new profile, in the order of users.
+func makeProfile(nbChoices uint8, users []uint32, ballots map[uint32]rules.Ballot,
+	delegations Delegations, userWeights map[uint32]float64) *rules.Profile {
+
+	voters := make(map[uint32]bool, len(users))
+	for _, user := range users {
+		voters[user] = true
+	}
+	weights := delegations.Resolve(voters, userWeights)
+
+	profile := rules.NewProfile(nbChoices)
+	for _, user := range users {
+		weight, ok := weights[user]
+		if !ok || weight == 0 {
+			continue
+		}
+		ballot := ballots[user]
+		if weight != 1 {
+			ballot.Weight = weight
+		}
+		profile.Add(ballot)
+	}
+	return profile
+}
+
+// LoadProfiles retrieves the profiles of the rounds of a poll before round nbRounds.
+//
+// The returned slice contains nbRounds profiles, equal to those returned by LoadProfile for each
+// round. All the ballots and delegations are retrieved at once, making this function more efficient
+// than calling LoadProfile for each round.
+func LoadProfiles(ctx context.Context, poll uint32, nbRounds uint8) (
+	profiles []*rules.Profile, err error) {
+
+	const (
+		qBallots = `
+		  SELECT p.User, p.Round, b.Alternative, b.Rank
+		    FROM Participants AS p
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   WHERE p.Poll = ? AND p.Round < ?`
+		qDelegations = `
+		  SELECT User, Round, Delegate
+		    FROM Delegations
+		   WHERE Poll = ? AND Round < ?`
+	)
+
+	type delegation struct {
+		Delegate sql.NullInt32
+		Round    uint8
+	}
+
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return
+	}
+
+	// Ballots and delegations by round.
+	ballotsAt := make([]map[uint32]rules.Ballot, nbRounds)
+	delegationsAt := make([]map[uint32]sql.NullInt32, nbRounds)
+	for r := range ballotsAt {
+		ballotsAt[r] = make(map[uint32]rules.Ballot)
+		delegationsAt[r] = make(map[uint32]sql.NullInt32)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, qBallots, poll, nbRounds)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user uint32
+		var round uint8
+		var alternative, rank sql.NullInt32
+		if err = rows.Scan(&user, &round, &alternative, &rank); err != nil {
+			return
+		}
+		current, ok := ballotsAt[round][user]
+		if !ok {
+			current = rules.Ballot{Ranks: make(map[uint8]uint8)}
+			ballotsAt[round][user] = current
+		}
+		if alternative.Valid {
+			current.Ranks[uint8(alternative.Int32)] = uint8(rank.Int32)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+
+	rows, err = db.DB.QueryContext(ctx, qDelegations, poll, nbRounds)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user uint32
+		var round uint8
+		var delegate sql.NullInt32
+		if err = rows.Scan(&user, &round, &delegate); err != nil {
+			return
+		}
+		delegationsAt[round][user] = delegate
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+
+	userWeights, err := loadWeights(ctx, poll)
+	if err != nil {
+		return
+	}
+
+	// Last ballot, last vote and last delegation of each user, up to the current round.
+	lastBallots := make(map[uint32]rules.Ballot)
+	lastVotes := make(map[uint32]uint8)
+	lastDelegations := make(map[uint32]delegation)
+
+	profiles = make([]*rules.Profile, nbRounds)
+	for r := range profiles {
+		round := uint8(r)
+		ballots := ballotsAt[r]
+		delegations := make(Delegations)
+
+		if params.ReportVote {
+			for user, ballot := range ballotsAt[r] {
+				lastBallots[user] = ballot
+				lastVotes[user] = round
+			}
+			for user, delegate := range delegationsAt[r] {
+				lastDelegations[user] = delegation{Delegate: delegate, Round: round}
+			}
+			ballots = lastBallots
+			for user, last := range lastDelegations {
+				if vote, ok := lastVotes[user]; last.Delegate.Valid && !(ok && vote > last.Round) {
+					delegations[user] = uint32(last.Delegate.Int32)
+				}
+			}
+		} else {
+			for user, delegate := range delegationsAt[r] {
+				if delegate.Valid {
+					delegations[user] = uint32(delegate.Int32)
+				}
+			}
+		}
+
+		users := make([]uint32, 0, len(ballots))
+		for user := range ballots {
+			users = append(users, user)
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+		profiles[r] = makeProfile(params.NbChoices, users, ballots, delegations, userWeights)
+	}
+	return
+}
+
+func loadWeights(ctx context.Context, poll uint32) (ret map[uint32]float64, err error) {
+	const qWeights = `SELECT User, Weight FROM Weights WHERE Poll = ?`
+
+	rows, err := db.DB.QueryContext(ctx, qWeights, poll)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ret = make(map[uint32]float64)
+	for rows.Next() {
+		var user, weight uint32
+		if err = rows.Scan(&user, &weight); err != nil {
+			return
+		}
+		ret[user] = float64(weight)
+	}
+	err = rows.Err()
+	return
+}
+
+// Result is the outcome of a round of a poll.
+type Result struct {
+	rules.Outcome
+
+	// Selection lists, in increasing order, the alternatives selected within the budget of the poll
+	// (i.e., whose total cost is at most MaxOutcomeCost). It is computed by the rule of the poll if
+	// it is a rules.BudgetRule, and by rules.SelectGreedily otherwise.
+	Selection []uint8
+}
+
+// Compute computes the outcome of a round of a poll, using the rule of the poll.
+func Compute(ctx context.Context, poll uint32, round uint8) (ret Result, err error) {
+	params, err := loadPollParams(ctx, poll)
+	if err != nil {
+		return
+	}
+	rule, err := RuleOf(params.Rule)
+	if err != nil {
+		return
+	}
+	profile, err := loadProfile(ctx, poll, round, params)
+	if err != nil {
+		return
+	}
+	budget, err := loadBudget(ctx, poll, params)
+	if err != nil {
+		return
+	}
+
+	ret.Outcome = rule.Outcome(profile)
+	if budgetRule, ok := rule.(rules.BudgetRule); ok {
+		ret.Selection = budgetRule.Select(profile, budget)
+	} else {
+		ret.Selection = rules.SelectGreedily(ret.Outcome, budget)
+	}
+	return
+}
@@ -0,0 +1,249 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package outcome
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/JBoudou/Itero/mid/db"
+	dbt "github.com/JBoudou/Itero/mid/db/dbtest"
+	"github.com/JBoudou/Itero/pkg/rules"
+)
+
+func precheck(t *testing.T) {
+	if !db.Ok {
+		t.Log("Impossible to test package outcome: package db is not ok.")
+		t.SkipNow()
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	other := env.CreateUserWith(t.Name() + "Other")
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+
+	const (
+		qParticipate = `INSERT INTO Participants (User, Poll, Round) VALUE (?, ?, ?)`
+		qVote        = `INSERT INTO Ballots (User, Poll, Alternative, Round, Rank) VALUE (?, ?, ?, ?, ?)`
+		qReportVote  = `UPDATE Polls SET ReportVote = ? WHERE Id = ?`
+	)
+	env.QuietExec(qParticipate, admin, poll, 0)
+	env.QuietExec(qVote, admin, poll, 2, 0, 1)
+	env.QuietExec(qVote, admin, poll, 0, 0, 2)
+	env.QuietExec(qParticipate, other, poll, 0)
+	env.NextRound(poll)
+	env.QuietExec(qParticipate, other, poll, 1)
+	env.QuietExec(qVote, other, poll, 1, 1, 1)
+	env.Must(t)
+
+	tests := []struct {
+		name       string
+		reportVote bool
+		round      uint8
+		expect     []rules.Ballot
+	}{
+		{
+			name:   "First round",
+			round:  0,
+			expect: []rules.Ballot{rules.NewRankedBallot(2, 0), rules.NewRankedBallot()},
+		},
+		{
+			name:   "Abstain",
+			round:  1,
+			expect: []rules.Ballot{rules.NewRankedBallot(1)},
+		},
+		{
+			name:       "Report",
+			reportVote: true,
+			round:      1,
+			expect:     []rules.Ballot{rules.NewRankedBallot(2, 0), rules.NewRankedBallot(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env.QuietExec(qReportVote, tt.reportVote, poll)
+			env.Must(t)
+
+			got, err := LoadProfile(context.Background(), poll, tt.round)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.NbAlternatives != 3 {
+				t.Errorf("Wrong NbAlternatives. Got %d. Expect 3.", got.NbAlternatives)
+			}
+			// Ballots are sorted by user, and admin has been created first.
+			if !reflect.DeepEqual(got.Ballots, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got.Ballots, tt.expect)
+			}
+		})
+	}
+}
+
+func TestLoadProfile_Weight(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	other := env.CreateUserWith(t.Name() + "Other")
+	third := env.CreateUserWith(t.Name() + "Third")
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+
+	const qWeight = `INSERT INTO Weights (Poll, User, Weight) VALUE (?, ?, ?)`
+	env.Vote(poll, 0, admin, 0)
+	env.Vote(poll, 0, other, 1)
+	env.Vote(poll, 0, third, 2)
+	env.QuietExec(qWeight, poll, admin, 3)
+	env.QuietExec(qWeight, poll, other, 0)
+	env.Must(t)
+
+	got, err := LoadProfile(context.Background(), poll, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := rules.NewRankedBallot(0)
+	first.Weight = 3
+	expect := []rules.Ballot{first, rules.NewRankedBallot(2)}
+	if !reflect.DeepEqual(got.Ballots, expect) {
+		t.Errorf("Got %v. Expect %v.", got.Ballots, expect)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	other := env.CreateUserWith(t.Name() + "Other")
+	third := env.CreateUserWith(t.Name() + "Third")
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+
+	const (
+		qDelegate   = `INSERT INTO Delegations (User, Poll, Round, Delegate) VALUE (?, ?, ?, ?)`
+		qReportVote = `UPDATE Polls SET ReportVote = ? WHERE Id = ?`
+	)
+	env.Vote(poll, 0, admin, 0)
+	env.Vote(poll, 0, other, 1)
+	env.QuietExec(qDelegate, third, poll, 0, admin)
+	env.NextRound(poll)
+	env.Vote(poll, 1, other, 2)
+	env.Vote(poll, 1, third, 1)
+	env.NextRound(poll)
+	env.Vote(poll, 2, admin, 2)
+	env.QuietExec(qDelegate, other, poll, 2, third)
+	env.NextRound(poll)
+	env.Must(t)
+
+	for _, reportVote := range []bool{false, true} {
+		env.QuietExec(qReportVote, reportVote, poll)
+		env.Must(t)
+
+		got, err := LoadProfiles(context.Background(), poll, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 {
+			t.Fatalf("ReportVote %t. Got %d profiles. Expect 3.", reportVote, len(got))
+		}
+		for round := range got {
+			expect, err := LoadProfile(context.Background(), poll, uint8(round))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got[round], expect) {
+				t.Errorf("ReportVote %t, round %d. Got %v. Expect %v.",
+					reportVote, round, got[round], expect)
+			}
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+	env.Vote(poll, 0, admin, 1)
+	env.Must(t)
+
+	const qRule = `UPDATE Polls SET Rule = ? WHERE Id = ?`
+	ruleIds := []uint8{db.PollRulePlurality, db.PollRuleBorda, db.PollRuleSchulze, db.PollRuleEqualShares}
+	for _, rule := range ruleIds {
+		env.QuietExec(qRule, rule, poll)
+		env.Must(t)
+		got, err := Compute(context.Background(), poll, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Winners, []uint8{1}) {
+			t.Errorf("Rule %d. Got winners %v. Expect [1].", rule, got.Winners)
+		}
+		if !reflect.DeepEqual(got.Selection, []uint8{1}) {
+			t.Errorf("Rule %d. Got selection %v. Expect [1].", rule, got.Selection)
+		}
+	}
+}
+
+func TestLoadBudget(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET MaxOutcomeCost = 2.5 WHERE Id = ?`, poll)
+	env.QuietExec(`UPDATE Alternatives SET Cost = 0.5 WHERE Poll = ? AND Id = 1`, poll)
+	env.Must(t)
+
+	got, err := LoadBudget(context.Background(), poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := rules.Budget{Costs: []float64{1, 0.5, 1}, Limit: 2.5}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v. Expect %v.", got, expect)
+	}
+}
+
+func TestLoadRule(t *testing.T) {
+	precheck(t)
+
+	var env dbt.Env
+	defer env.Close()
+	admin := env.CreateUserWith(t.Name())
+	poll := env.CreatePollWith("Test", admin, db.ElectorateLogged, []string{"A", "B", "C"})
+	env.QuietExec(`UPDATE Polls SET Rule = ? WHERE Id = ?`, db.PollRuleBorda, poll)
+	env.Must(t)
+
+	got, err := LoadRule(context.Background(), poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(rules.Borda); !ok {
+		t.Errorf("Got %T. Expect rules.Borda.", got)
+	}
+}
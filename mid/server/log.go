@@ -17,6 +17,9 @@
 package server
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"time"
 	"net/http"
 	
@@ -62,3 +65,20 @@ func (self *responseWithStatus) WriteHeader(statusCode int) {
 	self.status = statusCode
 	self.ResponseWriter.WriteHeader(statusCode)
 }
+
+// Hijack implements http.Hijacker when the underlying ResponseWriter does.
+func (self *responseWithStatus) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := self.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Hijacking not supported")
+	}
+	self.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush implements http.Flusher when the underlying ResponseWriter does.
+func (self *responseWithStatus) Flush() {
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/JBoudou/Itero/pkg/slog"
 
 	gs "github.com/gorilla/sessions"
+	"github.com/gorilla/websocket"
 )
 
 // A request represents an HTTP request to be handled by the server.
@@ -136,6 +137,11 @@ func (self *Request) UnmarshalJSONBody(dst interface{}) (err error) {
 	return json.Unmarshal(self.body, &dst)
 }
 
+// Header returns the first value of the header with the given name, or the empty string.
+func (self *Request) Header(name string) string {
+	return self.original.Header.Get(name)
+}
+
 func (self *Request) RemoteAddr() string {
 	return self.original.RemoteAddr
 }
@@ -173,6 +179,10 @@ func (self *Request) addSession(session *gs.Session) {
 
 	// Check session id
 	queryId := self.original.Header.Get(sessionHeader)
+	if queryId == "" && websocket.IsWebSocketUpgrade(self.original) {
+		// Browsers cannot add headers to WebSocket handshakes.
+		queryId = self.original.URL.Query().Get(sessionHeader)
+	}
 	unconverted, ok = session.Values[sessionKeySessionId]
 	if !ok {
 		registerError("no session id in the cookie")
@@ -17,16 +17,20 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/JBoudou/Itero/pkg/b64buff"
 	"github.com/JBoudou/Itero/pkg/slog"
 
 	gs "github.com/gorilla/sessions"
+	"github.com/gorilla/websocket"
 )
 
 // Response is used to construct the response to a HTTP request.
@@ -35,6 +39,19 @@ type Response interface {
 	// On success statuc code is http.StatusOK.
 	SendJSON(ctx context.Context, data interface{})
 
+	// SendFile sends content as a file to be saved by the client under the given name.
+	// On success statuc code is http.StatusOK.
+	SendFile(ctx context.Context, name string, contentType string, content []byte)
+
+	// SendEvents sends the events received from the channel as a stream of Server-Sent Events.
+	// The method returns when the channel is closed or when the context is done.
+	SendEvents(ctx context.Context, events <-chan ServerEvent)
+
+	// SendWebSocket upgrades the connection to a WebSocket, then sends each value received from the
+	// channel as a JSON text message. Messages from the client are ignored. The method returns when
+	// the channel is closed, when the client closes the connection, or when the context is done.
+	SendWebSocket(ctx context.Context, req *Request, messages <-chan interface{})
+
 	// SendError sends an error as response.
 	// If the error is an HttpError, its code and msg are used in the HTPP response.
 	// Also log the error.
@@ -70,6 +87,169 @@ func (self response) SendJSON(ctx context.Context, data interface{}) {
 	}
 }
 
+func (self response) SendFile(ctx context.Context, name string, contentType string, content []byte) {
+	if err := ctx.Err(); err != nil {
+		self.SendError(ctx, err)
+		return
+	}
+	header := self.writer.Header()
+	header.Add("content-type", contentType)
+	header.Add("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if _, err := self.writer.Write(content); err != nil {
+		slog.CtxLogf(ctx, "Write error: %v", err)
+	}
+}
+
+// ServerEvent is an event sent by Response.SendEvents.
+// Data is encoded in JSON. Id and Type are omitted from the stream when empty.
+type ServerEvent struct {
+	Id   string
+	Type string
+	Data interface{}
+}
+
+// EventsKeepAlive is the maximal duration without any data sent by Response.SendEvents.
+// A comment is sent when no event has been sent during that duration, to keep the connection alive.
+var EventsKeepAlive = 30 * time.Second
+
+func (self response) SendEvents(ctx context.Context, events <-chan ServerEvent) {
+	if err := ctx.Err(); err != nil {
+		self.SendError(ctx, err)
+		return
+	}
+	flusher, ok := self.writer.(http.Flusher)
+	if !ok {
+		self.SendError(ctx, NewHttpError(http.StatusInternalServerError, "Internal error",
+			"Streaming unsupported"))
+		return
+	}
+
+	header := self.writer.Header()
+	header.Add("content-type", "text/event-stream")
+	header.Add("cache-control", "no-cache")
+	header.Add("x-accel-buffering", "no")
+	self.writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	write := func(content []byte) bool {
+		if _, err := self.writer.Write(content); err != nil {
+			slog.CtxLogf(ctx, "Write error: %v", err)
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	keepAlive := time.NewTicker(EventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-keepAlive.C:
+			if !write([]byte(": keep-alive\n\n")) {
+				return
+			}
+
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			content, err := evt.encode()
+			if err != nil {
+				slog.CtxLogf(ctx, "Encoding error: %v", err)
+				continue
+			}
+			if !write(content) {
+				return
+			}
+			keepAlive.Reset(EventsKeepAlive)
+		}
+	}
+}
+
+// encode returns the representation of the event in the text/event-stream format.
+func (self ServerEvent) encode() ([]byte, error) {
+	data, err := json.Marshal(self.Data)
+	if err != nil {
+		return nil, err
+	}
+	var buff bytes.Buffer
+	if self.Id != "" {
+		buff.WriteString("id: " + strings.ReplaceAll(self.Id, "\n", "") + "\n")
+	}
+	if self.Type != "" {
+		buff.WriteString("event: " + strings.ReplaceAll(self.Type, "\n", "") + "\n")
+	}
+	buff.WriteString("data: ")
+	buff.Write(data)
+	buff.WriteString("\n\n")
+	return buff.Bytes(), nil
+}
+
+// webSocketUpgrader checks that the Origin of the handshake, if any, is the host of the request.
+var webSocketUpgrader = websocket.Upgrader{}
+
+// webSocketWriteTimeout is the maximal duration of a write on a WebSocket.
+const webSocketWriteTimeout = 10 * time.Second
+
+func (self response) SendWebSocket(ctx context.Context, req *Request, messages <-chan interface{}) {
+	if err := ctx.Err(); err != nil {
+		self.SendError(ctx, err)
+		return
+	}
+	conn, err := webSocketUpgrader.Upgrade(self.writer, req.original, nil)
+	if err != nil {
+		// The upgrader has already sent an error.
+		slog.CtxLogf(ctx, "WebSocket error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Reading is necessary to process control messages from the client.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(EventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-closed:
+			return
+
+		case <-keepAlive.C:
+			deadline := time.Now().Add(webSocketWriteTimeout)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				slog.CtxLogf(ctx, "Write error: %v", err)
+				return
+			}
+
+		case msg, ok := <-messages:
+			conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				slog.CtxLogf(ctx, "Write error: %v", err)
+				return
+			}
+		}
+	}
+}
+
 func (self response) SendError(ctx context.Context, err error) {
 	send := func(statusCode int, msg string) {
 		http.Error(self.writer, msg, statusCode)
@@ -31,6 +31,7 @@ import (
 
 	"github.com/JBoudou/Itero/pkg/slog"
 	"github.com/gorilla/securecookie"
+	"github.com/gorilla/websocket"
 )
 
 func precheck(t *testing.T) {
@@ -145,6 +146,178 @@ func TestResponse_SendJSON(t *testing.T) {
 	}
 }
 
+func TestResponse_SendFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		file        string
+		contentType string
+		content     string
+		expectCode  int
+	}{
+		{
+			name:        "Success",
+			ctx:         context.Background(),
+			file:        "export.csv",
+			contentType: "text/csv",
+			content:     "a,b\n1,2\n",
+			expectCode:  http.StatusOK,
+		},
+		{
+			name:        "Canceled",
+			ctx:         canceledContext(),
+			file:        "export.csv",
+			contentType: "text/csv",
+			content:     "a,b\n1,2\n",
+			expectCode:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := httptest.NewRecorder()
+			self := response{
+				writer: mock,
+			}
+			ctx := slog.CtxSaveLogger(tt.ctx, &slog.WithStack{Target: t})
+			self.SendFile(ctx, tt.file, tt.contentType, []byte(tt.content))
+
+			result := mock.Result()
+			if result.StatusCode != tt.expectCode {
+				t.Fatalf("Wrong status. Got %d. Expect %d.", result.StatusCode, tt.expectCode)
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+			if got := result.Header.Get("content-type"); got != tt.contentType {
+				t.Errorf("Wrong Content-Type. Got %s. Expect %s.", got, tt.contentType)
+			}
+			expectDisposition := `attachment; filename=` + tt.file
+			if got := result.Header.Get("content-disposition"); got != expectDisposition {
+				t.Errorf("Wrong Content-Disposition. Got %s. Expect %s.", got, expectDisposition)
+			}
+			var buff bytes.Buffer
+			if _, err := buff.ReadFrom(result.Body); err != nil {
+				t.Fatal(err)
+			}
+			if got := buff.String(); got != tt.content {
+				t.Errorf("Wrong body. Got %q. Expect %q.", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestResponse_SendEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		events     []ServerEvent
+		expectCode int
+		expectBody string
+	}{
+		{
+			name: "Success",
+			ctx:  context.Background(),
+			events: []ServerEvent{
+				{Id: "1", Data: map[string]int{"a": 1}},
+				{Type: "test", Data: "b"},
+			},
+			expectCode: http.StatusOK,
+			expectBody: "id: 1\ndata: {\"a\":1}\n\nevent: test\ndata: \"b\"\n\n",
+		},
+		{
+			name:       "Canceled",
+			ctx:        canceledContext(),
+			events:     []ServerEvent{{Id: "1", Data: 1}},
+			expectCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := httptest.NewRecorder()
+			self := response{
+				writer: mock,
+			}
+			events := make(chan ServerEvent, len(tt.events))
+			for _, evt := range tt.events {
+				events <- evt
+			}
+			close(events)
+			ctx := slog.CtxSaveLogger(tt.ctx, &slog.WithStack{Target: t})
+			self.SendEvents(ctx, events)
+
+			result := mock.Result()
+			if result.StatusCode != tt.expectCode {
+				t.Fatalf("Wrong status. Got %d. Expect %d.", result.StatusCode, tt.expectCode)
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+			if got := result.Header.Get("content-type"); got != "text/event-stream" {
+				t.Errorf("Wrong Content-Type. Got %s. Expect text/event-stream.", got)
+			}
+			var buff bytes.Buffer
+			if _, err := buff.ReadFrom(result.Body); err != nil {
+				t.Fatal(err)
+			}
+			if got := buff.String(); got != tt.expectBody {
+				t.Errorf("Wrong body. Got %q. Expect %q.", got, tt.expectBody)
+			}
+		})
+	}
+}
+
+func TestResponse_SendWebSocket(t *testing.T) {
+	messages := []interface{}{map[string]int{"a": 1}, "b"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel := make(chan interface{}, len(messages))
+		for _, msg := range messages {
+			channel <- msg
+		}
+		close(channel)
+		ctx := slog.CtxSaveLogger(r.Context(), &slog.WithStack{Target: t})
+		response{writer: w}.SendWebSocket(ctx, &Request{original: r}, channel)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i, msg := range messages {
+		_, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Error reading message %d: %v.", i, err)
+		}
+		expect, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bytes.TrimSpace(got), expect) {
+			t.Errorf("Wrong message %d. Got %s. Expect %s.", i, got, expect)
+		}
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Got error %v. Expect normal closure.", err)
+	}
+}
+
+func TestResponse_SendWebSocket_NoUpgrade(t *testing.T) {
+	mock := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/a/test", nil)
+	ctx := slog.CtxSaveLogger(context.Background(), &slog.WithStack{Target: t})
+	response{writer: mock}.SendWebSocket(ctx, &Request{original: request}, make(chan interface{}))
+	if got := mock.Result().StatusCode; got != http.StatusBadRequest {
+		t.Errorf("Wrong status. Got %d. Expect %d.", got, http.StatusBadRequest)
+	}
+}
+
 func TestResponse_SendError(t *testing.T) {
 	ctx := slog.CtxSaveLogger(context.Background(), &slog.SimpleLogger{
 		Printer: log.New(os.Stderr, "", log.LstdFlags),
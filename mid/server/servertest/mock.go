@@ -27,6 +27,9 @@ type ResponseSpy struct {
 	Backend     server.Response
 	T           *testing.T
 	JsonFct     func(*testing.T, context.Context, interface{})
+	FileFct     func(*testing.T, context.Context, string, string, []byte)
+	EventsFct   func(*testing.T, context.Context, <-chan server.ServerEvent)
+	SocketFct   func(*testing.T, context.Context, *server.Request, <-chan interface{})
 	ErrorFct    func(*testing.T, context.Context, error)
 	RedirectFct func(*testing.T, context.Context, *server.Request, string)
 	LoginFct    func(*testing.T, context.Context, server.User, *server.Request, interface{})
@@ -41,6 +44,34 @@ func (self ResponseSpy) SendJSON(ctx context.Context, data interface{}) {
 	self.Backend.SendJSON(ctx, data)
 }
 
+func (self ResponseSpy) SendFile(ctx context.Context, name string, contentType string,
+	content []byte) {
+
+	self.T.Helper()
+	if self.FileFct != nil {
+		self.FileFct(self.T, ctx, name, contentType, content)
+	}
+	self.Backend.SendFile(ctx, name, contentType, content)
+}
+
+func (self ResponseSpy) SendEvents(ctx context.Context, events <-chan server.ServerEvent) {
+	self.T.Helper()
+	if self.EventsFct != nil {
+		self.EventsFct(self.T, ctx, events)
+	}
+	self.Backend.SendEvents(ctx, events)
+}
+
+func (self ResponseSpy) SendWebSocket(ctx context.Context, req *server.Request,
+	messages <-chan interface{}) {
+
+	self.T.Helper()
+	if self.SocketFct != nil {
+		self.SocketFct(self.T, ctx, req, messages)
+	}
+	self.Backend.SendWebSocket(ctx, req, messages)
+}
+
 func (self ResponseSpy) SendError(ctx context.Context, err error) {
 	self.T.Helper()
 	if self.ErrorFct != nil {
@@ -48,12 +48,14 @@ type Request struct {
 	Body       string
 	UserId     *uint32
 	Hash       *uint32
+	Header     http.Header
 }
 
 // Make generates an http.Request.
 //
 // Default value for Method is "GET". Default value for Target is "/a/test".
 // If RemoteAddr is not nil, the RemoteAddr field of the returned request is set to its value.
+// All values in Header are added to the headers of the request.
 // If UserId is not nil and Hash is nil then a valid session for that user is added to the request.
 // If UserId and Hash are both non-nil then an "unlogged cookie" is added to the request.
 func (self *Request) Make(t *testing.T) (req *http.Request, err error) {
@@ -79,6 +81,12 @@ func (self *Request) Make(t *testing.T) (req *http.Request, err error) {
 		req.RemoteAddr = *self.RemoteAddr
 	}
 
+	for name, values := range self.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
 	if self.UserId != nil && self.Hash == nil {
 		var sessionId string
 		sessionId, err = server.MakeSessionId()
@@ -0,0 +1,184 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"sort"
+)
+
+// epsilon is the tolerance used when comparing sums of costs.
+const epsilon = 1e-9
+
+// Budget describes the constraint on the set of alternatives selected by budgeted rules.
+type Budget struct {
+	// Costs of the alternatives, indexed by alternative.
+	Costs []float64
+
+	// Limit is the maximal total cost of the selected alternatives.
+	Limit float64
+}
+
+// BudgetRule is the interface of rules selecting a set of alternatives whose total cost is within
+// a budget.
+type BudgetRule interface {
+	Rule
+
+	// Select computes the selected alternatives, in increasing order. The profile must not be
+	// modified.
+	Select(profile *Profile, budget Budget) []uint8
+}
+
+// SelectGreedily selects alternatives following the ranking of the outcome, skipping alternatives
+// that do not fit in the remaining budget. Alternatives with a null score are never selected.
+// The result is sorted in increasing order.
+func SelectGreedily(outcome Outcome, budget Budget) []uint8 {
+	selected := make([]bool, len(outcome.Scores))
+	completeGreedily(outcome, budget, selected, 0)
+	return selectedList(selected)
+}
+
+// completeGreedily adds alternatives to selected as SelectGreedily does, knowing that spent is
+// the cost of the alternatives already selected.
+func completeGreedily(outcome Outcome, budget Budget, selected []bool, spent float64) {
+	for _, alt := range outcome.Ranking {
+		if selected[alt] || outcome.Scores[alt] <= 0 {
+			continue
+		}
+		if spent+budget.Costs[alt] <= budget.Limit+epsilon {
+			selected[alt] = true
+			spent += budget.Costs[alt]
+		}
+	}
+}
+
+func selectedList(selected []bool) (ret []uint8) {
+	for alt, ok := range selected {
+		if ok {
+			ret = append(ret, uint8(alt))
+		}
+	}
+	return
+}
+
+// EqualShares is the Method of Equal Shares, for approval ballots. Every alternative ranked by a
+// ballot is considered approved by it.
+//
+// The budget is split amongst the ballots, including blank ones, proportionally to their weight.
+// Alternatives are then selected one by one. The cost of an alternative must be paid by the ballots
+// approving it, each of them paying at most what remains of its share. At each step, the selected
+// alternative is the one minimizing the maximal payment per unit of weight, ties being broken by
+// approval score then by id. When no more alternatives can be paid this way, the selection is
+// completed greedily following the approval scores.
+//
+// The outcome computed by EqualShares is the one of Approval.
+type EqualShares struct{}
+
+// Outcome implements Rule.
+func (self EqualShares) Outcome(profile *Profile) Outcome {
+	return Approval{}.Outcome(profile)
+}
+
+// Select implements BudgetRule.
+func (self EqualShares) Select(profile *Profile, budget Budget) []uint8 {
+	nbAlt := int(profile.NbAlternatives)
+	selected := make([]bool, nbAlt)
+	approval := self.Outcome(profile)
+	if len(profile.Ballots) == 0 {
+		return nil
+	}
+
+	supporters := make([][]int, nbAlt)
+	for i, ballot := range profile.Ballots {
+		for alt := range ballot.Ranks {
+			if int(alt) < nbAlt {
+				supporters[alt] = append(supporters[alt], i)
+			}
+		}
+	}
+
+	var totalWeight float64
+	weights := make([]float64, len(profile.Ballots))
+	for i, ballot := range profile.Ballots {
+		weights[i] = ballot.Weighted()
+		totalWeight += weights[i]
+	}
+	shares := make([]float64, len(profile.Ballots))
+	for i := range shares {
+		shares[i] = budget.Limit * weights[i] / totalWeight
+	}
+	var spent float64
+
+	for {
+		best := -1
+		var bestPayment float64
+		for alt := 0; alt < nbAlt; alt++ {
+			if selected[alt] || len(supporters[alt]) == 0 {
+				continue
+			}
+			payment, ok := maxPayment(shares, weights, supporters[alt], budget.Costs[alt])
+			if !ok {
+				continue
+			}
+			if best < 0 || payment < bestPayment-epsilon ||
+				(payment <= bestPayment+epsilon && approval.Scores[alt] > approval.Scores[best]) {
+				best = alt
+				bestPayment = payment
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		selected[best] = true
+		spent += budget.Costs[best]
+		for _, i := range supporters[best] {
+			if shares[i] < bestPayment*weights[i] {
+				shares[i] = 0
+			} else {
+				shares[i] -= bestPayment * weights[i]
+			}
+		}
+	}
+
+	completeGreedily(approval, budget, selected, spent)
+	return selectedList(selected)
+}
+
+// maxPayment computes the minimal amount per unit of weight such that the given supporters can pay
+// cost when each of them pays either that amount times its weight or all its remaining share if it
+// is lower. The boolean is false if the supporters cannot afford the cost.
+func maxPayment(shares, weights []float64, supporters []int, cost float64) (float64, bool) {
+	sorted := make([]int, len(supporters))
+	copy(sorted, supporters)
+	sort.Slice(sorted, func(i, j int) bool {
+		return shares[sorted[i]]/weights[sorted[i]] < shares[sorted[j]]/weights[sorted[j]]
+	})
+
+	var payers float64
+	for _, supporter := range sorted {
+		payers += weights[supporter]
+	}
+	remaining := cost
+	for _, supporter := range sorted {
+		if shares[supporter]/weights[supporter]*payers >= remaining-epsilon {
+			return remaining / payers, true
+		}
+		remaining -= shares[supporter]
+		payers -= weights[supporter]
+	}
+	return 0, false
+}
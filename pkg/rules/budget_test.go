@@ -0,0 +1,144 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectGreedily(t *testing.T) {
+	sets := NewProfile(3)
+	sets.Add(NewSetBallot(0, 1))
+	sets.Add(NewSetBallot(1))
+
+	tests := []struct {
+		name    string
+		outcome Outcome
+		budget  Budget
+		expect  []uint8
+	}{
+		{
+			name:    "Exact",
+			outcome: Plurality{}.Outcome(tennessee()),
+			budget:  Budget{Costs: []float64{3, 2, 2, 1}, Limit: 5},
+			expect:  []uint8{0, 1},
+		},
+		{
+			name:    "Skip",
+			outcome: Plurality{}.Outcome(tennessee()),
+			budget:  Budget{Costs: []float64{4, 2, 1, 1}, Limit: 5},
+			expect:  []uint8{0, 3},
+		},
+		{
+			name:    "Null score",
+			outcome: Approval{}.Outcome(sets),
+			budget:  Budget{Costs: []float64{1, 1, 1}, Limit: 10},
+			expect:  []uint8{0, 1},
+		},
+		{
+			name:    "Too costly",
+			outcome: Approval{}.Outcome(sets),
+			budget:  Budget{Costs: []float64{2, 2, 1}, Limit: 1},
+			expect:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SelectGreedily(tt.outcome, tt.budget)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestEqualShares(t *testing.T) {
+	// A majority approving two alternatives and a minority approving a third one.
+	majority := NewProfile(3)
+	repeat(majority, 6, NewSetBallot(0, 1))
+	repeat(majority, 4, NewSetBallot(2))
+
+	blank := NewProfile(2)
+	blank.Add(NewSetBallot(0))
+	blank.Add(NewSetBallot())
+
+	tie := NewProfile(2)
+	repeat(tie, 2, NewSetBallot(0, 1))
+
+	weighted := NewProfile(2)
+	weighted.Add(Ballot{Ranks: map[uint8]uint8{0: 1}, Weight: 3})
+	weighted.Add(NewSetBallot(1))
+
+	tests := []struct {
+		name    string
+		profile *Profile
+		budget  Budget
+		expect  []uint8
+	}{
+		{
+			name:    "Proportional",
+			profile: majority,
+			budget:  Budget{Costs: []float64{5, 5, 4}, Limit: 10},
+			expect:  []uint8{0, 2},
+		},
+		{
+			name:    "Completion",
+			profile: blank,
+			budget:  Budget{Costs: []float64{1, 1}, Limit: 1},
+			expect:  []uint8{0},
+		},
+		{
+			name:    "Tie",
+			profile: tie,
+			budget:  Budget{Costs: []float64{1, 1}, Limit: 1},
+			expect:  []uint8{0},
+		},
+		{
+			name:    "Weighted",
+			profile: weighted,
+			budget:  Budget{Costs: []float64{3, 1}, Limit: 3},
+			expect:  []uint8{0},
+		},
+		{
+			name:    "Ranked",
+			profile: tennessee(),
+			budget:  Budget{Costs: []float64{1, 1, 1, 1}, Limit: 2},
+			expect:  []uint8{0, 1},
+		},
+		{
+			name:    "Empty",
+			profile: NewProfile(2),
+			budget:  Budget{Costs: []float64{1, 1}, Limit: 1},
+			expect:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EqualShares{}.Select(tt.profile, tt.budget)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+
+	// Greedy selection differs on the proportional example.
+	greedy := SelectGreedily(Approval{}.Outcome(majority), Budget{Costs: []float64{5, 5, 4}, Limit: 10})
+	if expect := []uint8{0, 1}; !reflect.DeepEqual(greedy, expect) {
+		t.Errorf("Greedy. Got %v. Expect %v.", greedy, expect)
+	}
+}
@@ -0,0 +1,64 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+// InstantRunoff is the rule that iteratively eliminates the alternative ranked first by the fewest
+// ballots, until only one remains. When a ballot ranks several remaining alternatives first, its
+// weight is split equally between them. Ballots ranking no remaining alternative are ignored. Ties
+// are broken by eliminating the alternative with the highest id.
+//
+// The score of an alternative is its number of points when it was eliminated. The score of the
+// winner is its number of points in the last comparison. Alternatives are ranked in reverse order
+// of elimination.
+type InstantRunoff struct{}
+
+// Outcome implements Rule.
+func (self InstantRunoff) Outcome(profile *Profile) (ret Outcome) {
+	nb := int(profile.NbAlternatives)
+	remaining := allAlternatives(profile)
+	ret.Scores = make([]float64, nb)
+	ret.Ranking = make([]uint8, nb)
+	if nb == 0 {
+		return
+	}
+
+	var points []float64
+	for round := nb - 1; round >= 0; round-- {
+		if round > 0 || points == nil {
+			points = make([]float64, nb)
+			for _, ballot := range profile.Ballots {
+				top := ballot.Top(remaining)
+				for _, alt := range top {
+					points[alt] += ballot.Weighted() / float64(len(top))
+				}
+			}
+		}
+
+		eliminated := -1
+		for alt := nb - 1; alt >= 0; alt-- {
+			if remaining[alt] && (eliminated < 0 || points[alt] < points[eliminated]) {
+				eliminated = alt
+			}
+		}
+		remaining[eliminated] = false
+		ret.Scores[eliminated] = points[eliminated]
+		ret.Ranking[round] = uint8(eliminated)
+	}
+
+	ret.Winners = []uint8{ret.Ranking[0]}
+	return
+}
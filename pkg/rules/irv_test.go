@@ -0,0 +1,69 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"testing"
+)
+
+func TestInstantRunoff(t *testing.T) {
+	tie := NewProfile(2)
+	tie.Add(NewRankedBallot(0, 1))
+	tie.Add(NewRankedBallot(1, 0))
+
+	split := NewProfile(3)
+	split.Add(NewSetBallot(0, 1))
+	split.Add(NewRankedBallot(2, 0))
+
+	runRuleTests(t, InstantRunoff{}, []ruleTest{
+		{
+			name:    "Tennessee",
+			profile: tennessee(),
+			expect: Outcome{
+				Scores:  []float64{42, 26, 15, 58},
+				Ranking: []uint8{3, 0, 1, 2},
+				Winners: []uint8{3},
+			},
+		},
+		{
+			name:    "Tie",
+			profile: tie,
+			expect: Outcome{
+				Scores:  []float64{1, 1},
+				Ranking: []uint8{0, 1},
+				Winners: []uint8{0},
+			},
+		},
+		{
+			name:    "Split",
+			profile: split,
+			expect: Outcome{
+				Scores:  []float64{1, 0.5, 1},
+				Ranking: []uint8{0, 2, 1},
+				Winners: []uint8{0},
+			},
+		},
+		{
+			name:    "Empty",
+			profile: NewProfile(0),
+			expect: Outcome{
+				Scores:  []float64{},
+				Ranking: []uint8{},
+			},
+		},
+	})
+}
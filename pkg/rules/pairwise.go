@@ -0,0 +1,133 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"sort"
+)
+
+// Matrix is the pairwise comparison matrix of a profile. The value Matrix[a][b] is the total weight
+// of the ballots strictly preferring alternative a to alternative b.
+type Matrix [][]float64
+
+// NewMatrix computes the pairwise comparison matrix of a profile.
+func NewMatrix(profile *Profile) Matrix {
+	nb := int(profile.NbAlternatives)
+	ret := make(Matrix, nb)
+	for a := range ret {
+		ret[a] = make([]float64, nb)
+	}
+	for _, ballot := range profile.Ballots {
+		for a := 0; a < nb; a++ {
+			if _, ok := ballot.Ranks[uint8(a)]; !ok {
+				// Unranked alternatives are never preferred.
+				continue
+			}
+			for b := 0; b < nb; b++ {
+				if ballot.Prefers(uint8(a), uint8(b)) {
+					ret[a][b] += ballot.Weighted()
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// Copeland is the rule where each alternative receives one point for each other alternative it
+// beats in pairwise comparison, and half a point for each tie. A Condorcet winner, when it exists,
+// is the only winner.
+type Copeland struct{}
+
+// Outcome implements Rule.
+func (self Copeland) Outcome(profile *Profile) Outcome {
+	matrix := NewMatrix(profile)
+	scores := make([]float64, profile.NbAlternatives)
+	for a := range scores {
+		for b := range scores {
+			if a == b {
+				continue
+			}
+			if matrix[a][b] > matrix[b][a] {
+				scores[a] += 1
+			} else if matrix[a][b] == matrix[b][a] {
+				scores[a] += 0.5
+			}
+		}
+	}
+	return NewOutcome(scores)
+}
+
+// Schulze is the beatpath method. Each alternative receives one point for each alternative it
+// beats through the strongest path. Winners are the alternatives that are beaten by no other one.
+type Schulze struct{}
+
+// Outcome implements Rule.
+func (self Schulze) Outcome(profile *Profile) Outcome {
+	matrix := NewMatrix(profile)
+	nb := len(matrix)
+
+	// Strength of the strongest paths (Floyd-Warshall).
+	strength := make([][]float64, nb)
+	for a := range strength {
+		strength[a] = make([]float64, nb)
+		for b := range strength[a] {
+			if a != b && matrix[a][b] > matrix[b][a] {
+				strength[a][b] = matrix[a][b]
+			}
+		}
+	}
+	for i := 0; i < nb; i++ {
+		for a := 0; a < nb; a++ {
+			if a == i {
+				continue
+			}
+			for b := 0; b < nb; b++ {
+				if b == i || b == a {
+					continue
+				}
+				via := strength[a][i]
+				if strength[i][b] < via {
+					via = strength[i][b]
+				}
+				if via > strength[a][b] {
+					strength[a][b] = via
+				}
+			}
+		}
+	}
+
+	scores := make([]float64, nb)
+	beaten := make([]bool, nb)
+	for a := 0; a < nb; a++ {
+		for b := 0; b < nb; b++ {
+			if strength[a][b] > strength[b][a] {
+				scores[a] += 1
+				beaten[b] = true
+			}
+		}
+	}
+
+	ret := NewOutcome(scores)
+	ret.Winners = ret.Winners[:0]
+	for a := 0; a < nb; a++ {
+		if !beaten[a] {
+			ret.Winners = append(ret.Winners, uint8(a))
+		}
+	}
+	sort.Slice(ret.Winners, func(i, j int) bool { return ret.Winners[i] < ret.Winners[j] })
+	return ret
+}
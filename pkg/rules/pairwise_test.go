@@ -0,0 +1,104 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+// wikipediaSchulze is the example of the Wikipedia page on the Schulze method, with alternatives
+// A (0) to E (4).
+func wikipediaSchulze() *Profile {
+	ret := NewProfile(5)
+	repeat(ret, 5, NewRankedBallot(0, 2, 1, 4, 3))
+	repeat(ret, 5, NewRankedBallot(0, 3, 4, 2, 1))
+	repeat(ret, 8, NewRankedBallot(1, 4, 3, 0, 2))
+	repeat(ret, 3, NewRankedBallot(2, 0, 1, 4, 3))
+	repeat(ret, 7, NewRankedBallot(2, 0, 4, 1, 3))
+	repeat(ret, 2, NewRankedBallot(2, 1, 0, 3, 4))
+	repeat(ret, 7, NewRankedBallot(3, 2, 4, 1, 0))
+	repeat(ret, 8, NewRankedBallot(4, 1, 0, 3, 2))
+	return ret
+}
+
+func TestNewMatrix(t *testing.T) {
+	profile := NewProfile(3)
+	profile.Add(NewRankedBallot(0, 1, 2))
+	profile.Add(NewRankedBallot(1))
+	profile.Add(NewSetBallot(0, 2))
+
+	got := NewMatrix(profile)
+	expect := Matrix{
+		{0, 2, 1},
+		{1, 0, 2},
+		{0, 1, 0},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v. Expect %v.", got, expect)
+	}
+}
+
+func TestCopeland(t *testing.T) {
+	tie := NewProfile(2)
+	tie.Add(NewRankedBallot(0, 1))
+	tie.Add(NewRankedBallot(1, 0))
+
+	runRuleTests(t, Copeland{}, []ruleTest{
+		{
+			name:    "Tennessee",
+			profile: tennessee(),
+			expect: Outcome{
+				Scores:  []float64{0, 3, 2, 1},
+				Ranking: []uint8{1, 2, 3, 0},
+				Winners: []uint8{1},
+			},
+		},
+		{
+			name:    "Tie",
+			profile: tie,
+			expect: Outcome{
+				Scores:  []float64{0.5, 0.5},
+				Ranking: []uint8{0, 1},
+				Winners: []uint8{0, 1},
+			},
+		},
+	})
+}
+
+func TestSchulze(t *testing.T) {
+	runRuleTests(t, Schulze{}, []ruleTest{
+		{
+			name:    "Tennessee",
+			profile: tennessee(),
+			expect: Outcome{
+				Scores:  []float64{0, 3, 2, 1},
+				Ranking: []uint8{1, 2, 3, 0},
+				Winners: []uint8{1},
+			},
+		},
+		{
+			name:    "Wikipedia",
+			profile: wikipediaSchulze(),
+			expect: Outcome{
+				Scores:  []float64{3, 1, 2, 0, 4},
+				Ranking: []uint8{4, 0, 2, 1, 3},
+				Winners: []uint8{4},
+			},
+		},
+	})
+}
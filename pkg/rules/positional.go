@@ -0,0 +1,75 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+// Plurality is the rule electing the alternatives that are the most often ranked first.
+// When a ballot ranks several alternatives first, each of them receives the weight of the ballot.
+type Plurality struct{}
+
+// Outcome implements Rule.
+func (self Plurality) Outcome(profile *Profile) Outcome {
+	all := allAlternatives(profile)
+	scores := make([]float64, profile.NbAlternatives)
+	for _, ballot := range profile.Ballots {
+		for _, alt := range ballot.Top(all) {
+			scores[alt] += ballot.Weighted()
+		}
+	}
+	return NewOutcome(scores)
+}
+
+// Approval is the rule electing the alternatives that are the most often present in ballots,
+// whatever their rank.
+type Approval struct{}
+
+// Outcome implements Rule.
+func (self Approval) Outcome(profile *Profile) Outcome {
+	scores := make([]float64, profile.NbAlternatives)
+	for _, ballot := range profile.Ballots {
+		for alt := range ballot.Ranks {
+			if alt < profile.NbAlternatives {
+				scores[alt] += ballot.Weighted()
+			}
+		}
+	}
+	return NewOutcome(scores)
+}
+
+// Borda is the rule where, for each ballot, each alternative receives one point for each
+// alternative it is strictly preferred to. This generalisation of the Borda count handles partial
+// ballots and ties.
+type Borda struct{}
+
+// Outcome implements Rule.
+func (self Borda) Outcome(profile *Profile) Outcome {
+	matrix := NewMatrix(profile)
+	scores := make([]float64, profile.NbAlternatives)
+	for a := range scores {
+		for b := range scores {
+			scores[a] += matrix[a][b]
+		}
+	}
+	return NewOutcome(scores)
+}
+
+func allAlternatives(profile *Profile) []bool {
+	ret := make([]bool, profile.NbAlternatives)
+	for i := range ret {
+		ret[i] = true
+	}
+	return ret
+}
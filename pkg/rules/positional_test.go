@@ -0,0 +1,119 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"testing"
+)
+
+func TestPlurality(t *testing.T) {
+	approval := NewProfile(3)
+	approval.Add(NewSetBallot(0, 1))
+	approval.Add(NewSetBallot(1))
+	approval.Add(NewSetBallot())
+
+	weighted := NewProfile(3)
+	weighted.Add(Ballot{Ranks: map[uint8]uint8{0: 1}, Weight: 3})
+	weighted.Add(NewSetBallot(1))
+	weighted.Add(NewSetBallot(1))
+
+	runRuleTests(t, Plurality{}, []ruleTest{
+		{
+			name:    "Tennessee",
+			profile: tennessee(),
+			expect: Outcome{
+				Scores:  []float64{42, 26, 15, 17},
+				Ranking: []uint8{0, 1, 3, 2},
+				Winners: []uint8{0},
+			},
+		},
+		{
+			name:    "Sets",
+			profile: approval,
+			expect: Outcome{
+				Scores:  []float64{1, 2, 0},
+				Ranking: []uint8{1, 0, 2},
+				Winners: []uint8{1},
+			},
+		},
+		{
+			name:    "Weighted",
+			profile: weighted,
+			expect: Outcome{
+				Scores:  []float64{3, 2, 0},
+				Ranking: []uint8{0, 1, 2},
+				Winners: []uint8{0},
+			},
+		},
+		{
+			name:    "Empty",
+			profile: NewProfile(2),
+			expect: Outcome{
+				Scores:  []float64{0, 0},
+				Ranking: []uint8{0, 1},
+				Winners: []uint8{0, 1},
+			},
+		},
+	})
+}
+
+func TestApproval(t *testing.T) {
+	profile := NewProfile(3)
+	profile.Add(NewSetBallot(0, 1))
+	profile.Add(NewSetBallot(1))
+	profile.Add(NewRankedBallot(2, 1))
+	profile.Add(NewSetBallot())
+
+	runRuleTests(t, Approval{}, []ruleTest{
+		{
+			name:    "Mixed",
+			profile: profile,
+			expect: Outcome{
+				Scores:  []float64{1, 3, 1},
+				Ranking: []uint8{1, 0, 2},
+				Winners: []uint8{1},
+			},
+		},
+	})
+}
+
+func TestBorda(t *testing.T) {
+	partial := NewProfile(3)
+	partial.Add(NewRankedBallot(0))
+	partial.Add(NewSetBallot(1, 2))
+
+	runRuleTests(t, Borda{}, []ruleTest{
+		{
+			name:    "Tennessee",
+			profile: tennessee(),
+			expect: Outcome{
+				Scores:  []float64{126, 194, 173, 107},
+				Ranking: []uint8{1, 2, 0, 3},
+				Winners: []uint8{1},
+			},
+		},
+		{
+			name:    "Partial",
+			profile: partial,
+			expect: Outcome{
+				Scores:  []float64{2, 1, 1},
+				Ranking: []uint8{0, 1, 2},
+				Winners: []uint8{0},
+			},
+		},
+	})
+}
@@ -0,0 +1,153 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package rules implements voting rules computing an outcome from a profile of ballots.
+//
+// Alternatives are identified by integers from 0 to the number of alternatives (excluded). Ballots
+// rank the alternatives, possibly with ties and possibly partially. This allows to represent
+// uninominal, approval and ranked ballots uniformly.
+package rules
+
+import (
+	"sort"
+)
+
+// Ballot is the ballot of one participant.
+//
+// Ranks associates to each alternative its rank in the ballot. The lower the rank, the more
+// preferred the alternative. Alternatives not in Ranks are less preferred than all the alternatives
+// in Ranks, and equally preferred between them. A blank ballot has an empty Ranks.
+//
+// Weight is the number of times the ballot counts. A zero Weight means that the ballot counts once,
+// hence ballots constructed without weight are not weighted.
+type Ballot struct {
+	Ranks  map[uint8]uint8
+	Weight float64
+}
+
+// NewRankedBallot constructs a ballot ranking the given alternatives in that order, the first one
+// being the preferred one.
+func NewRankedBallot(alternatives ...uint8) Ballot {
+	ret := Ballot{Ranks: make(map[uint8]uint8, len(alternatives))}
+	for i, alt := range alternatives {
+		ret.Ranks[alt] = uint8(i + 1)
+	}
+	return ret
+}
+
+// NewSetBallot constructs a ballot where all the given alternatives are equally preferred to all
+// the other ones. Such ballots represent both uninominal and approval ballots.
+func NewSetBallot(alternatives ...uint8) Ballot {
+	ret := Ballot{Ranks: make(map[uint8]uint8, len(alternatives))}
+	for _, alt := range alternatives {
+		ret.Ranks[alt] = 1
+	}
+	return ret
+}
+
+// Weighted returns the number of times the ballot counts.
+func (self Ballot) Weighted() float64 {
+	if self.Weight == 0 {
+		return 1
+	}
+	return self.Weight
+}
+
+// Prefers tells whether alternative a is strictly preferred to alternative b in the ballot.
+func (self Ballot) Prefers(a, b uint8) bool {
+	rankA, okA := self.Ranks[a]
+	if !okA {
+		return false
+	}
+	rankB, okB := self.Ranks[b]
+	return !okB || rankA < rankB
+}
+
+// Top returns the preferred alternatives of the ballot amongst those for which remaining is true.
+// Alternatives not ranked by the ballot are never returned.
+func (self Ballot) Top(remaining []bool) (ret []uint8) {
+	var best uint8
+	for alt, rank := range self.Ranks {
+		if int(alt) >= len(remaining) || !remaining[alt] {
+			continue
+		}
+		if len(ret) == 0 || rank < best {
+			ret = append(ret[:0], alt)
+			best = rank
+		} else if rank == best {
+			ret = append(ret, alt)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return
+}
+
+// Profile is the set of ballots from which an outcome is computed.
+type Profile struct {
+	NbAlternatives uint8
+	Ballots        []Ballot
+}
+
+// NewProfile creates an empty profile.
+func NewProfile(nbAlternatives uint8) *Profile {
+	return &Profile{NbAlternatives: nbAlternatives}
+}
+
+// Add adds a ballot to the profile.
+func (self *Profile) Add(ballot Ballot) {
+	self.Ballots = append(self.Ballots, ballot)
+}
+
+// Outcome is the result of a rule applied on a profile.
+type Outcome struct {
+	// Scores of the alternatives, indexed by alternative. The meaning of the scores depends on the
+	// rule, but higher is always better.
+	Scores []float64
+
+	// Ranking lists all the alternatives, from the best one to the worst one.
+	Ranking []uint8
+
+	// Winners lists the alternatives elected by the rule, in increasing order.
+	Winners []uint8
+}
+
+// NewOutcome constructs an outcome from scores.
+// Alternatives are ranked by decreasing score, ties being broken by increasing id. Winners are the
+// alternatives with maximal score.
+func NewOutcome(scores []float64) (ret Outcome) {
+	ret.Scores = scores
+	ret.Ranking = make([]uint8, len(scores))
+	for i := range ret.Ranking {
+		ret.Ranking[i] = uint8(i)
+	}
+	sort.SliceStable(ret.Ranking, func(i, j int) bool {
+		return scores[ret.Ranking[i]] > scores[ret.Ranking[j]]
+	})
+	for _, alt := range ret.Ranking {
+		if scores[alt] < scores[ret.Ranking[0]] {
+			break
+		}
+		ret.Winners = append(ret.Winners, alt)
+	}
+	sort.Slice(ret.Winners, func(i, j int) bool { return ret.Winners[i] < ret.Winners[j] })
+	return
+}
+
+// Rule is the interface of voting rules.
+type Rule interface {
+	// Outcome computes the outcome of the profile. The profile must not be modified.
+	Outcome(profile *Profile) Outcome
+}
@@ -0,0 +1,109 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+// repeat adds nb copies of ballot to profile.
+func repeat(profile *Profile, nb int, ballot Ballot) {
+	for i := 0; i < nb; i++ {
+		profile.Add(ballot)
+	}
+}
+
+// tennessee is the classical example of the capital of Tennessee, with Memphis (0), Nashville (1),
+// Chattanooga (2) and Knoxville (3).
+func tennessee() *Profile {
+	ret := NewProfile(4)
+	repeat(ret, 42, NewRankedBallot(0, 1, 2, 3))
+	repeat(ret, 26, NewRankedBallot(1, 2, 3, 0))
+	repeat(ret, 15, NewRankedBallot(2, 3, 1, 0))
+	repeat(ret, 17, NewRankedBallot(3, 2, 1, 0))
+	return ret
+}
+
+type ruleTest struct {
+	name    string
+	profile *Profile
+	expect  Outcome
+}
+
+func runRuleTests(t *testing.T, rule Rule, tests []ruleTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Outcome(tt.profile)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestBallot_Prefers(t *testing.T) {
+	ballot := Ballot{Ranks: map[uint8]uint8{0: 2, 1: 1, 2: 2}}
+	tests := []struct {
+		a, b   uint8
+		expect bool
+	}{
+		{a: 1, b: 0, expect: true},
+		{a: 0, b: 1, expect: false},
+		{a: 0, b: 2, expect: false},
+		{a: 0, b: 3, expect: true},
+		{a: 3, b: 0, expect: false},
+		{a: 3, b: 4, expect: false},
+	}
+	for _, tt := range tests {
+		if got := ballot.Prefers(tt.a, tt.b); got != tt.expect {
+			t.Errorf("Prefers(%d, %d). Got %t. Expect %t.", tt.a, tt.b, got, tt.expect)
+		}
+	}
+}
+
+func TestBallot_Top(t *testing.T) {
+	ballot := Ballot{Ranks: map[uint8]uint8{0: 2, 1: 1, 2: 2}}
+	tests := []struct {
+		name      string
+		remaining []bool
+		expect    []uint8
+	}{
+		{name: "All", remaining: []bool{true, true, true, true}, expect: []uint8{1}},
+		{name: "Tie", remaining: []bool{true, false, true, true}, expect: []uint8{0, 2}},
+		{name: "Exhausted", remaining: []bool{false, false, false, true}, expect: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ballot.Top(tt.remaining); !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("Got %v. Expect %v.", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestNewOutcome(t *testing.T) {
+	got := NewOutcome([]float64{1, 3, 3, 0})
+	expect := Outcome{
+		Scores:  []float64{1, 3, 3, 0},
+		Ranking: []uint8{1, 2, 0, 3},
+		Winners: []uint8{1, 2},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Got %v. Expect %v.", got, expect)
+	}
+}
@@ -0,0 +1,419 @@
+// Itero - Online iterative vote application
+// Copyright (C) 2021 Joseph Boudou
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JBoudou/Itero/mid/db"
+	"github.com/JBoudou/Itero/mid/outcome"
+)
+
+// PrefLib exports terminated polls as an anonymised dataset in PrefLib format.
+//
+// Polls are numbered by order of creation, independently of their ids. Each round of each poll is
+// written in its own file. Ranked polls produce strict orders on incomplete lists (.soi) and
+// other polls produce orders with ties on complete lists (.toc), the approved alternatives being
+// ranked above the others. Titles, descriptions, names of alternatives and participants are never
+// exported. The parameters of each poll, and the weights and delegations of each round, are written
+// in a JSON sidecar file.
+type PrefLib struct{}
+
+func (self PrefLib) Cmd() string {
+	return "preflib"
+}
+
+func (self PrefLib) String() string {
+	return "Export terminated polls in PrefLib format, for research."
+}
+
+func init() {
+	AddCommand(PrefLib{})
+}
+
+// preflibMetadata is the content of the sidecar file of each poll.
+type preflibMetadata struct {
+	Type              string
+	Rule              string
+	RoundType         string
+	Electorate        string
+	Information       string
+	NbChoices         uint8
+	MaxOutcomeCost    float64
+	MaxBallotCost     float64
+	BallotCostIsCount bool
+	ReportVote        bool
+	MinNbRounds       uint8
+	MaxNbRounds       *uint8  `json:",omitempty"`
+	MaxRoundDuration  *string `json:",omitempty"`
+	RoundThreshold    float64
+	NbRounds          uint8
+	Rounds            []preflibRound
+}
+
+// preflibRound summarises one round in the sidecar file. Blank ballots are counted in
+// Participants, but they are only written in .toc files.
+//
+// The PrefLib files contain one order per participant. Weights gives, for each order as written in
+// the PrefLib file, its weight in the outcome of the round: the sum of the weights of the
+// participants whose ballot is that order, including the weights of the participants delegating
+// to them. Delegators is the number of participants who delegated their ballot for the round.
+type preflibRound struct {
+	File         string
+	Participants uint32
+	Blank        uint32
+	Delegators   uint32
+	Weights      map[string]float64
+}
+
+// preflibOrder is a ballot, as a list of groups of tied alternatives. Alternatives are numbered
+// from 1, as in PrefLib.
+type preflibOrder [][]uint16
+
+func (self preflibOrder) String() string {
+	var builder strings.Builder
+	for i, group := range self {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		if len(group) > 1 {
+			builder.WriteByte('{')
+		}
+		for j, alt := range group {
+			if j > 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteString(strconv.FormatUint(uint64(alt), 10))
+		}
+		if len(group) > 1 {
+			builder.WriteByte('}')
+		}
+	}
+	return builder.String()
+}
+
+func (self PrefLib) Run(args []string) {
+	flags := flag.NewFlagSet(self.Cmd(), flag.ExitOnError)
+	out := flags.String("out", ".", "Directory where the files are written.")
+	flags.Parse(args)
+
+	if !db.Ok {
+		fmt.Println("The database is not configured.")
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		panic(err)
+	}
+
+	const qPolls = `
+	  SELECT p.Id, t.Label, r.Label, rt.Label, p.Electorate, p.Information, p.NbChoices,
+	         p.MaxOutcomeCost, p.MaxBallotCost, p.BallotCostIsCount, p.ReportVote,
+	         p.MinNbRounds, p.MaxNbRounds, p.MaxRoundDuration, p.RoundThreshold, p.CurrentRound
+	    FROM Polls AS p
+	    JOIN PollType AS t ON p.Type = t.Id
+	    JOIN PollRule AS r ON p.Rule = r.Id
+	    JOIN RoundType AS rt ON p.RoundType = rt.Id
+	   WHERE p.State = 'Terminated'
+	   ORDER BY p.Created, p.Id`
+
+	rows, err := db.DB.Query(qPolls)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var ids []uint32
+	var polls []preflibMetadata
+	for rows.Next() {
+		var id uint32
+		var meta preflibMetadata
+		var maxNbRounds sql.NullInt32
+		var maxRoundDuration sql.NullString
+		err = rows.Scan(&id, &meta.Type, &meta.Rule, &meta.RoundType, &meta.Electorate,
+			&meta.Information, &meta.NbChoices, &meta.MaxOutcomeCost, &meta.MaxBallotCost,
+			&meta.BallotCostIsCount, &meta.ReportVote, &meta.MinNbRounds, &maxNbRounds,
+			&maxRoundDuration, &meta.RoundThreshold, &meta.NbRounds)
+		if err != nil {
+			panic(err)
+		}
+		if maxNbRounds.Valid {
+			value := uint8(maxNbRounds.Int32)
+			meta.MaxNbRounds = &value
+		}
+		if maxRoundDuration.Valid {
+			meta.MaxRoundDuration = &maxRoundDuration.String
+		}
+		ids = append(ids, id)
+		polls = append(polls, meta)
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+
+	date := time.Now().Format("2006-01-02")
+	for i, id := range ids {
+		self.exportPoll(*out, uint32(i+1), id, &polls[i], date)
+	}
+	fmt.Printf("%d polls exported.\n", len(ids))
+}
+
+// exportPoll writes all the files for one poll. The number is the anonymised identifier of the
+// poll in the dataset.
+func (self PrefLib) exportPoll(dir string, number uint32, id uint32, meta *preflibMetadata,
+	date string) {
+
+	dataType := "toc"
+	if meta.Type == "Ranked" {
+		dataType = "soi"
+	}
+	base := fmt.Sprintf("%08d", number)
+	sidecar := base + ".json"
+
+	meta.Rounds = make([]preflibRound, meta.NbRounds)
+	for round := uint8(0); round < meta.NbRounds; round++ {
+		orders, blank := self.roundOrders(id, round, meta.ReportVote, meta.NbChoices,
+			dataType == "soi")
+		participants := uint32(len(orders))
+		if dataType == "soi" {
+			participants += blank
+		}
+		weights, delegators := self.roundWeights(id, round, meta.NbChoices, dataType == "soi")
+		name := fmt.Sprintf("%s-%02d.%s", base, round+1, dataType)
+		meta.Rounds[round] = preflibRound{
+			File:         name,
+			Participants: participants,
+			Blank:        blank,
+			Delegators:   delegators,
+			Weights:      weights,
+		}
+
+		var header strings.Builder
+		fmt.Fprintf(&header, "# FILE NAME: %s\n", name)
+		fmt.Fprintf(&header, "# TITLE: Itero poll %d, round %d\n", number, round+1)
+		fmt.Fprintf(&header, "# DESCRIPTION: Round %d of an iterative poll. Parameters in %s.\n",
+			round+1, sidecar)
+		fmt.Fprintf(&header, "# DATA TYPE: %s\n", dataType)
+		fmt.Fprintf(&header, "# MODIFICATION TYPE: original\n")
+		fmt.Fprintf(&header, "# RELATES TO: \n")
+		fmt.Fprintf(&header, "# RELATED FILES: %s\n", sidecar)
+		fmt.Fprintf(&header, "# PUBLICATION DATE: %s\n", date)
+		fmt.Fprintf(&header, "# MODIFICATION DATE: %s\n", date)
+		self.writeOrders(filepath.Join(dir, name), header.String(), meta.NbChoices, orders)
+	}
+
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, sidecar), content, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// roundOrders retrieves the ballots of one round, one per participant, and counts the blank ones.
+// For strict orders, blank ballots are not returned. Otherwise, they are orders where all
+// alternatives are tied. If the poll reports votes, participants who did not vote during the round
+// but voted previously contribute their last ballot. Weights and delegations are ignored.
+func (self PrefLib) roundOrders(poll uint32, round uint8, reportVote bool, nbChoices uint8,
+	strict bool) (orders []preflibOrder, blank uint32) {
+
+	const (
+		qBallots = `
+		  SELECT p.User, b.Alternative
+		    FROM Participants AS p
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   WHERE p.Poll = ? AND p.Round = ?
+		   ORDER BY p.User, b.Rank, b.Alternative`
+		qReport = `
+		  SELECT p.User, b.Alternative
+		    FROM Participants AS p
+		    JOIN (
+		           SELECT User, Poll, MAX(Round) AS Round
+		             FROM Participants
+		            WHERE Poll = ? AND Round <= ?
+		            GROUP BY User, Poll
+		         ) AS l ON (p.User, p.Poll, p.Round) = (l.User, l.Poll, l.Round)
+		    LEFT OUTER JOIN Ballots AS b ON (p.User, p.Poll, p.Round) = (b.User, b.Poll, b.Round)
+		   ORDER BY p.User, b.Rank, b.Alternative`
+	)
+
+	query := qBallots
+	if reportVote {
+		query = qReport
+	}
+	rows, err := db.DB.Query(query, poll, round)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var ballots [][]uint16
+	var lastUser uint32
+	for rows.Next() {
+		var user uint32
+		var alternative sql.NullInt32
+		if err = rows.Scan(&user, &alternative); err != nil {
+			panic(err)
+		}
+		if len(ballots) == 0 || user != lastUser {
+			ballots = append(ballots, []uint16{})
+			lastUser = user
+		}
+		if alternative.Valid {
+			last := len(ballots) - 1
+			ballots[last] = append(ballots[last], uint16(alternative.Int32)+1)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		panic(err)
+	}
+
+	for _, ballot := range ballots {
+		order, ok := self.makeOrder(ballot, nbChoices, strict)
+		if len(ballot) == 0 {
+			blank += 1
+		}
+		if ok {
+			orders = append(orders, order)
+		}
+	}
+	return
+}
+
+// roundWeights computes the weight of each order in the outcome of one round, as given by
+// outcome.LoadProfile, and counts the participants whose ballot is delegated during the round.
+// Orders are indexed by their PrefLib representation.
+func (self PrefLib) roundWeights(poll uint32, round uint8, nbChoices uint8, strict bool) (
+	weights map[string]float64, delegators uint32) {
+
+	ctx := context.Background()
+	profile, err := outcome.LoadProfile(ctx, poll, round)
+	if err != nil {
+		panic(err)
+	}
+	delegations, err := outcome.LoadDelegations(ctx, poll, round)
+	if err != nil {
+		panic(err)
+	}
+
+	weights = make(map[string]float64, len(profile.Ballots))
+	for _, weighted := range profile.Ballots {
+		ballot := make([]uint16, 0, len(weighted.Ranks))
+		for alt := range weighted.Ranks {
+			ballot = append(ballot, uint16(alt))
+		}
+		ranks := weighted.Ranks
+		sort.Slice(ballot, func(i, j int) bool {
+			if ranks[uint8(ballot[i])] != ranks[uint8(ballot[j])] {
+				return ranks[uint8(ballot[i])] < ranks[uint8(ballot[j])]
+			}
+			return ballot[i] < ballot[j]
+		})
+		for i := range ballot {
+			ballot[i] += 1
+		}
+		if order, ok := self.makeOrder(ballot, nbChoices, strict); ok {
+			weights[order.String()] += weighted.Weighted()
+		}
+	}
+	return weights, uint32(len(delegations))
+}
+
+// makeOrder converts a ballot, listing alternatives numbered from 1 by order of preference, into
+// an order. For strict orders, blank ballots cannot be converted and false is returned.
+// Otherwise, the approved alternatives are ranked above the others.
+func (self PrefLib) makeOrder(ballot []uint16, nbChoices uint8, strict bool) (preflibOrder, bool) {
+	if strict {
+		if len(ballot) == 0 {
+			return nil, false
+		}
+		order := make(preflibOrder, len(ballot))
+		for i, alt := range ballot {
+			order[i] = []uint16{alt}
+		}
+		return order, true
+	}
+
+	approved := make([]bool, int(nbChoices)+1)
+	for _, alt := range ballot {
+		approved[alt] = true
+	}
+	var rest []uint16
+	for alt := uint16(1); alt <= uint16(nbChoices); alt++ {
+		if !approved[alt] {
+			rest = append(rest, alt)
+		}
+	}
+	order := preflibOrder{}
+	if len(ballot) > 0 {
+		sorted := append([]uint16{}, ballot...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		order = append(order, sorted)
+	}
+	if len(rest) > 0 {
+		order = append(order, rest)
+	}
+	return order, true
+}
+
+// writeOrders writes a PrefLib file, with the given header followed by the description of the
+// alternatives and the count of each distinct order.
+func (self PrefLib) writeOrders(path string, header string, nbChoices uint8,
+	orders []preflibOrder) {
+
+	counts := make(map[string]uint32, len(orders))
+	for _, order := range orders {
+		counts[order.String()] += 1
+	}
+	distinct := make([]string, 0, len(counts))
+	for key := range counts {
+		distinct = append(distinct, key)
+	}
+	sort.Slice(distinct, func(i, j int) bool {
+		if counts[distinct[i]] != counts[distinct[j]] {
+			return counts[distinct[i]] > counts[distinct[j]]
+		}
+		return distinct[i] < distinct[j]
+	})
+
+	var builder strings.Builder
+	builder.WriteString(header)
+	fmt.Fprintf(&builder, "# NUMBER ALTERNATIVES: %d\n", nbChoices)
+	fmt.Fprintf(&builder, "# NUMBER VOTERS: %d\n", len(orders))
+	fmt.Fprintf(&builder, "# NUMBER UNIQUE ORDERS: %d\n", len(distinct))
+	for alt := 1; alt <= int(nbChoices); alt++ {
+		fmt.Fprintf(&builder, "# ALTERNATIVE NAME %d: Alternative %d\n", alt, alt)
+	}
+	for _, key := range distinct {
+		fmt.Fprintf(&builder, "%d: %s\n", counts[key], key)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(builder.String()), 0644); err != nil {
+		panic(err)
+	}
+}